@@ -0,0 +1,86 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"time"
+)
+
+// AuditOperation is the credential operation an AuditEvent describes
+type AuditOperation string
+
+const (
+	// AuditOperationCreateAccessKey is the creation of an access key
+	AuditOperationCreateAccessKey AuditOperation = "create_access_key"
+	// AuditOperationDeleteAccessKey is the deletion of an access key
+	AuditOperationDeleteAccessKey AuditOperation = "delete_access_key"
+	// AuditOperationDeactivateAccessKey is the deactivation of an access key
+	AuditOperationDeactivateAccessKey AuditOperation = "deactivate_access_key"
+	// AuditOperationRotateKeys is the replacement of the credentials config's
+	// access key by RotateKeys. The creation and deletion of the keys are
+	// reported as separate events.
+	AuditOperationRotateKeys AuditOperation = "rotate_keys"
+	// AuditOperationAssumeRole is the assumption of a role in a role chain
+	AuditOperationAssumeRole AuditOperation = "assume_role"
+	// AuditOperationAssumeRoleWithWebIdentity is the assumption of a role
+	// using a web identity token
+	AuditOperationAssumeRoleWithWebIdentity AuditOperation = "assume_role_with_web_identity"
+)
+
+// AuditOutcome is whether the operation an AuditEvent describes succeeded
+type AuditOutcome string
+
+const (
+	// AuditOutcomeSuccess means the operation succeeded
+	AuditOutcomeSuccess AuditOutcome = "success"
+	// AuditOutcomeFailure means the operation failed
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// AuditEvent describes an operation that changed or obtained credentials. It
+// never contains secret keys, session tokens or web identity tokens.
+type AuditEvent struct {
+	// Operation is the operation that was performed
+	Operation AuditOperation `json:"operation"`
+	// Time is when the operation completed
+	Time time.Time `json:"time"`
+	// PrincipalArn is the ARN of the user whose access key was operated on,
+	// or of the role that was assumed. It is empty if not known, for instance
+	// when deleting a key of a user that was not looked up.
+	PrincipalArn string `json:"principal_arn,omitempty"`
+	// UserName is the name of the user whose access key was operated on, if
+	// known
+	UserName string `json:"user_name,omitempty"`
+	// AccessKeyId is the ID of the access key that was created, deleted or
+	// deactivated, or of the temporary credentials obtained by assuming a
+	// role. It is empty if the operation failed before a key was known.
+	AccessKeyId string `json:"access_key_id,omitempty"`
+	// PreviousAccessKeyId is the ID of the access key that was replaced when
+	// rotating keys
+	PreviousAccessKeyId string `json:"previous_access_key_id,omitempty"`
+	// Outcome is whether the operation succeeded
+	Outcome AuditOutcome `json:"outcome"`
+	// ErrorCategory is the category of the error if the operation failed
+	ErrorCategory ErrorCategory `json:"error_category,omitempty"`
+}
+
+// AuditHook receives an AuditEvent for each credential operation. It is
+// called synchronously, so it should not block for long.
+type AuditHook func(context.Context, AuditEvent)
+
+// emitAuditEvent completes the event with the outcome of err and passes it
+// to the hook, if one is set
+func emitAuditEvent(ctx context.Context, hook AuditHook, event AuditEvent, err error) {
+	if hook == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Outcome = AuditOutcomeSuccess
+	if err != nil {
+		event.Outcome = AuditOutcomeFailure
+		event.ErrorCategory = ClassifyAWSError(err)
+	}
+	hook(ctx, event)
+}
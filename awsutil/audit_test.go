@@ -0,0 +1,185 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditRecorder records the events passed to its hook
+type auditRecorder struct {
+	l      sync.Mutex
+	events []AuditEvent
+}
+
+func (r *auditRecorder) hook(_ context.Context, event AuditEvent) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.events = append(r.events, event)
+}
+
+// take returns the recorded events and resets the recorder
+func (r *auditRecorder) take() []AuditEvent {
+	r.l.Lock()
+	defer r.l.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestAuditHook(t *testing.T) {
+	ctx := context.Background()
+	const (
+		userArn = "arn:aws:iam::123456789012:user/foouser"
+		roleArn = "arn:aws:iam::123456789012:role/foorole"
+	)
+
+	s := NewMockServer()
+	defer s.Close()
+	creds, err := s.AddUser("foouser")
+	require.NoError(t, err)
+	require.NoError(t, s.AddRole(roleArn, ""))
+
+	var recorder auditRecorder
+	auditOpt := WithAuditHook(recorder.hook)
+
+	// requireNoSecrets checks that none of the given secrets appear in the
+	// events
+	requireNoSecrets := func(t *testing.T, events []AuditEvent, secrets ...string) {
+		t.Helper()
+		encoded, err := json.Marshal(events)
+		require.NoError(t, err)
+		for _, secret := range secrets {
+			require.NotContains(t, string(encoded), secret)
+		}
+	}
+
+	t.Run("rotate", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c := newMockServerConfig(t, s, creds)
+		oldSecret := c.SecretKey
+
+		require.NoError(c.RotateKeys(ctx, WithSharedCredentials(false), auditOpt))
+		events := recorder.take()
+		require.Len(events, 3)
+		for _, event := range events {
+			assert.False(event.Time.IsZero())
+			assert.Equal(AuditOutcomeSuccess, event.Outcome)
+			assert.Empty(event.ErrorCategory)
+			assert.Equal(userArn, event.PrincipalArn)
+			assert.Equal("foouser", event.UserName)
+		}
+		assert.Equal(AuditOperationCreateAccessKey, events[0].Operation)
+		assert.Equal(c.AccessKey, events[0].AccessKeyId)
+		assert.Equal(AuditOperationDeleteAccessKey, events[1].Operation)
+		assert.Equal(creds.AccessKeyID, events[1].AccessKeyId)
+		assert.Equal(AuditOperationRotateKeys, events[2].Operation)
+		assert.Equal(c.AccessKey, events[2].AccessKeyId)
+		assert.Equal(creds.AccessKeyID, events[2].PreviousAccessKeyId)
+		requireNoSecrets(t, events, oldSecret, c.SecretKey)
+
+		creds.AccessKeyID, creds.SecretAccessKey = c.AccessKey, c.SecretKey
+	})
+
+	t.Run("rotate failure", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c := newMockServerConfig(t, s, creds)
+
+		s.FailNext("DeleteAccessKey", 1, http.StatusForbidden, &MockAWSErr{Code: "AccessDenied", Message: "denied"})
+		require.Error(c.RotateKeys(ctx, WithSharedCredentials(false), auditOpt))
+		events := recorder.take()
+		require.Len(events, 3)
+		assert.Equal(AuditOperationCreateAccessKey, events[0].Operation)
+		assert.Equal(AuditOutcomeSuccess, events[0].Outcome)
+		newKey := events[0].AccessKeyId
+		assert.NotEmpty(newKey)
+
+		assert.Equal(AuditOperationDeleteAccessKey, events[1].Operation)
+		assert.Equal(AuditOutcomeFailure, events[1].Outcome)
+		assert.Equal(ErrorCategoryAccessDenied, events[1].ErrorCategory)
+		assert.Equal(creds.AccessKeyID, events[1].AccessKeyId)
+
+		assert.Equal(AuditOperationRotateKeys, events[2].Operation)
+		assert.Equal(AuditOutcomeFailure, events[2].Outcome)
+		assert.Equal(ErrorCategoryAccessDenied, events[2].ErrorCategory)
+		assert.Empty(events[2].AccessKeyId)
+
+		// Clean up the orphaned key so later subtests stay under the limit
+		require.NoError(c.DeleteAccessKey(ctx, newKey, WithSharedCredentials(false), WithUsername("foouser"), auditOpt))
+		events = recorder.take()
+		require.Len(events, 1)
+		assert.Equal(AuditEvent{
+			Operation:   AuditOperationDeleteAccessKey,
+			Time:        events[0].Time,
+			UserName:    "foouser",
+			AccessKeyId: newKey,
+			Outcome:     AuditOutcomeSuccess,
+		}, events[0])
+	})
+
+	t.Run("role chain", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c := newMockServerConfig(t, s, creds, WithRoleChain([]RoleHop{{RoleARN: roleArn}}))
+
+		cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(false), auditOpt)
+		require.NoError(err)
+		roleCreds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		events := recorder.take()
+		require.Len(events, 1)
+		assert.Equal(AuditOperationAssumeRole, events[0].Operation)
+		assert.Equal(roleArn, events[0].PrincipalArn)
+		assert.Equal(roleCreds.AccessKeyID, events[0].AccessKeyId)
+		assert.Equal(AuditOutcomeSuccess, events[0].Outcome)
+		requireNoSecrets(t, events, roleCreds.SecretAccessKey, roleCreds.SessionToken)
+
+		c = newMockServerConfig(t, s, creds, WithRoleChain([]RoleHop{{RoleARN: "arn:aws:iam::123456789012:role/missing"}}))
+		cfg, err = c.GenerateCredentialChain(ctx, WithSharedCredentials(false), auditOpt)
+		require.NoError(err)
+		_, err = cfg.Credentials.Retrieve(ctx)
+		require.Error(err)
+		events = recorder.take()
+		require.Len(events, 1)
+		assert.Equal(AuditOutcomeFailure, events[0].Outcome)
+		assert.Empty(events[0].AccessKeyId)
+	})
+
+	t.Run("web identity", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		s.AddWebIdentityToken("token")
+		c, err := NewCredentialsConfig(
+			WithRoleArn(roleArn),
+			WithRoleSessionName("session"),
+			WithWebIdentityToken("token"),
+			WithRegion("us-east-1"),
+			WithStsEndpointResolver(s.STSEndpointResolver()),
+		)
+		require.NoError(err)
+		cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(false), auditOpt)
+		require.NoError(err)
+		roleCreds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		events := recorder.take()
+		require.Len(events, 1)
+		assert.Equal(AuditOperationAssumeRoleWithWebIdentity, events[0].Operation)
+		assert.Equal(roleArn, events[0].PrincipalArn)
+		assert.Equal(roleCreds.AccessKeyID, events[0].AccessKeyId)
+		requireNoSecrets(t, events, "token", roleCreds.SecretAccessKey, roleCreds.SessionToken)
+	})
+
+	t.Run("no hook", func(t *testing.T) {
+		c := newMockServerConfig(t, s, aws.Credentials{AccessKeyID: creds.AccessKeyID, SecretAccessKey: creds.SecretAccessKey})
+		_, err := c.CreateAccessKey(ctx, WithSharedCredentials(false))
+		require.NoError(t, err)
+		assert.Empty(t, recorder.take())
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// DefaultCredentialsRefreshWindow is how long before expiry CachedCredentials
+// refreshes credentials if WithRefreshWindow is not provided
+const DefaultCredentialsRefreshWindow = 5 * time.Minute
+
+// credentialsRefreshTimeout bounds a single call to the provider, which runs
+// independently of the context of any one caller
+const credentialsRefreshTimeout = time.Minute
+
+var _ aws.CredentialsProvider = (*CachedCredentials)(nil)
+
+// CachedCredentials caches the credentials from a provider, refreshing them
+// when they come within a configurable window of expiring. Concurrent callers
+// that need a refresh share a single call to the provider.
+//
+// If a refresh fails but the cached credentials have not yet expired, they
+// continue to be returned and the error is available from LastError.
+//
+// CachedCredentials implements aws.CredentialsProvider, so it can be used as
+// the Credentials of an aws.Config.
+type CachedCredentials struct {
+	provider      aws.CredentialsProvider
+	refreshWindow time.Duration
+	now           func() time.Time
+
+	l           sync.Mutex
+	creds       aws.Credentials
+	lastErr     error
+	lastRefresh time.Time
+	inflight    *credentialsRefresh
+}
+
+// credentialsRefresh tracks an in-progress call to the provider
+type credentialsRefresh struct {
+	doneCh chan struct{}
+	creds  aws.Credentials
+	err    error
+}
+
+// NewCachedCredentials returns a CachedCredentials wrapping the given provider.
+//
+// Supported options: WithRefreshWindow
+func NewCachedCredentials(provider aws.CredentialsProvider, opt ...Option) (*CachedCredentials, error) {
+	if provider == nil {
+		return nil, errors.New("nil credentials provider")
+	}
+
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in NewCachedCredentials: %w", err)
+	}
+
+	c := &CachedCredentials{
+		provider:      provider,
+		refreshWindow: opts.withRefreshWindow,
+		now:           opts.withNowFunc,
+	}
+	if c.refreshWindow == 0 {
+		c.refreshWindow = DefaultCredentialsRefreshWindow
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+
+	return c, nil
+}
+
+// CachedCredentials returns a CachedCredentials wrapping the credentials of
+// the credential chain generated from this config.
+//
+// Supported options: those of GenerateCredentialChain, WithAwsConfig,
+// WithRefreshWindow
+func (c *CredentialsConfig) CachedCredentials(ctx context.Context, opt ...Option) (*CachedCredentials, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in CachedCredentials: %w", err)
+	}
+
+	cfg := opts.withAwsConfig
+	if cfg == nil {
+		cfg, err = c.GenerateCredentialChain(ctx, opt...)
+		if err != nil {
+			return nil, fmt.Errorf("error calling GenerateCredentialChain: %w", err)
+		}
+	}
+
+	return NewCachedCredentials(cfg.Credentials, opt...)
+}
+
+// Retrieve returns the cached credentials, refreshing them first if they are
+// missing or within the refresh window of expiring.
+func (c *CachedCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	c.l.Lock()
+	if c.creds.HasKeys() && !c.needsRefresh() {
+		creds := c.creds
+		c.l.Unlock()
+		return creds, nil
+	}
+
+	refresh := c.inflight
+	if refresh == nil {
+		refresh = &credentialsRefresh{doneCh: make(chan struct{})}
+		c.inflight = refresh
+		c.l.Unlock()
+		go c.refresh(ctx, refresh)
+	} else {
+		c.l.Unlock()
+	}
+
+	select {
+	case <-refresh.doneCh:
+		return refresh.creds, refresh.err
+	case <-ctx.Done():
+		return aws.Credentials{}, ctx.Err()
+	}
+}
+
+// refresh calls the provider and stores the result. The call keeps the values
+// of ctx but not its cancellation, so that one caller giving up does not fail
+// the refresh for the others.
+func (c *CachedCredentials) refresh(ctx context.Context, refresh *credentialsRefresh) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), credentialsRefreshTimeout)
+	defer cancel()
+
+	// The SDK's own cache returns the same credentials until they have
+	// expired, so invalidate it to force a refresh within our window
+	if inv, ok := c.provider.(interface{ Invalidate() }); ok {
+		inv.Invalidate()
+	}
+	creds, err := c.provider.Retrieve(ctx)
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.lastRefresh = c.now()
+	c.lastErr = err
+	switch {
+	case err == nil:
+		c.creds = creds
+		refresh.creds = creds
+	case c.creds.HasKeys() && !c.expired():
+		// Keep using the existing credentials until they actually expire
+		refresh.creds = c.creds
+	default:
+		refresh.err = fmt.Errorf("error refreshing credentials: %w", err)
+	}
+	c.inflight = nil
+	close(refresh.doneCh)
+}
+
+// needsRefresh returns whether the cached credentials are within the refresh
+// window of expiring; it must be called with the lock held
+func (c *CachedCredentials) needsRefresh() bool {
+	return c.creds.CanExpire && !c.now().Before(c.creds.Expires.Add(-c.refreshWindow))
+}
+
+// expired returns whether the cached credentials have expired; it must be
+// called with the lock held
+func (c *CachedCredentials) expired() bool {
+	return c.creds.CanExpire && !c.now().Before(c.creds.Expires)
+}
+
+// Expires returns the expiry time of the cached credentials. The returned bool
+// is false if there are no cached credentials or they do not expire.
+func (c *CachedCredentials) Expires() (time.Time, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if !c.creds.HasKeys() || !c.creds.CanExpire {
+		return time.Time{}, false
+	}
+	return c.creds.Expires, true
+}
+
+// LastError returns the error from the most recent refresh, or nil if it
+// succeeded
+func (c *CachedCredentials) LastError() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.lastErr
+}
+
+// LastRefresh returns the time of the most recent refresh attempt, or the zero
+// time if there has not been one
+func (c *CachedCredentials) LastRefresh() time.Time {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.lastRefresh
+}
+
+// Invalidate discards the cached credentials, causing the next call to
+// Retrieve to refresh them
+func (c *CachedCredentials) Invalidate() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.creds = aws.Credentials{}
+}
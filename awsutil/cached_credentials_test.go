@@ -0,0 +1,293 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock is a manually advanced clock
+type testClock struct {
+	l   sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// countingProvider counts calls to the wrapped provider, optionally blocking
+// each call until released or its context is done
+type countingProvider struct {
+	aws.CredentialsProvider
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.calls.Add(1)
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return aws.Credentials{}, ctx.Err()
+		}
+	}
+	return p.CredentialsProvider.Retrieve(ctx)
+}
+
+func TestNewCachedCredentials(t *testing.T) {
+	_, err := NewCachedCredentials(nil)
+	require.Error(t, err)
+
+	_, err = NewCachedCredentials(NewMockCredentialsProvider(), MockOptionErr(errors.New("option error")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "option error")
+
+	c, err := NewCachedCredentials(NewMockCredentialsProvider())
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCredentialsRefreshWindow, c.refreshWindow)
+
+	creds := aws.Credentials{AccessKeyID: "foo", SecretAccessKey: "bar"}
+	credsConfig := &CredentialsConfig{}
+	c, err = credsConfig.CachedCredentials(context.Background(),
+		WithSharedCredentials(false),
+		WithCredentialsProvider(NewMockCredentialsProvider(WithCredentials(creds))),
+		WithRefreshWindow(time.Minute),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, c.refreshWindow)
+	actual, err := c.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, creds, actual)
+}
+
+func TestCachedCredentials(t *testing.T) {
+	ctx := context.Background()
+	clock := newTestClock()
+	expiringCreds := func(id string) aws.Credentials {
+		return aws.Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: "secret",
+			CanExpire:       true,
+			Expires:         clock.Now().Add(time.Hour),
+		}
+	}
+
+	t.Run("static", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		provider := &countingProvider{CredentialsProvider: NewMockCredentialsProvider(WithCredentials(aws.Credentials{
+			AccessKeyID:     "foo",
+			SecretAccessKey: "bar",
+		}))}
+		c, err := NewCachedCredentials(provider, withNowFunc(clock.Now))
+		require.NoError(err)
+
+		_, ok := c.Expires()
+		assert.False(ok)
+		assert.True(c.LastRefresh().IsZero())
+
+		for i := 0; i < 3; i++ {
+			creds, err := c.Retrieve(ctx)
+			require.NoError(err)
+			assert.Equal("foo", creds.AccessKeyID)
+			clock.Advance(24 * time.Hour)
+		}
+		assert.EqualValues(1, provider.calls.Load())
+		_, ok = c.Expires()
+		assert.False(ok)
+
+		c.Invalidate()
+		_, err = c.Retrieve(ctx)
+		require.NoError(err)
+		assert.EqualValues(2, provider.calls.Load())
+	})
+
+	t.Run("refresh-window", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := new(MockCredentialsProvider)
+		mock.Credentials = expiringCreds("first")
+		provider := &countingProvider{CredentialsProvider: mock}
+		c, err := NewCachedCredentials(provider, WithRefreshWindow(10*time.Minute), withNowFunc(clock.Now))
+		require.NoError(err)
+
+		creds, err := c.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("first", creds.AccessKeyID)
+		expires, ok := c.Expires()
+		assert.True(ok)
+		assert.Equal(clock.Now().Add(time.Hour), expires)
+		assert.Equal(clock.Now(), c.LastRefresh())
+
+		// Outside the window the cached credentials are used
+		clock.Advance(49 * time.Minute)
+		second := expiringCreds("second")
+		mock.Credentials = second
+		creds, err = c.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("first", creds.AccessKeyID)
+		assert.EqualValues(1, provider.calls.Load())
+
+		// Within the window they are refreshed
+		clock.Advance(time.Minute)
+		creds, err = c.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("second", creds.AccessKeyID)
+		assert.EqualValues(2, provider.calls.Load())
+		expires, _ = c.Expires()
+		assert.Equal(second.Expires, expires)
+	})
+
+	t.Run("refresh-error", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := new(MockCredentialsProvider)
+		mock.Credentials = expiringCreds("first")
+		c, err := NewCachedCredentials(mock, WithRefreshWindow(10*time.Minute), withNowFunc(clock.Now))
+		require.NoError(err)
+
+		_, err = c.Retrieve(ctx)
+		require.NoError(err)
+		assert.NoError(c.LastError())
+
+		// Within the window, a failed refresh keeps the existing credentials
+		refreshErr := errors.New("sts unavailable")
+		mock.error = refreshErr
+		clock.Advance(55 * time.Minute)
+		creds, err := c.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("first", creds.AccessKeyID)
+		assert.ErrorIs(c.LastError(), refreshErr)
+		assert.Equal(clock.Now(), c.LastRefresh())
+
+		// Once expired, the error is returned
+		clock.Advance(5 * time.Minute)
+		_, err = c.Retrieve(ctx)
+		require.Error(err)
+		assert.ErrorIs(err, refreshErr)
+
+		// And a later success clears it
+		mock.error = nil
+		mock.Credentials = expiringCreds("second")
+		creds, err = c.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("second", creds.AccessKeyID)
+		assert.NoError(c.LastError())
+	})
+
+	t.Run("concurrent-refresh", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		provider := &countingProvider{
+			CredentialsProvider: NewMockCredentialsProvider(WithCredentials(expiringCreds("foo"))),
+			release:             make(chan struct{}),
+		}
+		c, err := NewCachedCredentials(provider, withNowFunc(clock.Now))
+		require.NoError(err)
+
+		const callers = 10
+		var wg sync.WaitGroup
+		results := make(chan aws.Credentials, callers)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				creds, err := c.Retrieve(ctx)
+				assert.NoError(err)
+				results <- creds
+			}()
+		}
+		require.Eventually(func() bool { return provider.calls.Load() == 1 }, time.Second, time.Millisecond)
+		close(provider.release)
+		wg.Wait()
+		close(results)
+
+		assert.EqualValues(1, provider.calls.Load())
+		for creds := range results {
+			assert.Equal("foo", creds.AccessKeyID)
+		}
+	})
+
+	t.Run("canceled-waiter", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		provider := &countingProvider{
+			CredentialsProvider: NewMockCredentialsProvider(WithCredentials(expiringCreds("foo"))),
+			release:             make(chan struct{}),
+		}
+		c, err := NewCachedCredentials(provider, withNowFunc(clock.Now))
+		require.NoError(err)
+
+		doneCh := make(chan struct{})
+		go func() {
+			defer close(doneCh)
+			_, err := c.Retrieve(ctx)
+			assert.NoError(err)
+		}()
+		require.Eventually(func() bool { return provider.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = c.Retrieve(cancelCtx)
+		assert.ErrorIs(err, context.Canceled)
+
+		close(provider.release)
+		<-doneCh
+		assert.EqualValues(1, provider.calls.Load())
+	})
+
+	t.Run("canceled-leader", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		provider := &countingProvider{
+			CredentialsProvider: NewMockCredentialsProvider(WithCredentials(expiringCreds("foo"))),
+			release:             make(chan struct{}),
+		}
+		c, err := NewCachedCredentials(provider, withNowFunc(clock.Now))
+		require.NoError(err)
+
+		// The caller that starts the refresh gives up while it is in flight
+		cancelCtx, cancel := context.WithCancel(ctx)
+		leaderErr := make(chan error, 1)
+		go func() {
+			_, err := c.Retrieve(cancelCtx)
+			leaderErr <- err
+		}()
+		require.Eventually(func() bool { return provider.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		waiterDone := make(chan struct{})
+		go func() {
+			defer close(waiterDone)
+			creds, err := c.Retrieve(ctx)
+			assert.NoError(err)
+			assert.Equal("foo", creds.AccessKeyID)
+		}()
+
+		cancel()
+		assert.ErrorIs(<-leaderErr, context.Canceled)
+
+		// The shared refresh is unaffected and completes for the waiter
+		close(provider.release)
+		<-waiterDone
+		assert.EqualValues(1, provider.calls.Load())
+		assert.NoError(c.LastError())
+	})
+}
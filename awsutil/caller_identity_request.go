@@ -0,0 +1,356 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	callerIdentityRequestBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+	// maxCallerIdentityResponseSize limits how much of the STS response is read
+	maxCallerIdentityResponseSize = 1 << 20
+)
+
+// SignedCallerIdentityRequest is a SigV4-signed sts:GetCallerIdentity request.
+// A client can hand it to a server, which proves the client's AWS identity by
+// forwarding it to STS, without the server ever seeing the client's secret
+// key.
+type SignedCallerIdentityRequest struct {
+	// Method is the HTTP method of the request
+	Method string
+	// URL is the STS endpoint the request was signed for
+	URL string
+	// Headers are the request headers, including the signature
+	Headers http.Header
+	// Body is the request body
+	Body []byte
+}
+
+// GenerateSignedCallerIdentityRequest builds and signs an sts:GetCallerIdentity
+// request using the credentials of this config, without sending it. The
+// request is signed for the regional STS endpoint of the config's region, or
+// the endpoint given by its STSEndpointResolver.
+//
+// Supported options: those of GenerateCredentialChain, WithAwsConfig,
+// WithServerIdHeaderValue
+//
+// When WithServerIdHeaderValue is set, the value is sent in the
+// X-Vault-AWS-IAM-Server-ID header, which is included in the signature.
+func (c *CredentialsConfig) GenerateSignedCallerIdentityRequest(ctx context.Context, opt ...Option) (*SignedCallerIdentityRequest, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in GenerateSignedCallerIdentityRequest: %w", err)
+	}
+
+	cfg := opts.withAwsConfig
+	if cfg == nil {
+		cfg, err = c.GenerateCredentialChain(ctx, opt...)
+		if err != nil {
+			return nil, fmt.Errorf("error calling GenerateCredentialChain: %w", err)
+		}
+	}
+	if cfg.Credentials == nil {
+		return nil, errors.New("no credentials provider in aws config")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving credentials: %w", err)
+	}
+
+	region := c.Region
+	if region == "" {
+		region = cfg.Region
+	}
+	endpoint, err := resolveSTSEndpoint(ctx, c.STSEndpointResolver, region)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(callerIdentityRequestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if opts.withServerIdHeaderValue != "" {
+		req.Header.Set(iamServerIdHeader, opts.withServerIdHeaderValue)
+	}
+
+	payloadHash := sha256.Sum256([]byte(callerIdentityRequestBody))
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "sts", region, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("error signing request: %w", err)
+	}
+	c.log(hclog.Debug, "generated signed GetCallerIdentity request", "url", endpoint.String(), "access_key", creds.AccessKeyID)
+
+	return &SignedCallerIdentityRequest{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: req.Header,
+		Body:    []byte(callerIdentityRequestBody),
+	}, nil
+}
+
+// resolveSTSEndpoint returns the STS endpoint for the given region, using the
+// default resolver if none is given
+func resolveSTSEndpoint(ctx context.Context, resolver sts.EndpointResolverV2, region string) (*url.URL, error) {
+	if resolver == nil {
+		resolver = sts.NewDefaultEndpointResolverV2()
+	}
+	endpoint, err := resolver.ResolveEndpoint(ctx, sts.EndpointParameters{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error resolving STS endpoint: %w", err)
+	}
+	return &endpoint.URI, nil
+}
+
+// Encode returns the request in the form used by Vault's AWS IAM login: the
+// method, and the base64-encoded URL, body and JSON headers
+func (r *SignedCallerIdentityRequest) Encode() (map[string]string, error) {
+	headers, err := json.Marshal(r.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding headers: %w", err)
+	}
+	return map[string]string{
+		"iam_http_request_method": r.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(r.URL)),
+		"iam_request_body":        base64.StdEncoding.EncodeToString(r.Body),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}, nil
+}
+
+// DecodeSignedCallerIdentityRequest decodes a request encoded by Encode
+func DecodeSignedCallerIdentityRequest(data map[string]string) (*SignedCallerIdentityRequest, error) {
+	r := &SignedCallerIdentityRequest{
+		Method: data["iam_http_request_method"],
+	}
+	reqURL, err := base64.StdEncoding.DecodeString(data["iam_request_url"])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding iam_request_url: %w", err)
+	}
+	r.URL = string(reqURL)
+	if r.Body, err = base64.StdEncoding.DecodeString(data["iam_request_body"]); err != nil {
+		return nil, fmt.Errorf("error decoding iam_request_body: %w", err)
+	}
+	headers, err := base64.StdEncoding.DecodeString(data["iam_request_headers"])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding iam_request_headers: %w", err)
+	}
+	if err := json.Unmarshal(headers, &r.Headers); err != nil {
+		return nil, fmt.Errorf("error decoding iam_request_headers: %w", err)
+	}
+	return r, nil
+}
+
+// VerifySignedCallerIdentityRequest checks that the request is a well-formed
+// signed sts:GetCallerIdentity request for the expected STS endpoint and
+// server ID, then forwards it to STS and returns the caller identity it
+// reports. The request's URL is never trusted: it must match the endpoint
+// resolved for the region in the request's signature, and the request is sent
+// to that endpoint.
+//
+// Supported options: WithStsEndpointResolver, WithHttpClient,
+// WithServerIdHeaderValue
+//
+// When WithServerIdHeaderValue is set, the request must carry that value in a
+// signed X-Vault-AWS-IAM-Server-ID header. When WithStsEndpointResolver is not
+// set, the default STS endpoint for the region is used.
+func VerifySignedCallerIdentityRequest(ctx context.Context, r *SignedCallerIdentityRequest, opt ...Option) (*sts.GetCallerIdentityOutput, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in VerifySignedCallerIdentityRequest: %w", err)
+	}
+	if r == nil {
+		return nil, errors.New("nil request")
+	}
+
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("invalid request method %q", r.Method)
+	}
+	if err := validateCallerIdentityBody(r.Body); err != nil {
+		return nil, err
+	}
+
+	authz, err := parseSigV4Authorization(r.Headers.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	if authz.service != "sts" {
+		return nil, fmt.Errorf("request is signed for service %q, not sts", authz.service)
+	}
+
+	if opts.withServerIdHeaderValue != "" {
+		if got := r.Headers.Get(iamServerIdHeader); got != opts.withServerIdHeaderValue {
+			return nil, fmt.Errorf("expected %s header value %q, got %q", iamServerIdHeader, opts.withServerIdHeaderValue, got)
+		}
+		if !authz.signs(iamServerIdHeader) {
+			return nil, fmt.Errorf("%s header is not signed", iamServerIdHeader)
+		}
+	}
+
+	endpoint, err := resolveSTSEndpoint(ctx, opts.withStsEndpointResolver, authz.region)
+	if err != nil {
+		return nil, err
+	}
+	reqURL, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing request URL: %w", err)
+	}
+	if reqURL.Host != endpoint.Host || (reqURL.Path != "" && reqURL.Path != "/") || reqURL.RawQuery != "" {
+		return nil, fmt.Errorf("request URL %q does not match STS endpoint %q", r.URL, endpoint.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for k, v := range r.Headers {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	req.Host = endpoint.Host
+
+	client := opts.withHttpClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error forwarding request to STS: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCallerIdentityResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading STS response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Type    string `xml:"Type"`
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Error"`
+		}
+		if err := xml.Unmarshal(body, &errResp); err != nil || errResp.Error.Code == "" {
+			return nil, fmt.Errorf("unexpected status %d from sts.GetCallerIdentity", resp.StatusCode)
+		}
+		fault := smithy.FaultClient
+		if errResp.Error.Type == "Receiver" {
+			fault = smithy.FaultServer
+		}
+		return nil, fmt.Errorf("error calling sts.GetCallerIdentity: %w", &smithy.GenericAPIError{
+			Code:    errResp.Error.Code,
+			Message: errResp.Error.Message,
+			Fault:   fault,
+		})
+	}
+
+	var result struct {
+		Result struct {
+			Arn     string `xml:"Arn"`
+			UserId  string `xml:"UserId"`
+			Account string `xml:"Account"`
+		} `xml:"GetCallerIdentityResult"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error decoding STS response: %w", err)
+	}
+	if result.Result.Arn == "" {
+		return nil, errors.New("no caller ARN in STS response")
+	}
+	return &sts.GetCallerIdentityOutput{
+		Arn:     aws.String(result.Result.Arn),
+		UserId:  aws.String(result.Result.UserId),
+		Account: aws.String(result.Result.Account),
+	}, nil
+}
+
+// validateCallerIdentityBody checks that the body is a GetCallerIdentity call
+// with no other parameters
+func validateCallerIdentityBody(body []byte) error {
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return fmt.Errorf("error parsing request body: %w", err)
+	}
+	for k, v := range params {
+		switch {
+		case k == "Action" && len(v) == 1 && v[0] == "GetCallerIdentity":
+		case k == "Version" && len(v) == 1:
+		default:
+			return fmt.Errorf("unexpected parameter %q in request body", k)
+		}
+	}
+	if params.Get("Action") == "" {
+		return errors.New("request body is not a GetCallerIdentity call")
+	}
+	return nil
+}
+
+// sigV4Authorization is a parsed SigV4 Authorization header
+type sigV4Authorization struct {
+	accessKeyId   string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// signs returns whether the given header is included in the signature
+func (a *sigV4Authorization) signs(header string) bool {
+	header = strings.ToLower(header)
+	for _, h := range a.signedHeaders {
+		if h == header {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSigV4Authorization parses a SigV4 Authorization header
+func parseSigV4Authorization(authz string) (*sigV4Authorization, error) {
+	const algorithm = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(authz, algorithm) {
+		return nil, errors.New("missing or unsupported Authorization header")
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(authz, algorithm), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[k] = v
+	}
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[4] != "aws4_request" || fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, errors.New("malformed Authorization header")
+	}
+	return &sigV4Authorization{
+		accessKeyId:   scope[0],
+		date:          scope[1],
+		region:        scope[2],
+		service:       scope[3],
+		signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		signature:     fields["Signature"],
+	}, nil
+}
@@ -0,0 +1,201 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSignedCallerIdentityRequest(t *testing.T) {
+	require, assert := require.New(t), assert.New(t)
+	ctx := context.Background()
+
+	c, err := NewCredentialsConfig(
+		WithAccessKey("AKIAFOO"),
+		WithSecretKey("secret"),
+		WithRegion("us-west-2"),
+	)
+	require.NoError(err)
+
+	r, err := c.GenerateSignedCallerIdentityRequest(ctx, WithSharedCredentials(false), WithServerIdHeaderValue("vault.example.com"))
+	require.NoError(err)
+	assert.Equal(http.MethodPost, r.Method)
+	assert.Equal("https://sts.us-west-2.amazonaws.com", r.URL)
+	assert.Equal("Action=GetCallerIdentity&Version=2011-06-15", string(r.Body))
+	assert.Equal("vault.example.com", r.Headers.Get(iamServerIdHeader))
+
+	authz, err := parseSigV4Authorization(r.Headers.Get("Authorization"))
+	require.NoError(err)
+	assert.Equal("AKIAFOO", authz.accessKeyId)
+	assert.Equal("us-west-2", authz.region)
+	assert.Equal("sts", authz.service)
+	assert.True(authz.signs(iamServerIdHeader))
+
+	encoded, err := r.Encode()
+	require.NoError(err)
+	decoded, err := DecodeSignedCallerIdentityRequest(encoded)
+	require.NoError(err)
+	assert.Equal(r, decoded)
+
+	_, err = DecodeSignedCallerIdentityRequest(map[string]string{"iam_request_url": "%%%"})
+	require.Error(err)
+}
+
+func TestVerifySignedCallerIdentityRequest(t *testing.T) {
+	ctx := context.Background()
+	s := NewMockServer()
+	defer s.Close()
+	creds, err := s.AddUser("foouser")
+	require.NoError(t, err)
+
+	c := newMockServerConfig(t, s, creds)
+	signed, err := c.GenerateSignedCallerIdentityRequest(ctx, WithSharedCredentials(false), WithServerIdHeaderValue("vault.example.com"))
+	require.NoError(t, err)
+	verifyOpts := []Option{
+		WithStsEndpointResolver(s.STSEndpointResolver()),
+		WithServerIdHeaderValue("vault.example.com"),
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		cid, err := VerifySignedCallerIdentityRequest(ctx, signed, verifyOpts...)
+		require.NoError(err)
+		assert.Equal("arn:aws:iam::123456789012:user/foouser", *cid.Arn)
+		assert.Equal(MockServerAccountId, *cid.Account)
+
+		// Without a server ID requirement the header is not checked
+		_, err = VerifySignedCallerIdentityRequest(ctx, signed, WithStsEndpointResolver(s.STSEndpointResolver()))
+		require.NoError(err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		unsigned, err := c.GenerateSignedCallerIdentityRequest(ctx, WithSharedCredentials(false))
+		require.NoError(t, err)
+
+		cases := []struct {
+			name       string
+			modify     func(r *SignedCallerIdentityRequest)
+			opts       []Option
+			requireErr string
+		}{
+			{
+				name:       "method",
+				modify:     func(r *SignedCallerIdentityRequest) { r.Method = http.MethodGet },
+				requireErr: `invalid request method "GET"`,
+			},
+			{
+				name:       "action",
+				modify:     func(r *SignedCallerIdentityRequest) { r.Body = []byte("Action=GetUser&Version=2010-05-08") },
+				requireErr: `unexpected parameter "Action" in request body`,
+			},
+			{
+				name: "extra parameter",
+				modify: func(r *SignedCallerIdentityRequest) {
+					r.Body = []byte("Action=GetCallerIdentity&Version=2011-06-15&UserName=foo")
+				},
+				requireErr: `unexpected parameter "UserName" in request body`,
+			},
+			{
+				name:       "unsigned",
+				modify:     func(r *SignedCallerIdentityRequest) { r.Headers.Del("Authorization") },
+				requireErr: "missing or unsupported Authorization header",
+			},
+			{
+				name:       "wrong server ID",
+				modify:     func(r *SignedCallerIdentityRequest) { r.Headers.Set(iamServerIdHeader, "other.example.com") },
+				requireErr: `expected X-Vault-AWS-IAM-Server-ID header value "vault.example.com", got "other.example.com"`,
+			},
+			{
+				name:       "untrusted URL",
+				modify:     func(r *SignedCallerIdentityRequest) { r.URL = "https://sts.attacker.example.com" },
+				requireErr: `request URL "https://sts.attacker.example.com" does not match STS endpoint`,
+			},
+			{
+				name:       "query",
+				modify:     func(r *SignedCallerIdentityRequest) { r.URL += "?Action=GetUser" },
+				requireErr: "does not match STS endpoint",
+			},
+			{
+				name:       "default endpoint",
+				opts:       []Option{WithServerIdHeaderValue("vault.example.com")},
+				requireErr: "does not match STS endpoint \"https://sts.us-east-1.amazonaws.com\"",
+			},
+			{
+				name:       "tampered signature",
+				modify:     func(r *SignedCallerIdentityRequest) { r.Body = []byte("Version=2011-06-15&Action=GetCallerIdentity") },
+				requireErr: "error calling sts.GetCallerIdentity: api error SignatureDoesNotMatch",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				r := &SignedCallerIdentityRequest{
+					Method:  signed.Method,
+					URL:     signed.URL,
+					Headers: signed.Headers.Clone(),
+					Body:    signed.Body,
+				}
+				if tc.modify != nil {
+					tc.modify(r)
+				}
+				opts := tc.opts
+				if opts == nil {
+					opts = verifyOpts
+				}
+				_, err := VerifySignedCallerIdentityRequest(ctx, r, opts...)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.requireErr)
+			})
+		}
+
+		t.Run("server ID not signed", func(t *testing.T) {
+			r := &SignedCallerIdentityRequest{
+				Method:  unsigned.Method,
+				URL:     unsigned.URL,
+				Headers: unsigned.Headers.Clone(),
+				Body:    unsigned.Body,
+			}
+			r.Headers.Set(iamServerIdHeader, "vault.example.com")
+			_, err := VerifySignedCallerIdentityRequest(ctx, r, verifyOpts...)
+			require.EqualError(t, err, "X-Vault-AWS-IAM-Server-ID header is not signed")
+		})
+	})
+
+	t.Run("expired credentials", func(t *testing.T) {
+		require := require.New(t)
+		require.NoError(s.AddRole("arn:aws:iam::123456789012:role/foorole", ""))
+		client, err := c.STSClient(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		out, err := client.AssumeRole(ctx, &sts.AssumeRoleInput{
+			RoleArn:         aws.String("arn:aws:iam::123456789012:role/foorole"),
+			RoleSessionName: aws.String("session"),
+		})
+		require.NoError(err)
+
+		roleConfig := newMockServerConfig(t, s, aws.Credentials{
+			AccessKeyID:     *out.Credentials.AccessKeyId,
+			SecretAccessKey: *out.Credentials.SecretAccessKey,
+			SessionToken:    *out.Credentials.SessionToken,
+		})
+		r, err := roleConfig.GenerateSignedCallerIdentityRequest(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		cid, err := VerifySignedCallerIdentityRequest(ctx, r, WithStsEndpointResolver(s.STSEndpointResolver()))
+		require.NoError(err)
+		require.True(strings.Contains(*cid.Arn, ":assumed-role/foorole/"))
+
+		s.l.Lock()
+		s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		s.l.Unlock()
+		_, err = VerifySignedCallerIdentityRequest(ctx, r, WithStsEndpointResolver(s.STSEndpointResolver()))
+		requireAPIErrorCode(t, err, "ExpiredToken")
+	})
+}
@@ -24,6 +24,16 @@ type IAMClient interface {
 	GetUser(context.Context, *iam.GetUserInput, ...func(*iam.Options)) (*iam.GetUserOutput, error)
 }
 
+// IAMAccessKeyClient represents an iam.Client that can also report when
+// access keys were last used and change their status, as needed by
+// ListAccessKeyInfo and EnforceAccessKeyPolicy. The IAMClient returned by
+// an IAMAPIFunc must implement it for those to work.
+type IAMAccessKeyClient interface {
+	IAMClient
+	GetAccessKeyLastUsed(context.Context, *iam.GetAccessKeyLastUsedInput, ...func(*iam.Options)) (*iam.GetAccessKeyLastUsedOutput, error)
+	UpdateAccessKey(context.Context, *iam.UpdateAccessKeyInput, ...func(*iam.Options)) (*iam.UpdateAccessKeyOutput, error)
+}
+
 // STSAPIFunc is a factory function for returning a STS interface,
 // useful for supplying mock interfaces for testing STS.
 type STSAPIFunc func(awsConfig *aws.Config) (STSClient, error)
@@ -5,20 +5,190 @@ package awsutil
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
 	multierror "github.com/hashicorp/go-multierror"
 )
 
 var ErrUpstreamRateLimited = errors.New("upstream rate limited")
 
+// ErrorCategory is the broad class of an error returned by an AWS API call
+type ErrorCategory string
+
+const (
+	// ErrorCategoryUnknown is any error that is not otherwise classified
+	ErrorCategoryUnknown ErrorCategory = "unknown"
+	// ErrorCategoryThrottled means the request was rate limited
+	ErrorCategoryThrottled ErrorCategory = "throttled"
+	// ErrorCategoryAuthExpired means the credentials or the request signature
+	// have expired, or the credentials are no longer recognized
+	ErrorCategoryAuthExpired ErrorCategory = "auth_expired"
+	// ErrorCategoryAccessDenied means the credentials are not permitted to
+	// perform the request
+	ErrorCategoryAccessDenied ErrorCategory = "access_denied"
+	// ErrorCategoryNotFound means the resource operated on does not exist
+	ErrorCategoryNotFound ErrorCategory = "not_found"
+	// ErrorCategoryTransient means the request failed due to a network error
+	// or a server-side fault that may succeed on retry
+	ErrorCategoryTransient ErrorCategory = "transient"
+	// ErrorCategoryInvalidInput means the request was malformed or had invalid
+	// parameters
+	ErrorCategoryInvalidInput ErrorCategory = "invalid_input"
+)
+
+// errorCodeCategories maps AWS API error codes to their category. Throttling
+// codes are handled separately using the SDK's own list.
+var errorCodeCategories = map[string]ErrorCategory{
+	"ExpiredToken":                ErrorCategoryAuthExpired,
+	"ExpiredTokenException":       ErrorCategoryAuthExpired,
+	"RequestExpired":              ErrorCategoryAuthExpired,
+	"TokenRefreshRequired":        ErrorCategoryAuthExpired,
+	"InvalidClientTokenId":        ErrorCategoryAuthExpired,
+	"UnrecognizedClientException": ErrorCategoryAuthExpired,
+	"InvalidIdentityToken":        ErrorCategoryAuthExpired,
+
+	"AccessDenied":               ErrorCategoryAccessDenied,
+	"AccessDeniedException":      ErrorCategoryAccessDenied,
+	"UnauthorizedOperation":      ErrorCategoryAccessDenied,
+	"AuthFailure":                ErrorCategoryAccessDenied,
+	"SignatureDoesNotMatch":      ErrorCategoryAccessDenied,
+	"MissingAuthenticationToken": ErrorCategoryAccessDenied,
+	"IncompleteSignature":        ErrorCategoryAccessDenied,
+
+	"NoSuchEntity":              ErrorCategoryNotFound,
+	"NoSuchEntityException":     ErrorCategoryNotFound,
+	"NotFound":                  ErrorCategoryNotFound,
+	"ResourceNotFoundException": ErrorCategoryNotFound,
+
+	"ValidationError":             ErrorCategoryInvalidInput,
+	"ValidationException":         ErrorCategoryInvalidInput,
+	"InvalidInput":                ErrorCategoryInvalidInput,
+	"InvalidAction":               ErrorCategoryInvalidInput,
+	"InvalidParameterValue":       ErrorCategoryInvalidInput,
+	"InvalidParameterCombination": ErrorCategoryInvalidInput,
+	"MissingParameter":            ErrorCategoryInvalidInput,
+	"MalformedQueryString":        ErrorCategoryInvalidInput,
+	"MalformedPolicyDocument":     ErrorCategoryInvalidInput,
+
+	"InternalFailure":    ErrorCategoryTransient,
+	"InternalError":      ErrorCategoryTransient,
+	"ServiceFailure":     ErrorCategoryTransient,
+	"ServiceUnavailable": ErrorCategoryTransient,
+}
+
+// ClassifyAWSError returns the category of an error returned by an AWS API
+// call, or ErrorCategoryUnknown if it cannot be classified
+func ClassifyAWSError(err error) ErrorCategory {
+	if err == nil {
+		return ErrorCategoryUnknown
+	}
+
+	var awsErr *AWSError
+	if errors.As(err, &awsErr) {
+		return awsErr.Category
+	}
+
+	throttleErr := retry.ThrottleErrorCode{
+		Codes: retry.DefaultThrottleErrorCodes,
+	}
+	if throttleErr.IsErrorThrottle(err).Bool() {
+		return ErrorCategoryThrottled
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if category, ok := errorCodeCategories[apiErr.ErrorCode()]; ok {
+			return category
+		}
+	}
+
+	if (retry.RetryableConnectionError{}).IsErrorRetryable(err).Bool() {
+		return ErrorCategoryTransient
+	}
+	if (retry.RetryableErrorCode{Codes: retry.DefaultRetryableErrorCodes}).IsErrorRetryable(err).Bool() {
+		return ErrorCategoryTransient
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.HTTPStatusCode(); {
+		case code == http.StatusTooManyRequests:
+			return ErrorCategoryThrottled
+		case code == http.StatusNotFound:
+			return ErrorCategoryNotFound
+		case code >= http.StatusInternalServerError:
+			return ErrorCategoryTransient
+		}
+	}
+
+	if apiErr != nil && apiErr.ErrorFault() == smithy.FaultServer {
+		return ErrorCategoryTransient
+	}
+
+	return ErrorCategoryUnknown
+}
+
+// AWSError is an error returned by an AWS API call along with its category.
+// Throttled and transient errors are temporary, satisfying the
+// Temporary() bool interface used by the temperror package.
+type AWSError struct {
+	// Category is the category of the error
+	Category ErrorCategory
+	// Err is the underlying error
+	Err error
+}
+
+// NewAWSError classifies the given error and wraps it in an AWSError. If err
+// is nil, nil is returned; if it is already an AWSError, it is returned as-is.
+func NewAWSError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if awsErr, ok := err.(*AWSError); ok {
+		return awsErr
+	}
+	return &AWSError{
+		Category: ClassifyAWSError(err),
+		Err:      err,
+	}
+}
+
+func (e *AWSError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AWSError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary returns whether the error is throttled or transient, in which
+// case the request may succeed if retried
+func (e *AWSError) Temporary() bool {
+	return e.Category.Temporary()
+}
+
+// Temporary returns whether errors of this category may succeed if retried
+func (c ErrorCategory) Temporary() bool {
+	return c == ErrorCategoryThrottled || c == ErrorCategoryTransient
+}
+
+// IsTemporaryAWSError returns whether the given error is throttled or
+// transient
+func IsTemporaryAWSError(err error) bool {
+	return ClassifyAWSError(err).Temporary()
+}
+
+// isThrottledAWSError returns whether the given error is throttled
+func isThrottledAWSError(err error) bool {
+	return ClassifyAWSError(err) == ErrorCategoryThrottled
+}
+
 // CheckAWSError will examine an error and convert to a logical error if
 // appropriate. If no appropriate error is found, return nil
 func CheckAWSError(err error) error {
-	retryErr := retry.ThrottleErrorCode{
-		Codes: retry.DefaultThrottleErrorCodes,
-	}
-	if retryErr.IsErrorThrottle(err).Bool() {
+	if isThrottledAWSError(err) {
 		return ErrUpstreamRateLimited
 	}
 	return nil
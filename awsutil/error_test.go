@@ -4,11 +4,18 @@
 package awsutil
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"testing"
 
 	awserr "github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	multierror "github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_CheckAWSError(t *testing.T) {
@@ -93,3 +100,124 @@ func Test_AppendRateLimitedError(t *testing.T) {
 		})
 	}
 }
+
+func Test_ClassifyAWSError(t *testing.T) {
+	httpErr := func(status int) error {
+		return &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New("http error"),
+		}
+	}
+	testCases := []struct {
+		Name      string
+		Err       error
+		Expected  ErrorCategory
+		Temporary bool
+	}{
+		{
+			Name:     "Nil",
+			Expected: ErrorCategoryUnknown,
+		},
+		{
+			Name:     "Something not checked",
+			Err:      fmt.Errorf("something"),
+			Expected: ErrorCategoryUnknown,
+		},
+		{
+			Name:      "Throttling",
+			Err:       MockAWSThrottleErr(),
+			Expected:  ErrorCategoryThrottled,
+			Temporary: true,
+		},
+		{
+			Name:      "Too many requests",
+			Err:       httpErr(http.StatusTooManyRequests),
+			Expected:  ErrorCategoryThrottled,
+			Temporary: true,
+		},
+		{
+			Name:     "Expired token",
+			Err:      &MockAWSErr{Code: "ExpiredToken", Fault: awserr.FaultClient},
+			Expected: ErrorCategoryAuthExpired,
+		},
+		{
+			Name:     "Invalid client token ID",
+			Err:      &MockAWSErr{Code: "InvalidClientTokenId", Fault: awserr.FaultClient},
+			Expected: ErrorCategoryAuthExpired,
+		},
+		{
+			Name:     "Access denied",
+			Err:      fmt.Errorf("error calling iam.GetUser: %w", &MockAWSErr{Code: "AccessDenied", Fault: awserr.FaultClient}),
+			Expected: ErrorCategoryAccessDenied,
+		},
+		{
+			Name:     "No such entity",
+			Err:      &MockAWSErr{Code: "NoSuchEntity", Fault: awserr.FaultClient},
+			Expected: ErrorCategoryNotFound,
+		},
+		{
+			Name:     "Not found status",
+			Err:      httpErr(http.StatusNotFound),
+			Expected: ErrorCategoryNotFound,
+		},
+		{
+			Name:     "Validation error",
+			Err:      &MockAWSErr{Code: "ValidationError", Fault: awserr.FaultClient},
+			Expected: ErrorCategoryInvalidInput,
+		},
+		{
+			Name:      "Internal failure",
+			Err:       &MockAWSErr{Code: "InternalFailure", Fault: awserr.FaultServer},
+			Expected:  ErrorCategoryTransient,
+			Temporary: true,
+		},
+		{
+			Name:      "Unknown server fault",
+			Err:       &MockAWSErr{Code: "SomethingBroke", Fault: awserr.FaultServer},
+			Expected:  ErrorCategoryTransient,
+			Temporary: true,
+		},
+		{
+			Name:      "Service unavailable status",
+			Err:       httpErr(http.StatusServiceUnavailable),
+			Expected:  ErrorCategoryTransient,
+			Temporary: true,
+		},
+		{
+			Name:      "Dial error",
+			Err:       &url.Error{Op: "Post", URL: "https://iam.amazonaws.com", Err: &net.OpError{Op: "dial", Err: errors.New("no route to host")}},
+			Expected:  ErrorCategoryTransient,
+			Temporary: true,
+		},
+		{
+			Name:      "Connection reset",
+			Err:       errors.New("read tcp: connection reset by peer"),
+			Expected:  ErrorCategoryTransient,
+			Temporary: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, ClassifyAWSError(tc.Err))
+			assert.Equal(t, tc.Temporary, IsTemporaryAWSError(tc.Err))
+
+			err := NewAWSError(tc.Err)
+			if tc.Err == nil {
+				assert.Nil(t, err)
+				return
+			}
+			var awsErr *AWSError
+			require.ErrorAs(t, err, &awsErr)
+			assert.Equal(t, tc.Expected, awsErr.Category)
+			assert.ErrorIs(t, err, tc.Err)
+			assert.Equal(t, tc.Err.Error(), err.Error())
+			assert.Equal(t, err, NewAWSError(err))
+
+			// Satisfies the temperror contract
+			tempErr, ok := err.(interface{ Temporary() bool })
+			require.True(t, ok)
+			assert.Equal(t, tc.Temporary, tempErr.Temporary())
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -83,6 +84,15 @@ type CredentialsConfig struct {
 	// identity token provider
 	WebIdentityToken string
 
+	// Roles to assume in order once the other credentials have been
+	// resolved, each using the credentials from the one before
+	RoleChain []RoleHop
+
+	// The command to run to obtain credentials, in the format of the
+	// credential_process shared config setting. A credential_process set in
+	// the shared config profile is used without this being set.
+	CredentialProcess string
+
 	// The http.Client to use, or nil for the client to use its default
 	HTTPClient *http.Client
 
@@ -92,6 +102,10 @@ type CredentialsConfig struct {
 
 	// The logger to use for credential acquisition debugging
 	Logger hclog.Logger
+
+	// regionSource records where NewCredentialsConfig found Region, so that
+	// ResolveRegion does not mistake a defaulted region for a configured one
+	regionSource RegionSource
 }
 
 // GenerateCredentialChain uses the config to generate a credential chain
@@ -100,7 +114,7 @@ type CredentialsConfig struct {
 // Supported options: WithAccessKey, WithSecretKey, WithLogger, WithStsEndpointResolver,
 // WithIamEndpointResolver, WithMaxRetries, WithRegion, WithHttpClient, WithRoleArn,
 // WithRoleSessionName, WithRoleExternalId, WithRoleTags, WithWebIdentityTokenFile,
-// WithWebIdentityToken.
+// WithWebIdentityToken, WithRoleChain, WithCredentialProcess.
 func NewCredentialsConfig(opt ...Option) (*CredentialsConfig, error) {
 	opts, err := getOpts(opt...)
 	if err != nil {
@@ -116,15 +130,17 @@ func NewCredentialsConfig(opt ...Option) (*CredentialsConfig, error) {
 		MaxRetries:          opts.withMaxRetries,
 		RoleExternalId:      opts.withRoleExternalId,
 		RoleTags:            opts.withRoleTags,
+		RoleChain:           opts.withRoleChain,
+		CredentialProcess:   opts.withCredentialProcess,
 	}
 
-	c.Region = opts.withRegion
+	c.Region, c.regionSource = opts.withRegion, RegionSourceConfig
 	if c.Region == "" {
-		c.Region = os.Getenv("AWS_REGION")
+		c.Region, c.regionSource = os.Getenv("AWS_REGION"), RegionSourceEnv
 		if c.Region == "" {
 			c.Region = os.Getenv("AWS_DEFAULT_REGION")
 			if c.Region == "" {
-				c.Region = "us-east-1"
+				c.Region, c.regionSource = DefaultRegion, RegionSourceDefault
 			}
 		}
 	}
@@ -160,6 +176,15 @@ func NewCredentialsConfig(opt ...Option) (*CredentialsConfig, error) {
 		}
 	}
 
+	if c.CredentialProcess != "" && (c.AccessKey != "" || c.SecretKey != "") {
+		return nil, fmt.Errorf("credential process specified alongside static credentials")
+	}
+	for i, hop := range c.RoleChain {
+		if hop.RoleARN == "" {
+			return nil, fmt.Errorf("role chain hop %d has no role ARN", i+1)
+		}
+	}
+
 	c.HTTPClient = opts.withHttpClient
 	if c.HTTPClient == nil {
 		c.HTTPClient = cleanhttp.DefaultClient()
@@ -219,6 +244,12 @@ func (c *CredentialsConfig) generateAwsConfigOptions(ctx context.Context, opts o
 		c.log(hclog.Debug, "added shared profile credential provider")
 	}
 
+	// Add the credential process
+	if c.CredentialProcess != "" {
+		cfgOpts = append(cfgOpts, config.WithCredentialsProvider(processcreds.NewProvider(c.CredentialProcess)))
+		c.log(hclog.Debug, "added credential process provider")
+	}
+
 	// Add the static credential
 	if c.AccessKey != "" && c.SecretKey != "" {
 		staticCred := credentials.NewStaticCredentialsProvider(c.AccessKey, c.SecretKey, c.SessionToken)
@@ -226,45 +257,25 @@ func (c *CredentialsConfig) generateAwsConfigOptions(ctx context.Context, opts o
 		c.log(hclog.Debug, "added static credential provider", "AccessKey", c.AccessKey)
 	}
 
-	// Add the assume role provider
-	if c.RoleARN != "" {
-		if c.WebIdentityTokenFile != "" {
-			// this session is only created to create the WebIdentityRoleProvider, variables used to
-			// assume a role are pulled from values provided in options. If the option values are
-			// not set, then the provider will default to using the environment variables.
-			webIdentityRoleCred := config.WithWebIdentityRoleCredentialOptions(func(options *stscreds.WebIdentityRoleOptions) {
-				options.RoleARN = c.RoleARN
-				options.RoleSessionName = c.RoleSessionName
-				options.TokenRetriever = stscreds.IdentityTokenFile(c.WebIdentityTokenFile)
-			})
-			cfgOpts = append(cfgOpts, webIdentityRoleCred)
-			c.log(hclog.Debug, "added web identity provider", "roleARN", c.RoleARN)
-		} else if c.WebIdentityToken != "" {
-			webIdentityRoleCred := config.WithWebIdentityRoleCredentialOptions(func(options *stscreds.WebIdentityRoleOptions) {
-				options.RoleARN = c.RoleARN
-				options.RoleSessionName = c.RoleSessionName
-				options.TokenRetriever = FetchTokenContents(c.WebIdentityToken)
-			})
-			cfgOpts = append(cfgOpts, webIdentityRoleCred)
-			c.log(hclog.Debug, "added web identity provider with token", "roleARN", c.RoleARN)
-		} else {
-			// this session is only created to create the AssumeRoleProvider, variables used to
-			// assume a role are pulled from values provided in options. If the option values are
-			// not set, then the provider will default to using the environment variables.
-			assumeRoleCred := config.WithAssumeRoleCredentialOptions(func(options *stscreds.AssumeRoleOptions) {
-				options.RoleARN = c.RoleARN
-				options.RoleSessionName = c.RoleSessionName
-				options.ExternalID = aws.String(c.RoleExternalId)
-				for k, v := range c.RoleTags {
-					options.Tags = append(options.Tags, types.Tag{
-						Key:   aws.String(k),
-						Value: aws.String(v),
-					})
-				}
-			})
-			cfgOpts = append(cfgOpts, assumeRoleCred)
-			c.log(hclog.Debug, "added ec2-instance role provider", "roleARN", c.RoleARN)
-		}
+	// Add the assume role provider. With a web identity token or token file,
+	// GenerateCredentialChain builds the web identity provider instead.
+	if c.RoleARN != "" && c.WebIdentityTokenFile == "" && c.WebIdentityToken == "" {
+		// this session is only created to create the AssumeRoleProvider, variables used to
+		// assume a role are pulled from values provided in options. If the option values are
+		// not set, then the provider will default to using the environment variables.
+		assumeRoleCred := config.WithAssumeRoleCredentialOptions(func(options *stscreds.AssumeRoleOptions) {
+			options.RoleARN = c.RoleARN
+			options.RoleSessionName = c.RoleSessionName
+			options.ExternalID = aws.String(c.RoleExternalId)
+			for k, v := range c.RoleTags {
+				options.Tags = append(options.Tags, types.Tag{
+					Key:   aws.String(k),
+					Value: aws.String(v),
+				})
+			}
+		})
+		cfgOpts = append(cfgOpts, assumeRoleCred)
+		c.log(hclog.Debug, "added ec2-instance role provider", "roleARN", c.RoleARN)
 	}
 
 	return cfgOpts
@@ -275,7 +286,21 @@ func (c *CredentialsConfig) generateAwsConfigOptions(ctx context.Context, opts o
 // values from environment variables and append additional configuration options
 // provided to the CredentialsConfig.
 //
-// Supported options: WithSharedCredentials, WithCredentialsProvider
+// Supported options: WithSharedCredentials, WithCredentialsProvider,
+// WithRefreshWindow, WithAuditHook
+//
+// When a role ARN is configured together with a web identity token or token
+// file, the role is assumed with that token, and the resulting provider takes
+// precedence over static, credential process and shared profile credentials;
+// only WithCredentialsProvider overrides it.
+//
+// When a web identity token file is used, the token is re-read whenever the
+// file changes, and the role is re-assumed once its credentials are within the
+// refresh window of expiring. Failures to do so are returned as a
+// *WebIdentityRefreshError.
+//
+// When WithAuditHook is given, an event is emitted each time a web identity
+// role or a hop of the role chain is assumed.
 func (c *CredentialsConfig) GenerateCredentialChain(ctx context.Context, opt ...Option) (*aws.Config, error) {
 	opts, err := getOpts(opt...)
 	if err != nil {
@@ -292,10 +317,21 @@ func (c *CredentialsConfig) GenerateCredentialChain(ctx context.Context, opt ...
 		return nil, fmt.Errorf("%w: %w", ErrLoadConfigWithCredsFailed, err)
 	}
 
+	// The SDK only builds a web identity provider from the environment or
+	// shared config, so build it here from the config's values. It replaces
+	// any other credentials loaded above.
+	if c.RoleARN != "" && (c.WebIdentityTokenFile != "" || c.WebIdentityToken != "") {
+		awsConfig.Credentials = c.webIdentityProvider(awsConfig, opts)
+	}
+
 	if opts.withCredentialsProvider != nil {
 		awsConfig.Credentials = opts.withCredentialsProvider
 	}
 
+	if err := c.chainRoles(&awsConfig, opts); err != nil {
+		return nil, err
+	}
+
 	return &awsConfig, nil
 }
 
@@ -0,0 +1,386 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/hashicorp/go-hclog"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// AccessKeyInfo describes an IAM access key and when it was last used
+type AccessKeyInfo struct {
+	// UserName is the IAM user the key belongs to
+	UserName string `json:"user_name"`
+	// AccessKeyId is the ID of the key
+	AccessKeyId string `json:"access_key_id"`
+	// Status is whether the key is active or inactive
+	Status iamTypes.StatusType `json:"status"`
+	// CreateDate is when the key was created
+	CreateDate time.Time `json:"create_date"`
+	// Age is how long ago the key was created
+	Age time.Duration `json:"age"`
+	// LastUsedDate is when the key was last used, or the zero time if it has
+	// never been used
+	LastUsedDate time.Time `json:"last_used_date"`
+	// LastUsedService is the service the key was last used with, if any
+	LastUsedService string `json:"last_used_service,omitempty"`
+	// LastUsedRegion is the region the key was last used in, if any
+	LastUsedRegion string `json:"last_used_region,omitempty"`
+}
+
+// ListAccessKeyInfo lists the access keys of a user, along with when each was
+// created and last used. If no user is given, the keys of the user the
+// credentials belong to are listed. Keys are returned oldest first.
+//
+// Supported options: WithSharedCredentials, WithAwsConfig, WithUsername,
+// WithIAMAPIFunc
+func (c *CredentialsConfig) ListAccessKeyInfo(ctx context.Context, opt ...Option) ([]AccessKeyInfo, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in ListAccessKeyInfo: %w", err)
+	}
+
+	client, err := c.iamAccessKeyClient(ctx, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.listAccessKeyInfo(ctx, client, opts)
+}
+
+// iamAccessKeyClient returns an IAM client which supports the calls needed
+// for access key inventory and policy enforcement.
+func (c *CredentialsConfig) iamAccessKeyClient(ctx context.Context, opt ...Option) (IAMAccessKeyClient, error) {
+	client, err := c.IAMClient(ctx, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading IAM client: %w", err)
+	}
+	accessKeyClient, ok := client.(IAMAccessKeyClient)
+	if !ok {
+		return nil, fmt.Errorf("IAM client of type %T does not implement GetAccessKeyLastUsed and UpdateAccessKey", client)
+	}
+	return accessKeyClient, nil
+}
+
+func (c *CredentialsConfig) listAccessKeyInfo(ctx context.Context, client IAMAccessKeyClient, opts options) ([]AccessKeyInfo, error) {
+	now := time.Now()
+	if opts.withNowFunc != nil {
+		now = opts.withNowFunc()
+	}
+
+	listInput := iam.ListAccessKeysInput{}
+	if opts.withUsername != "" {
+		listInput.UserName = aws.String(opts.withUsername)
+	} // otherwise, the keys of the current user are listed
+
+	var keys []AccessKeyInfo
+	for {
+		listRes, err := client.ListAccessKeys(ctx, &listInput)
+		if err != nil {
+			return nil, fmt.Errorf("error calling iam.ListAccessKeys: %w", err)
+		}
+		if listRes == nil {
+			return nil, fmt.Errorf("nil response from iam.ListAccessKeys")
+		}
+
+		for _, key := range listRes.AccessKeyMetadata {
+			if key.AccessKeyId == nil {
+				return nil, fmt.Errorf("nil AccessKeyId returned from iam.ListAccessKeys")
+			}
+			info := AccessKeyInfo{
+				UserName:    aws.ToString(key.UserName),
+				AccessKeyId: *key.AccessKeyId,
+				Status:      key.Status,
+				CreateDate:  aws.ToTime(key.CreateDate),
+			}
+			if !info.CreateDate.IsZero() {
+				info.Age = now.Sub(info.CreateDate)
+			}
+
+			lastUsedRes, err := client.GetAccessKeyLastUsed(ctx, &iam.GetAccessKeyLastUsedInput{
+				AccessKeyId: key.AccessKeyId,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error calling iam.GetAccessKeyLastUsed for access key %q: %w", info.AccessKeyId, err)
+			}
+			if lastUsedRes != nil && lastUsedRes.AccessKeyLastUsed != nil {
+				// IAM reports "N/A" for the service and region of unused keys
+				if lastUsed := lastUsedRes.AccessKeyLastUsed; lastUsed.LastUsedDate != nil {
+					info.LastUsedDate = *lastUsed.LastUsedDate
+					info.LastUsedService = aws.ToString(lastUsed.ServiceName)
+					info.LastUsedRegion = aws.ToString(lastUsed.Region)
+				}
+			}
+			keys = append(keys, info)
+		}
+
+		if !listRes.IsTruncated || listRes.Marker == nil {
+			break
+		}
+		listInput.Marker = listRes.Marker
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreateDate.Before(keys[j].CreateDate)
+	})
+	return keys, nil
+}
+
+// AccessKeyPolicyAction is what EnforceAccessKeyPolicy does with keys that
+// violate the policy
+type AccessKeyPolicyAction string
+
+const (
+	// AccessKeyPolicyActionReport only reports violating keys
+	AccessKeyPolicyActionReport AccessKeyPolicyAction = "report"
+	// AccessKeyPolicyActionDeactivate deactivates violating keys
+	AccessKeyPolicyActionDeactivate AccessKeyPolicyAction = "deactivate"
+	// AccessKeyPolicyActionRotate rotates the credentials config's own key if
+	// it violates the policy and deactivates any other violating keys
+	AccessKeyPolicyActionRotate AccessKeyPolicyAction = "rotate"
+)
+
+// AccessKeyPolicy is a policy on the access keys of an IAM user
+type AccessKeyPolicy struct {
+	// MaxAge is the maximum age of an active key; zero means no limit
+	MaxAge time.Duration
+	// MaxActiveKeys is the maximum number of active keys; zero means no
+	// limit. If exceeded, the oldest active keys are in violation.
+	MaxActiveKeys int
+	// Action is what to do with violating keys; the default is to only
+	// report them
+	Action AccessKeyPolicyAction
+}
+
+// AccessKeyViolation is a way in which a key violates an AccessKeyPolicy
+type AccessKeyViolation string
+
+const (
+	// AccessKeyViolationMaxAge means the key is older than the policy's
+	// MaxAge
+	AccessKeyViolationMaxAge AccessKeyViolation = "max_age"
+	// AccessKeyViolationMaxActiveKeys means the key is one of the oldest
+	// active keys in excess of the policy's MaxActiveKeys
+	AccessKeyViolationMaxActiveKeys AccessKeyViolation = "max_active_keys"
+)
+
+// AccessKeyEnforcement is what was done with a key when enforcing an
+// AccessKeyPolicy
+type AccessKeyEnforcement string
+
+const (
+	// AccessKeyEnforcementNone means nothing was done, either because the key
+	// complies with the policy or because the policy only reports
+	AccessKeyEnforcementNone AccessKeyEnforcement = "none"
+	// AccessKeyEnforcementDeactivated means the key was deactivated
+	AccessKeyEnforcementDeactivated AccessKeyEnforcement = "deactivated"
+	// AccessKeyEnforcementRotated means the key was rotated and deleted
+	AccessKeyEnforcementRotated AccessKeyEnforcement = "rotated"
+	// AccessKeyEnforcementSkipped means the key was not deactivated because
+	// it is the credentials config's own key
+	AccessKeyEnforcementSkipped AccessKeyEnforcement = "skipped"
+	// AccessKeyEnforcementFailed means deactivating or rotating the key
+	// failed
+	AccessKeyEnforcementFailed AccessKeyEnforcement = "failed"
+)
+
+// AccessKeyEvaluation is the result of evaluating a key against an
+// AccessKeyPolicy
+type AccessKeyEvaluation struct {
+	AccessKeyInfo
+
+	// Violations are the ways in which the key violates the policy, if any
+	Violations []AccessKeyViolation `json:"violations,omitempty"`
+	// Enforcement is what was done with the key
+	Enforcement AccessKeyEnforcement `json:"enforcement"`
+	// NewAccessKeyId is the ID of the key that replaced this one, if it was
+	// rotated
+	NewAccessKeyId string `json:"new_access_key_id,omitempty"`
+	// Error is the error deactivating or rotating the key, if that failed
+	Error string `json:"error,omitempty"`
+}
+
+// AccessKeyPolicyReport is the result of EnforceAccessKeyPolicy
+type AccessKeyPolicyReport struct {
+	// EvaluatedAt is when the keys were evaluated
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	// Keys are the evaluated keys, oldest first
+	Keys []AccessKeyEvaluation `json:"keys"`
+}
+
+// Violations returns the evaluations of the keys that violate the policy
+func (r *AccessKeyPolicyReport) Violations() []AccessKeyEvaluation {
+	var ret []AccessKeyEvaluation
+	for _, key := range r.Keys {
+		if len(key.Violations) > 0 {
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
+
+// EnforceAccessKeyPolicy lists the access keys of a user as ListAccessKeyInfo
+// does and evaluates them against the given policy, then deactivates or
+// rotates violating keys according to the policy's Action. Inactive keys
+// never violate the policy.
+//
+// Only the credentials config's own key can be rotated, since there would be
+// nowhere to put the new secret of any other key; when rotating, other
+// violating keys are deactivated instead. The config's own key is never
+// deactivated, so that the config remains usable, and is reported as skipped
+// instead. Rotation is done with RotateKeys, so it fails if the user already
+// has the maximum number of access keys.
+//
+// If deactivating or rotating any key fails, the failure is recorded in the
+// report and also returned, along with the report.
+//
+// Supported options: WithSharedCredentials, WithAwsConfig, WithUsername,
+// WithIAMAPIFunc, WithSTSAPIFunc, WithValidityCheckTimeout, WithRetryAttempts,
+// WithRetryBaseDelay, WithRetryMaxDelay, WithAuditHook
+//
+// The STS, validity check and retry options only apply to rotation.
+func (c *CredentialsConfig) EnforceAccessKeyPolicy(ctx context.Context, policy AccessKeyPolicy, opt ...Option) (*AccessKeyPolicyReport, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in EnforceAccessKeyPolicy: %w", err)
+	}
+	switch policy.Action {
+	case "", AccessKeyPolicyActionReport, AccessKeyPolicyActionDeactivate, AccessKeyPolicyActionRotate:
+	default:
+		return nil, fmt.Errorf("unknown access key policy action %q", policy.Action)
+	}
+	if policy.MaxAge < 0 || policy.MaxActiveKeys < 0 {
+		return nil, fmt.Errorf("access key policy limits must not be negative")
+	}
+
+	cfg := opts.withAwsConfig
+	if cfg == nil {
+		cfg, err = c.GenerateCredentialChain(ctx, opt...)
+		if err != nil {
+			return nil, fmt.Errorf("error calling GenerateCredentialChain: %w", err)
+		}
+	}
+	opt = append(opt, WithAwsConfig(cfg))
+
+	client, err := c.iamAccessKeyClient(ctx, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.listAccessKeyInfo(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AccessKeyPolicyReport{
+		EvaluatedAt: time.Now(),
+		Keys:        evaluateAccessKeys(keys, policy),
+	}
+	if opts.withNowFunc != nil {
+		report.EvaluatedAt = opts.withNowFunc()
+	}
+
+	var retErr *multierror.Error
+	var rotate *AccessKeyEvaluation
+	for i := range report.Keys {
+		key := &report.Keys[i]
+		if len(key.Violations) == 0 {
+			continue
+		}
+		c.log(hclog.Warn, "access key violates policy", "user", key.UserName, "access_key", key.AccessKeyId, "violations", key.Violations)
+
+		switch {
+		case policy.Action == "", policy.Action == AccessKeyPolicyActionReport:
+			continue
+
+		case key.AccessKeyId == c.AccessKey && policy.Action == AccessKeyPolicyActionRotate:
+			// Rotated last, since the old key is deleted and the client
+			// still uses it
+			rotate = key
+
+		case key.AccessKeyId == c.AccessKey:
+			key.Enforcement = AccessKeyEnforcementSkipped
+
+		default:
+			updateInput := iam.UpdateAccessKeyInput{
+				AccessKeyId: aws.String(key.AccessKeyId),
+				Status:      iamTypes.StatusTypeInactive,
+			}
+			if key.UserName != "" {
+				updateInput.UserName = aws.String(key.UserName)
+			}
+			_, err := client.UpdateAccessKey(ctx, &updateInput)
+			emitAuditEvent(ctx, opts.withAuditHook, AuditEvent{
+				Operation:   AuditOperationDeactivateAccessKey,
+				UserName:    key.UserName,
+				AccessKeyId: key.AccessKeyId,
+			}, err)
+			if err != nil {
+				key.Enforcement, key.Error = AccessKeyEnforcementFailed, err.Error()
+				retErr = multierror.Append(retErr, fmt.Errorf("error calling iam.UpdateAccessKey for access key %q: %w", key.AccessKeyId, err))
+				continue
+			}
+			key.Enforcement, key.Status = AccessKeyEnforcementDeactivated, iamTypes.StatusTypeInactive
+			c.log(hclog.Info, "deactivated access key violating policy", "user", key.UserName, "access_key", key.AccessKeyId)
+		}
+	}
+
+	if rotate != nil {
+		rotateOpt := opt
+		if rotate.UserName != "" {
+			rotateOpt = append(rotateOpt, WithUsername(rotate.UserName))
+		}
+		if err := c.RotateKeys(ctx, rotateOpt...); err != nil {
+			rotate.Enforcement, rotate.Error = AccessKeyEnforcementFailed, err.Error()
+			retErr = multierror.Append(retErr, fmt.Errorf("error rotating access key %q: %w", rotate.AccessKeyId, err))
+		} else {
+			rotate.Enforcement, rotate.NewAccessKeyId = AccessKeyEnforcementRotated, c.AccessKey
+			c.log(hclog.Info, "rotated access key violating policy", "user", rotate.UserName, "access_key", rotate.AccessKeyId, "new_access_key", rotate.NewAccessKeyId)
+		}
+	}
+
+	return report, retErr.ErrorOrNil()
+}
+
+// evaluateAccessKeys evaluates keys, which must be sorted oldest first,
+// against the policy
+func evaluateAccessKeys(keys []AccessKeyInfo, policy AccessKeyPolicy) []AccessKeyEvaluation {
+	var active int
+	for _, key := range keys {
+		if key.Status == iamTypes.StatusTypeActive {
+			active++
+		}
+	}
+	excess := 0
+	if policy.MaxActiveKeys > 0 && active > policy.MaxActiveKeys {
+		excess = active - policy.MaxActiveKeys
+	}
+
+	ret := make([]AccessKeyEvaluation, 0, len(keys))
+	for _, key := range keys {
+		eval := AccessKeyEvaluation{
+			AccessKeyInfo: key,
+			Enforcement:   AccessKeyEnforcementNone,
+		}
+		if key.Status == iamTypes.StatusTypeActive {
+			if policy.MaxAge > 0 && key.Age > policy.MaxAge {
+				eval.Violations = append(eval.Violations, AccessKeyViolationMaxAge)
+			}
+			if excess > 0 {
+				eval.Violations = append(eval.Violations, AccessKeyViolationMaxActiveKeys)
+				excess--
+			}
+		}
+		ret = append(ret, eval)
+	}
+	return ret
+}
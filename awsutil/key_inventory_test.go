@@ -0,0 +1,272 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListAccessKeyInfo(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	lastUsed := now.Add(-time.Hour)
+	mockErr := errors.New("this is the expected error")
+
+	newKey := func(id string, status iamTypes.StatusType, age time.Duration) iamTypes.AccessKeyMetadata {
+		key := testKeyMetadata(id, status)
+		key.CreateDate = aws.Time(now.Add(-age))
+		return key
+	}
+	listOpt := WithListAccessKeysOutput(&iam.ListAccessKeysOutput{
+		AccessKeyMetadata: []iamTypes.AccessKeyMetadata{
+			newKey("newerkey", iamTypes.StatusTypeInactive, 24*time.Hour),
+			newKey("olderkey", iamTypes.StatusTypeActive, 48*time.Hour),
+		},
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c, err := NewCredentialsConfig(WithAccessKey("olderkey"), WithSecretKey("secret"))
+		require.NoError(err)
+		keys, err := c.ListAccessKeyInfo(ctx, withNowFunc(func() time.Time { return now }), WithIAMAPIFunc(NewMockIAM(
+			listOpt,
+			WithGetAccessKeyLastUsedOutput("olderkey", &iam.GetAccessKeyLastUsedOutput{
+				AccessKeyLastUsed: &iamTypes.AccessKeyLastUsed{
+					LastUsedDate: aws.Time(lastUsed),
+					Region:       aws.String("us-east-1"),
+					ServiceName:  aws.String("iam"),
+				},
+			}),
+			WithGetAccessKeyLastUsedOutput("newerkey", &iam.GetAccessKeyLastUsedOutput{
+				AccessKeyLastUsed: &iamTypes.AccessKeyLastUsed{
+					Region:      aws.String("N/A"),
+					ServiceName: aws.String("N/A"),
+				},
+			}),
+		)))
+		require.NoError(err)
+		assert.Equal([]AccessKeyInfo{
+			{
+				UserName:        "foouser",
+				AccessKeyId:     "olderkey",
+				Status:          iamTypes.StatusTypeActive,
+				CreateDate:      now.Add(-48 * time.Hour),
+				Age:             48 * time.Hour,
+				LastUsedDate:    lastUsed,
+				LastUsedService: "iam",
+				LastUsedRegion:  "us-east-1",
+			},
+			{
+				UserName:    "foouser",
+				AccessKeyId: "newerkey",
+				Status:      iamTypes.StatusTypeInactive,
+				CreateDate:  now.Add(-24 * time.Hour),
+				Age:         24 * time.Hour,
+			},
+		}, keys)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			iamOpts    []MockIAMOption
+			requireErr string
+		}{
+			{
+				name:       "ListAccessKeys error",
+				iamOpts:    []MockIAMOption{WithListAccessKeysError(mockErr)},
+				requireErr: "error calling iam.ListAccessKeys: this is the expected error",
+			},
+			{
+				name:       "nil response",
+				requireErr: "nil response from iam.ListAccessKeys",
+			},
+			{
+				name:       "GetAccessKeyLastUsed error",
+				iamOpts:    []MockIAMOption{listOpt, WithGetAccessKeyLastUsedError(mockErr)},
+				requireErr: `error calling iam.GetAccessKeyLastUsed for access key "newerkey": this is the expected error`,
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := new(CredentialsConfig).ListAccessKeyInfo(ctx, WithIAMAPIFunc(NewMockIAM(tc.iamOpts...)), WithAwsConfig(&aws.Config{}))
+				require.EqualError(t, err, tc.requireErr)
+			})
+		}
+	})
+
+	t.Run("client without access key calls", func(t *testing.T) {
+		// Only the methods of IAMClient are promoted, hiding the rest of
+		// MockIAM.
+		type basicIAM struct{ IAMClient }
+		apiFunc := func(*aws.Config) (IAMClient, error) {
+			return basicIAM{IAMClient: new(MockIAM)}, nil
+		}
+		_, err := new(CredentialsConfig).ListAccessKeyInfo(ctx, WithIAMAPIFunc(apiFunc), WithAwsConfig(&aws.Config{}))
+		require.EqualError(t, err, "IAM client of type awsutil.basicIAM does not implement GetAccessKeyLastUsed and UpdateAccessKey")
+		_, err = new(CredentialsConfig).EnforceAccessKeyPolicy(ctx, AccessKeyPolicy{}, WithIAMAPIFunc(apiFunc), WithAwsConfig(&aws.Config{}))
+		require.ErrorContains(t, err, "does not implement GetAccessKeyLastUsed and UpdateAccessKey")
+	})
+}
+
+func TestEnforceAccessKeyPolicy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	nowOpt := withNowFunc(func() time.Time { return now })
+	mockErr := errors.New("this is the expected error")
+	stsOpt := WithSTSAPIFunc(NewMockSTS(WithGetCallerIdentityOutput(&sts.GetCallerIdentityOutput{})))
+
+	newKey := func(id string, status iamTypes.StatusType, age time.Duration) iamTypes.AccessKeyMetadata {
+		key := testKeyMetadata(id, status)
+		key.CreateDate = aws.Time(now.Add(-age))
+		return key
+	}
+	iamOpts := []MockIAMOption{
+		WithListAccessKeysOutput(&iam.ListAccessKeysOutput{
+			AccessKeyMetadata: []iamTypes.AccessKeyMetadata{
+				newKey("ownkey", iamTypes.StatusTypeActive, 100*24*time.Hour),
+				newKey("otherkey", iamTypes.StatusTypeActive, 50*24*time.Hour),
+				newKey("inactivekey", iamTypes.StatusTypeInactive, 200*24*time.Hour),
+			},
+		}),
+		WithGetUserOutput(&iam.GetUserOutput{
+			User: &iamTypes.User{UserName: aws.String("foouser")},
+		}),
+		WithCreateAccessKeyOutput(&iam.CreateAccessKeyOutput{
+			AccessKey: &iamTypes.AccessKey{
+				AccessKeyId:     aws.String("newkey"),
+				SecretAccessKey: aws.String("newsecret"),
+				UserName:        aws.String("foouser"),
+			},
+		}),
+	}
+	maxAge := AccessKeyPolicy{MaxAge: 30 * 24 * time.Hour}
+
+	newConfig := func(t *testing.T) *CredentialsConfig {
+		t.Helper()
+		c, err := NewCredentialsConfig(WithAccessKey("ownkey"), WithSecretKey("ownsecret"))
+		require.NoError(t, err)
+		return c
+	}
+	enforcements := func(r *AccessKeyPolicyReport) map[string]AccessKeyEnforcement {
+		ret := make(map[string]AccessKeyEnforcement)
+		for _, key := range r.Keys {
+			ret[key.AccessKeyId] = key.Enforcement
+		}
+		return ret
+	}
+
+	t.Run("report", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, iamOpts...)
+		c := newConfig(t)
+
+		r, err := c.EnforceAccessKeyPolicy(ctx, AccessKeyPolicy{MaxAge: maxAge.MaxAge, MaxActiveKeys: 1}, WithIAMAPIFunc(mock.apiFunc), nowOpt)
+		require.NoError(err)
+		assert.Equal(now, r.EvaluatedAt)
+		require.Len(r.Keys, 3)
+		assert.Equal("inactivekey", r.Keys[0].AccessKeyId)
+		assert.Empty(r.Keys[0].Violations)
+		assert.Equal("ownkey", r.Keys[1].AccessKeyId)
+		assert.Equal([]AccessKeyViolation{AccessKeyViolationMaxAge, AccessKeyViolationMaxActiveKeys}, r.Keys[1].Violations)
+		assert.Equal("otherkey", r.Keys[2].AccessKeyId)
+		assert.Equal([]AccessKeyViolation{AccessKeyViolationMaxAge}, r.Keys[2].Violations)
+		assert.Len(r.Violations(), 2)
+		for _, enforcement := range enforcements(r) {
+			assert.Equal(AccessKeyEnforcementNone, enforcement)
+		}
+		assert.Empty(mock.deactivatedKeys())
+		assert.Empty(mock.deletedKeys())
+
+		_, err = json.Marshal(r)
+		require.NoError(err)
+	})
+
+	t.Run("max active keys", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c := newConfig(t)
+		r, err := c.EnforceAccessKeyPolicy(ctx, AccessKeyPolicy{MaxActiveKeys: 2}, WithIAMAPIFunc(NewMockIAM(iamOpts...)), nowOpt)
+		require.NoError(err)
+		assert.Empty(r.Violations())
+	})
+
+	t.Run("deactivate", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, iamOpts...)
+		c := newConfig(t)
+
+		maxAge.Action = AccessKeyPolicyActionDeactivate
+		r, err := c.EnforceAccessKeyPolicy(ctx, maxAge, WithIAMAPIFunc(mock.apiFunc), nowOpt)
+		require.NoError(err)
+		assert.Equal(map[string]AccessKeyEnforcement{
+			"inactivekey": AccessKeyEnforcementNone,
+			"ownkey":      AccessKeyEnforcementSkipped,
+			"otherkey":    AccessKeyEnforcementDeactivated,
+		}, enforcements(r))
+		assert.Equal(iamTypes.StatusTypeInactive, r.Keys[2].Status)
+		assert.Equal([]string{"otherkey"}, mock.deactivatedKeys())
+		assert.Equal("ownkey", c.AccessKey)
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, iamOpts...)
+		c := newConfig(t)
+
+		maxAge.Action = AccessKeyPolicyActionRotate
+		r, err := c.EnforceAccessKeyPolicy(ctx, maxAge, WithIAMAPIFunc(mock.apiFunc), stsOpt, nowOpt)
+		require.NoError(err)
+		assert.Equal(map[string]AccessKeyEnforcement{
+			"inactivekey": AccessKeyEnforcementNone,
+			"ownkey":      AccessKeyEnforcementRotated,
+			"otherkey":    AccessKeyEnforcementDeactivated,
+		}, enforcements(r))
+		assert.Equal("newkey", r.Keys[1].NewAccessKeyId)
+		assert.Equal([]string{"otherkey"}, mock.deactivatedKeys())
+		assert.Equal([]string{"ownkey"}, mock.deletedKeys())
+		assert.Equal("newkey", c.AccessKey)
+		assert.Equal("newsecret", c.SecretKey)
+	})
+
+	t.Run("enforcement errors", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c := newConfig(t)
+
+		maxAge.Action = AccessKeyPolicyActionRotate
+		r, err := c.EnforceAccessKeyPolicy(ctx, maxAge, WithIAMAPIFunc(NewMockIAM(append(iamOpts,
+			WithUpdateAccessKeyError(mockErr),
+			WithCreateAccessKeyError(mockErr),
+		)...)), stsOpt, nowOpt)
+		require.ErrorIs(err, mockErr)
+		assert.Contains(err.Error(), `error calling iam.UpdateAccessKey for access key "otherkey"`)
+		assert.Contains(err.Error(), `error rotating access key "ownkey"`)
+		require.NotNil(r)
+		assert.Equal(map[string]AccessKeyEnforcement{
+			"inactivekey": AccessKeyEnforcementNone,
+			"ownkey":      AccessKeyEnforcementFailed,
+			"otherkey":    AccessKeyEnforcementFailed,
+		}, enforcements(r))
+		assert.Contains(r.Keys[2].Error, mockErr.Error())
+		assert.Equal("ownkey", c.AccessKey)
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		c := newConfig(t)
+		_, err := c.EnforceAccessKeyPolicy(ctx, AccessKeyPolicy{Action: "delete"})
+		require.EqualError(t, err, `unknown access key policy action "delete"`)
+		_, err = c.EnforceAccessKeyPolicy(ctx, AccessKeyPolicy{MaxAge: -time.Hour})
+		require.EqualError(t, err, "access key policy limits must not be negative")
+	})
+}
@@ -0,0 +1,268 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxAccessKeysPerUser is the number of access keys IAM allows a user to have
+const maxAccessKeysPerUser = 2
+
+// ErrKeyRotationCompleted is returned when confirming or rolling back a key
+// rotation that has already been completed or rolled back
+var ErrKeyRotationCompleted = errors.New("key rotation already completed")
+
+// KeyRotation is an in-progress two-phase access key rotation started by
+// StartKeyRotation. Both the old and the new access key are valid until the
+// rotation is confirmed, either explicitly via Confirm or automatically once
+// the grace period has passed, at which point the old key is deleted.
+type KeyRotation struct {
+	// UserName is the IAM user whose keys are being rotated
+	UserName string
+	// OldAccessKeyId is the access key being replaced
+	OldAccessKeyId string
+	// NewAccessKeyId is the access key that replaces it
+	NewAccessKeyId string
+	// DeletedStaleKeyIds are the inactive access keys that were deleted to
+	// make room for the new key
+	DeletedStaleKeyIds []string
+	// CreatedAt is when the new key was created
+	CreatedAt time.Time
+	// DeleteAfter is when the old key will be deleted automatically, or the
+	// zero time if it will only be deleted by Confirm
+	DeleteAfter time.Time
+
+	c            *CredentialsConfig
+	opts         []Option
+	oldSecretKey string
+
+	l      sync.Mutex
+	timer  *time.Timer
+	done   bool
+	err    error
+	doneCh chan struct{}
+}
+
+// StartKeyRotation begins a two-phase rotation of the access key in this
+// credentials config. It creates a new access key and verifies it can be used,
+// then writes the new access key/secret key into the credentials config. The
+// old key is not deleted until the returned rotation is confirmed, allowing
+// other processes using the old key to switch over.
+//
+// IAM allows at most two access keys per user. If the user is at that limit,
+// any inactive keys other than the one being rotated are deleted first; if
+// both keys are active, an error is returned.
+//
+// Supported options: WithSharedCredentials, WithAwsConfig, WithUsername,
+// WithValidityCheckTimeout, WithIAMAPIFunc, WithSTSAPIFunc, WithGracePeriod,
+// WithAuditHook
+//
+// When WithGracePeriod is non-zero, the old key is deleted automatically once
+// the grace period has passed unless the rotation is confirmed or rolled back
+// first.
+func (c *CredentialsConfig) StartKeyRotation(ctx context.Context, opt ...Option) (*KeyRotation, error) {
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return nil, errors.New("cannot rotate credentials when either access_key or secret_key is empty")
+	}
+
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading options in StartKeyRotation: %w", err)
+	}
+
+	cfg := opts.withAwsConfig
+	if cfg == nil {
+		cfg, err = c.GenerateCredentialChain(ctx, opt...)
+		if err != nil {
+			return nil, fmt.Errorf("error calling GenerateCredentialChain: %w", err)
+		}
+	}
+	opt = append(opt, WithAwsConfig(cfg))
+
+	client, err := c.IAMClient(ctx, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading IAM client: %w", err)
+	}
+
+	userName := opts.withUsername
+	if userName == "" {
+		getUserRes, err := client.GetUser(ctx, &iam.GetUserInput{})
+		if err != nil {
+			return nil, fmt.Errorf("error calling iam.GetUser: %w", err)
+		}
+		if getUserRes == nil || getUserRes.User == nil || getUserRes.User.UserName == nil {
+			return nil, fmt.Errorf("nil user returned from iam.GetUser")
+		}
+		userName = *getUserRes.User.UserName
+	}
+	opt = append(opt, WithUsername(userName))
+
+	deleted, err := c.deleteStaleAccessKeys(ctx, client, userName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	createAccessKeyRes, err := c.CreateAccessKey(ctx, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error calling CreateAccessKey: %w", err)
+	}
+
+	r := &KeyRotation{
+		UserName:           userName,
+		OldAccessKeyId:     c.AccessKey,
+		NewAccessKeyId:     *createAccessKeyRes.AccessKey.AccessKeyId,
+		DeletedStaleKeyIds: deleted,
+		CreatedAt:          time.Now(),
+		c:                  c,
+		opts:               opt,
+		oldSecretKey:       c.SecretKey,
+		doneCh:             make(chan struct{}),
+	}
+	if createAccessKeyRes.AccessKey.CreateDate != nil {
+		r.CreatedAt = *createAccessKeyRes.AccessKey.CreateDate
+	}
+
+	c.AccessKey = *createAccessKeyRes.AccessKey.AccessKeyId
+	c.SecretKey = *createAccessKeyRes.AccessKey.SecretAccessKey
+	c.log(hclog.Info, "started access key rotation", "user", userName, "old_access_key", r.OldAccessKeyId, "new_access_key", r.NewAccessKeyId)
+
+	if opts.withGracePeriod > 0 {
+		r.DeleteAfter = time.Now().Add(opts.withGracePeriod)
+		r.l.Lock()
+		r.timer = time.AfterFunc(opts.withGracePeriod, func() {
+			if err := r.Confirm(context.Background()); err != nil && !errors.Is(err, ErrKeyRotationCompleted) {
+				c.log(hclog.Error, "error deleting old access key after grace period", "user", userName, "access_key", r.OldAccessKeyId, "error", err)
+			}
+		})
+		r.l.Unlock()
+	}
+
+	return r, nil
+}
+
+// deleteStaleAccessKeys deletes inactive access keys other than the current
+// one if the user is at the IAM access key limit, returning the IDs of the
+// deleted keys
+func (c *CredentialsConfig) deleteStaleAccessKeys(ctx context.Context, client IAMClient, userName string, opts options) ([]string, error) {
+	listRes, err := client.ListAccessKeys(ctx, &iam.ListAccessKeysInput{
+		UserName: aws.String(userName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling iam.ListAccessKeys: %w", err)
+	}
+	if listRes == nil || len(listRes.AccessKeyMetadata) < maxAccessKeysPerUser {
+		return nil, nil
+	}
+
+	var deleted []string
+	for _, key := range listRes.AccessKeyMetadata {
+		if key.AccessKeyId == nil || *key.AccessKeyId == c.AccessKey || key.Status != iamTypes.StatusTypeInactive {
+			continue
+		}
+		_, err := client.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+			AccessKeyId: key.AccessKeyId,
+			UserName:    aws.String(userName),
+		})
+		emitAuditEvent(ctx, opts.withAuditHook, AuditEvent{
+			Operation:   AuditOperationDeleteAccessKey,
+			UserName:    userName,
+			AccessKeyId: *key.AccessKeyId,
+		}, err)
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting stale access key %q: %w", *key.AccessKeyId, err)
+		}
+		c.log(hclog.Info, "deleted stale inactive access key", "user", userName, "access_key", *key.AccessKeyId)
+		deleted = append(deleted, *key.AccessKeyId)
+	}
+
+	if len(listRes.AccessKeyMetadata)-len(deleted) >= maxAccessKeysPerUser {
+		return deleted, fmt.Errorf("user %q already has the maximum of %d access keys and none are stale", userName, maxAccessKeysPerUser)
+	}
+	return deleted, nil
+}
+
+// Confirm completes the rotation by deleting the old access key. It returns
+// ErrKeyRotationCompleted if the rotation has already been confirmed or rolled
+// back. If deletion fails, the rotation remains in progress and Confirm may be
+// called again.
+func (r *KeyRotation) Confirm(ctx context.Context) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.done {
+		return ErrKeyRotationCompleted
+	}
+
+	if err := r.c.DeleteAccessKey(ctx, r.OldAccessKeyId, r.opts...); err != nil {
+		r.err = err
+		return err
+	}
+	r.c.log(hclog.Info, "completed access key rotation", "user", r.UserName, "old_access_key", r.OldAccessKeyId, "new_access_key", r.NewAccessKeyId)
+	r.finish()
+	return nil
+}
+
+// Rollback abandons the rotation by deleting the new access key and restoring
+// the old access key/secret key into the credentials config. It returns
+// ErrKeyRotationCompleted if the rotation has already been confirmed or rolled
+// back.
+func (r *KeyRotation) Rollback(ctx context.Context) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.done {
+		return ErrKeyRotationCompleted
+	}
+
+	if err := r.c.DeleteAccessKey(ctx, r.NewAccessKeyId, r.opts...); err != nil {
+		r.err = err
+		return err
+	}
+	r.c.AccessKey = r.OldAccessKeyId
+	r.c.SecretKey = r.oldSecretKey
+	r.c.log(hclog.Info, "rolled back access key rotation", "user", r.UserName, "old_access_key", r.OldAccessKeyId, "new_access_key", r.NewAccessKeyId)
+	r.finish()
+	return nil
+}
+
+// finish marks the rotation as done; it must be called with the lock held
+func (r *KeyRotation) finish() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.done = true
+	r.err = nil
+	r.oldSecretKey = ""
+	close(r.doneCh)
+}
+
+// Done returns a channel that is closed once the rotation has been confirmed
+// or rolled back
+func (r *KeyRotation) Done() <-chan struct{} {
+	return r.doneCh
+}
+
+// Completed returns whether the rotation has been confirmed or rolled back
+func (r *KeyRotation) Completed() bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.done
+}
+
+// Err returns the error from the most recent attempt to confirm or roll back
+// the rotation, including an automatic confirmation after the grace period,
+// or nil if it succeeded or none has been made
+func (r *KeyRotation) Err() error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.err
+}
@@ -0,0 +1,246 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingIAM is a MockIAM that records the access keys deleted and
+// deactivated through it, shared across every client returned by its
+// IAMAPIFunc
+type recordingIAM struct {
+	*MockIAM
+
+	l           sync.Mutex
+	deleted     []string
+	deactivated []string
+}
+
+func newRecordingIAM(t *testing.T, opts ...MockIAMOption) *recordingIAM {
+	t.Helper()
+	client, err := NewMockIAM(opts...)(nil)
+	require.NoError(t, err)
+	return &recordingIAM{MockIAM: client.(*MockIAM)}
+}
+
+func (m *recordingIAM) apiFunc(*aws.Config) (IAMClient, error) {
+	return m, nil
+}
+
+func (m *recordingIAM) DeleteAccessKey(ctx context.Context, input *iam.DeleteAccessKeyInput, opt ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+	out, err := m.MockIAM.DeleteAccessKey(ctx, input, opt...)
+	if err == nil {
+		m.l.Lock()
+		m.deleted = append(m.deleted, *input.AccessKeyId)
+		m.l.Unlock()
+	}
+	return out, err
+}
+
+func (m *recordingIAM) deletedKeys() []string {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]string(nil), m.deleted...)
+}
+
+func (m *recordingIAM) UpdateAccessKey(ctx context.Context, input *iam.UpdateAccessKeyInput, opt ...func(*iam.Options)) (*iam.UpdateAccessKeyOutput, error) {
+	out, err := m.MockIAM.UpdateAccessKey(ctx, input, opt...)
+	if err == nil && input.Status == iamTypes.StatusTypeInactive {
+		m.l.Lock()
+		m.deactivated = append(m.deactivated, *input.AccessKeyId)
+		m.l.Unlock()
+	}
+	return out, err
+}
+
+func (m *recordingIAM) deactivatedKeys() []string {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]string(nil), m.deactivated...)
+}
+
+func testKeyMetadata(id string, status iamTypes.StatusType) iamTypes.AccessKeyMetadata {
+	return iamTypes.AccessKeyMetadata{
+		AccessKeyId: aws.String(id),
+		Status:      status,
+		UserName:    aws.String("foouser"),
+	}
+}
+
+func TestStartKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	mockErr := errors.New("this is the expected error")
+	baseIAMOpts := []MockIAMOption{
+		WithGetUserOutput(&iam.GetUserOutput{
+			User: &iamTypes.User{UserName: aws.String("foouser")},
+		}),
+		WithCreateAccessKeyOutput(&iam.CreateAccessKeyOutput{
+			AccessKey: &iamTypes.AccessKey{
+				AccessKeyId:     aws.String("newkey"),
+				SecretAccessKey: aws.String("newsecret"),
+				UserName:        aws.String("foouser"),
+			},
+		}),
+	}
+	stsOpt := WithSTSAPIFunc(NewMockSTS(WithGetCallerIdentityOutput(&sts.GetCallerIdentityOutput{})))
+
+	newConfig := func(t *testing.T) *CredentialsConfig {
+		t.Helper()
+		c, err := NewCredentialsConfig(WithAccessKey("oldkey"), WithSecretKey("oldsecret"))
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			iamOpts    []MockIAMOption
+			requireErr string
+		}{
+			{
+				name:       "GetUser error",
+				iamOpts:    []MockIAMOption{WithGetUserError(mockErr)},
+				requireErr: "error calling iam.GetUser: this is the expected error",
+			},
+			{
+				name:       "ListAccessKeys error",
+				iamOpts:    append(baseIAMOpts, WithListAccessKeysError(mockErr)),
+				requireErr: "error calling iam.ListAccessKeys: this is the expected error",
+			},
+			{
+				name: "two active keys",
+				iamOpts: append(baseIAMOpts, WithListAccessKeysOutput(&iam.ListAccessKeysOutput{
+					AccessKeyMetadata: []iamTypes.AccessKeyMetadata{
+						testKeyMetadata("oldkey", iamTypes.StatusTypeActive),
+						testKeyMetadata("otherkey", iamTypes.StatusTypeActive),
+					},
+				})),
+				requireErr: `user "foouser" already has the maximum of 2 access keys and none are stale`,
+			},
+			{
+				name:       "CreateAccessKey error",
+				iamOpts:    append(baseIAMOpts, WithCreateAccessKeyError(mockErr)),
+				requireErr: "error calling CreateAccessKey: error calling iam.CreateAccessKey: this is the expected error",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				require, assert := require.New(t), assert.New(t)
+				c := newConfig(t)
+				_, err := c.StartKeyRotation(ctx, WithIAMAPIFunc(NewMockIAM(tc.iamOpts...)), stsOpt)
+				require.EqualError(err, tc.requireErr)
+				assert.Equal("oldkey", c.AccessKey)
+				assert.Equal("oldsecret", c.SecretKey)
+			})
+		}
+
+		_, err := new(CredentialsConfig).StartKeyRotation(ctx)
+		require.Error(t, err)
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, append(baseIAMOpts, WithListAccessKeysOutput(&iam.ListAccessKeysOutput{
+			AccessKeyMetadata: []iamTypes.AccessKeyMetadata{
+				testKeyMetadata("oldkey", iamTypes.StatusTypeActive),
+				testKeyMetadata("stalekey", iamTypes.StatusTypeInactive),
+			},
+		}))...)
+		c := newConfig(t)
+
+		r, err := c.StartKeyRotation(ctx, WithIAMAPIFunc(mock.apiFunc), stsOpt, WithValidityCheckTimeout(time.Second))
+		require.NoError(err)
+		assert.Equal("foouser", r.UserName)
+		assert.Equal("oldkey", r.OldAccessKeyId)
+		assert.Equal("newkey", r.NewAccessKeyId)
+		assert.Equal([]string{"stalekey"}, r.DeletedStaleKeyIds)
+		assert.True(r.DeleteAfter.IsZero())
+		assert.False(r.Completed())
+
+		// The config switches to the new key immediately, but the old one is
+		// kept until confirmation
+		assert.Equal("newkey", c.AccessKey)
+		assert.Equal("newsecret", c.SecretKey)
+		assert.Equal([]string{"stalekey"}, mock.deletedKeys())
+
+		require.NoError(r.Confirm(ctx))
+		assert.True(r.Completed())
+		assert.NoError(r.Err())
+		assert.Equal([]string{"stalekey", "oldkey"}, mock.deletedKeys())
+		select {
+		case <-r.Done():
+		default:
+			t.Fatal("rotation not marked done")
+		}
+
+		assert.ErrorIs(r.Confirm(ctx), ErrKeyRotationCompleted)
+		assert.ErrorIs(r.Rollback(ctx), ErrKeyRotationCompleted)
+	})
+
+	t.Run("confirm-error", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, baseIAMOpts...)
+		c := newConfig(t)
+
+		r, err := c.StartKeyRotation(ctx, WithIAMAPIFunc(mock.apiFunc), stsOpt)
+		require.NoError(err)
+
+		mock.DeleteAccessKeyError = mockErr
+		require.ErrorIs(r.Confirm(ctx), mockErr)
+		assert.ErrorIs(r.Err(), mockErr)
+		assert.False(r.Completed())
+
+		// It can be retried
+		mock.DeleteAccessKeyError = nil
+		require.NoError(r.Confirm(ctx))
+		assert.NoError(r.Err())
+		assert.Equal([]string{"oldkey"}, mock.deletedKeys())
+	})
+
+	t.Run("grace-period", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, baseIAMOpts...)
+		c := newConfig(t)
+
+		start := time.Now()
+		r, err := c.StartKeyRotation(ctx, WithIAMAPIFunc(mock.apiFunc), stsOpt, WithGracePeriod(50*time.Millisecond))
+		require.NoError(err)
+		assert.WithinDuration(start.Add(50*time.Millisecond), r.DeleteAfter, time.Second)
+		assert.Empty(mock.deletedKeys())
+
+		select {
+		case <-r.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("old key not deleted after grace period")
+		}
+		assert.Equal([]string{"oldkey"}, mock.deletedKeys())
+		assert.ErrorIs(r.Confirm(ctx), ErrKeyRotationCompleted)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		mock := newRecordingIAM(t, baseIAMOpts...)
+		c := newConfig(t)
+
+		r, err := c.StartKeyRotation(ctx, WithIAMAPIFunc(mock.apiFunc), stsOpt, WithGracePeriod(time.Hour), WithUsername("foouser"))
+		require.NoError(err)
+		require.NoError(r.Rollback(ctx))
+		assert.True(r.Completed())
+		assert.Equal("oldkey", c.AccessKey)
+		assert.Equal("oldsecret", c.SecretKey)
+		assert.Equal([]string{"newkey"}, mock.deletedKeys())
+	})
+}
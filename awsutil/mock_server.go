@@ -0,0 +1,828 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+)
+
+const (
+	// MockServerAccountId is the AWS account ID of all principals in a
+	// MockServer
+	MockServerAccountId = "123456789012"
+
+	mockIAMNamespace = "https://iam.amazonaws.com/doc/2010-05-08/"
+	mockSTSNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+	mockSignatureMaxSkew  = 15 * time.Minute
+	mockDefaultSessionTTL = time.Hour
+)
+
+// mockServerActions maps each supported action to the service that handles
+// it
+var mockServerActions = map[string]string{
+	"CreateAccessKey":           "iam",
+	"DeleteAccessKey":           "iam",
+	"ListAccessKeys":            "iam",
+	"GetUser":                   "iam",
+	"GetCallerIdentity":         "sts",
+	"AssumeRole":                "sts",
+	"AssumeRoleWithWebIdentity": "sts",
+}
+
+// MockServer is an httptest-based stand-in for the IAM and STS query APIs. It
+// implements CreateAccessKey, DeleteAccessKey, ListAccessKeys, GetUser,
+// GetCallerIdentity, AssumeRole and AssumeRoleWithWebIdentity, and validates
+// the SigV4 signature of every request other than AssumeRoleWithWebIdentity
+// against the access keys it has issued. Unlike MockIAM and MockSTS it
+// exercises the SDK's real request signing, serialization, endpoint
+// resolution and retries.
+//
+// Clients are pointed at the server via WithIamEndpointResolver and
+// WithStsEndpointResolver, using the resolvers returned by
+// IAMEndpointResolver and STSEndpointResolver.
+type MockServer struct {
+	server *httptest.Server
+	now    func() time.Time
+
+	l               sync.Mutex
+	users           map[string]*mockUser
+	keys            map[string]*mockKey
+	roles           map[string]*mockRole
+	faults          map[string][]*mockFault
+	webIdentities   map[string]bool
+	assumeRoleCalls []MockAssumeRoleCall
+}
+
+type mockUser struct {
+	name    string
+	id      string
+	created time.Time
+}
+
+func (u *mockUser) arn() string {
+	return fmt.Sprintf("arn:aws:iam::%s:user/%s", MockServerAccountId, u.name)
+}
+
+// mockKey is an access key belonging either to a user or, for temporary
+// credentials, to an assumed role session
+type mockKey struct {
+	id           string
+	secret       string
+	sessionToken string
+	status       iamTypes.StatusType
+	created      time.Time
+	user         *mockUser
+
+	assumedRoleArn string
+	assumedRoleId  string
+	expires        time.Time
+}
+
+func (k *mockKey) principalArn() string {
+	if k.user != nil {
+		return k.user.arn()
+	}
+	return k.assumedRoleArn
+}
+
+type mockRole struct {
+	arn        string
+	id         string
+	externalId string
+}
+
+type mockFault struct {
+	status int
+	err    *MockAWSErr
+	count  int
+}
+
+// MockAssumeRoleCall records a successful AssumeRole or
+// AssumeRoleWithWebIdentity call made to a MockServer
+type MockAssumeRoleCall struct {
+	// CallerArn is the ARN of the principal that made the call, or empty for
+	// AssumeRoleWithWebIdentity
+	CallerArn string
+	// RoleArn is the role that was assumed
+	RoleArn string
+	// RoleSessionName is the session name passed in the call
+	RoleSessionName string
+	// ExternalId is the external ID passed in the call
+	ExternalId string
+	// Tags are the session tags passed in the call
+	Tags map[string]string
+	// WebIdentityToken is the token passed to AssumeRoleWithWebIdentity; it
+	// is empty for AssumeRole calls
+	WebIdentityToken string
+	// AccessKeyId is the access key of the returned temporary credentials
+	AccessKeyId string
+}
+
+// NewMockServer starts a MockServer. It must be closed with Close when no
+// longer needed.
+func NewMockServer() *MockServer {
+	s := &MockServer{
+		now:           time.Now,
+		users:         make(map[string]*mockUser),
+		keys:          make(map[string]*mockKey),
+		roles:         make(map[string]*mockRole),
+		faults:        make(map[string][]*mockFault),
+		webIdentities: make(map[string]bool),
+	}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the base URL of the server
+func (s *MockServer) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server
+func (s *MockServer) Close() {
+	s.server.Close()
+}
+
+// IAMEndpointResolver returns an endpoint resolver that directs IAM requests
+// to the server
+func (s *MockServer) IAMEndpointResolver() iam.EndpointResolverV2 {
+	return &mockEndpointResolver{url: s.server.URL}
+}
+
+// STSEndpointResolver returns an endpoint resolver that directs STS requests
+// to the server
+func (s *MockServer) STSEndpointResolver() sts.EndpointResolverV2 {
+	return mockSTSEndpointResolver{&mockEndpointResolver{url: s.server.URL}}
+}
+
+type mockEndpointResolver struct {
+	url string
+}
+
+func (r *mockEndpointResolver) ResolveEndpoint(ctx context.Context, _ iam.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	return r.resolve()
+}
+
+func (r *mockEndpointResolver) resolve() (smithyendpoints.Endpoint, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return smithyendpoints.Endpoint{}, err
+	}
+	return smithyendpoints.Endpoint{URI: *u}, nil
+}
+
+// mockSTSEndpointResolver adapts a mockEndpointResolver to the STS resolver
+// interface, whose parameters are a distinct type
+type mockSTSEndpointResolver struct {
+	*mockEndpointResolver
+}
+
+var (
+	_ iam.EndpointResolverV2 = (*mockEndpointResolver)(nil)
+	_ sts.EndpointResolverV2 = mockSTSEndpointResolver{}
+)
+
+func (r mockSTSEndpointResolver) ResolveEndpoint(ctx context.Context, _ sts.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	return r.resolve()
+}
+
+// AddUser creates an IAM user with a single active access key and returns
+// that key's credentials
+func (s *MockServer) AddUser(name string) (aws.Credentials, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if name == "" {
+		return aws.Credentials{}, errors.New("empty user name")
+	}
+	if _, ok := s.users[name]; ok {
+		return aws.Credentials{}, fmt.Errorf("user %q already exists", name)
+	}
+	user := &mockUser{
+		name:    name,
+		id:      "AIDA" + mockRandomId(16),
+		created: s.now().UTC(),
+	}
+	s.users[name] = user
+	key := s.newUserKey(user)
+	return aws.Credentials{
+		AccessKeyID:     key.id,
+		SecretAccessKey: key.secret,
+	}, nil
+}
+
+// AddRole creates a role that can be assumed by any principal. If externalId
+// is non-empty, it must be provided when assuming the role.
+func (s *MockServer) AddRole(roleArn, externalId string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if _, name, ok := strings.Cut(roleArn, ":role/"); !ok || name == "" {
+		return fmt.Errorf("invalid role ARN %q", roleArn)
+	}
+	s.roles[roleArn] = &mockRole{
+		arn:        roleArn,
+		id:         "AROA" + mockRandomId(16),
+		externalId: externalId,
+	}
+	return nil
+}
+
+// AddWebIdentityToken allows the given token to be exchanged for any role via
+// AssumeRoleWithWebIdentity
+func (s *MockServer) AddWebIdentityToken(token string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.webIdentities[token] = true
+}
+
+// AccessKeys returns the metadata of the access keys of the given user, in
+// order of creation
+func (s *MockServer) AccessKeys(userName string) []iamTypes.AccessKeyMetadata {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.userKeys(userName)
+}
+
+// SetAccessKeyStatus sets the status of an access key. Inactive keys are
+// rejected when used to sign requests.
+func (s *MockServer) SetAccessKeyStatus(accessKeyId string, status iamTypes.StatusType) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	key, ok := s.keys[accessKeyId]
+	if !ok || key.user == nil {
+		return fmt.Errorf("access key %q not found", accessKeyId)
+	}
+	key.status = status
+	return nil
+}
+
+// FailNext causes the next count requests for the given action to fail with
+// the given HTTP status and error, after their signatures have been validated
+func (s *MockServer) FailNext(action string, count int, status int, err *MockAWSErr) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.faults[action] = append(s.faults[action], &mockFault{
+		status: status,
+		err:    err,
+		count:  count,
+	})
+}
+
+// AssumeRoleCalls returns the successful AssumeRole and
+// AssumeRoleWithWebIdentity calls made to the server, in order
+func (s *MockServer) AssumeRoleCalls() []MockAssumeRoleCall {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]MockAssumeRoleCall(nil), s.assumeRoleCalls...)
+}
+
+// newUserKey creates an active access key for the user; it must be called
+// with the lock held
+func (s *MockServer) newUserKey(user *mockUser) *mockKey {
+	key := &mockKey{
+		id:      "AKIA" + mockRandomId(16),
+		secret:  mockRandomId(40),
+		status:  iamTypes.StatusTypeActive,
+		created: s.now().UTC(),
+		user:    user,
+	}
+	s.keys[key.id] = key
+	return key
+}
+
+// userKeys returns the metadata of the user's access keys; it must be called
+// with the lock held
+func (s *MockServer) userKeys(userName string) []iamTypes.AccessKeyMetadata {
+	var keys []*mockKey
+	for _, key := range s.keys {
+		if key.user != nil && key.user.name == userName {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].created.Equal(keys[j].created) {
+			return keys[i].id < keys[j].id
+		}
+		return keys[i].created.Before(keys[j].created)
+	})
+
+	ret := make([]iamTypes.AccessKeyMetadata, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, iamTypes.AccessKeyMetadata{
+			AccessKeyId: aws.String(key.id),
+			CreateDate:  aws.Time(key.created),
+			Status:      key.status,
+			UserName:    aws.String(userName),
+		})
+	}
+	return ret
+}
+
+// ServeHTTP implements http.Handler
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, "", http.StatusBadRequest, "MalformedQueryString", err.Error())
+		return
+	}
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		s.writeError(w, "", http.StatusBadRequest, "MalformedQueryString", err.Error())
+		return
+	}
+	for k, v := range r.URL.Query() {
+		params[k] = append(params[k], v...)
+	}
+
+	action := params.Get("Action")
+	service, ok := mockServerActions[action]
+	if !ok {
+		s.writeError(w, "", http.StatusBadRequest, "InvalidAction", fmt.Sprintf("Could not find operation %s", action))
+		return
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var caller *mockKey
+	var status int
+	var code, msg string
+	if action != "AssumeRoleWithWebIdentity" {
+		caller, status, code, msg = s.authenticate(r, body, service)
+		if code != "" {
+			s.writeError(w, service, status, code, msg)
+			return
+		}
+	}
+
+	if faults := s.faults[action]; len(faults) > 0 {
+		fault := faults[0]
+		fault.count--
+		if fault.count <= 0 {
+			s.faults[action] = faults[1:]
+		}
+		s.writeError(w, service, fault.status, fault.err.Code, fault.err.Message)
+		return
+	}
+
+	var result interface{}
+	switch action {
+	case "CreateAccessKey":
+		result, status, code, msg = s.createAccessKey(caller, params)
+	case "DeleteAccessKey":
+		result, status, code, msg = s.deleteAccessKey(caller, params)
+	case "ListAccessKeys":
+		result, status, code, msg = s.listAccessKeys(caller, params)
+	case "GetUser":
+		result, status, code, msg = s.getUser(caller, params)
+	case "GetCallerIdentity":
+		result = s.getCallerIdentity(caller)
+	case "AssumeRole":
+		result, status, code, msg = s.assumeRole(caller, params)
+	case "AssumeRoleWithWebIdentity":
+		result, status, code, msg = s.assumeRoleWithWebIdentity(params)
+	}
+	if code != "" {
+		s.writeError(w, service, status, code, msg)
+		return
+	}
+	s.writeResponse(w, service, action, result)
+}
+
+// authenticate validates the request's SigV4 signature and returns the key
+// that signed it. On failure it returns an HTTP status, error code and
+// message.
+func (s *MockServer) authenticate(r *http.Request, body []byte, service string) (*mockKey, int, string, string) {
+	authz := r.Header.Get("Authorization")
+	if authz == "" {
+		return nil, http.StatusForbidden, "MissingAuthenticationToken", "Request is missing Authentication Token"
+	}
+	parsed, err := parseSigV4Authorization(authz)
+	if err != nil {
+		return nil, http.StatusBadRequest, "IncompleteSignature", err.Error()
+	}
+
+	key, ok := s.keys[parsed.accessKeyId]
+	if !ok || key.status != iamTypes.StatusTypeActive {
+		return nil, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid."
+	}
+	if !key.expires.IsZero() && !s.now().Before(key.expires) {
+		return nil, http.StatusBadRequest, "ExpiredToken", "The security token included in the request is expired"
+	}
+	if parsed.service != service {
+		return nil, http.StatusForbidden, "SignatureDoesNotMatch", fmt.Sprintf("Credential should be scoped to correct service: '%s'.", service)
+	}
+
+	signingTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, http.StatusBadRequest, "IncompleteSignature", "X-Amz-Date header is missing or malformed"
+	}
+	if skew := s.now().Sub(signingTime); skew > mockSignatureMaxSkew || skew < -mockSignatureMaxSkew {
+		return nil, http.StatusForbidden, "SignatureDoesNotMatch", "Signature expired"
+	}
+
+	// Re-sign a copy of the request containing only the signed headers and
+	// compare the result
+	req, err := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, http.StatusBadRequest, "IncompleteSignature", err.Error()
+	}
+	req.Host = r.Host
+	req.ContentLength = int64(len(body))
+	for _, h := range parsed.signedHeaders {
+		switch h {
+		case "host", "content-length":
+			continue
+		}
+		for _, v := range r.Header.Values(h) {
+			req.Header.Add(h, v)
+		}
+	}
+	payloadHash := sha256.Sum256(body)
+	creds := aws.Credentials{
+		AccessKeyID:     key.id,
+		SecretAccessKey: key.secret,
+		SessionToken:    key.sessionToken,
+	}
+	if err := v4.NewSigner().SignHTTP(r.Context(), creds, req, hex.EncodeToString(payloadHash[:]), service, parsed.region, signingTime); err != nil {
+		return nil, http.StatusBadRequest, "IncompleteSignature", err.Error()
+	}
+	_, expected, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+	if !hmac.Equal([]byte(expected), []byte(parsed.signature)) {
+		return nil, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+
+	return key, 0, "", ""
+}
+
+// targetUser returns the user named in the request, defaulting to the calling
+// user
+func (s *MockServer) targetUser(caller *mockKey, params url.Values) (*mockUser, int, string, string) {
+	name := params.Get("UserName")
+	if name == "" {
+		if caller.user == nil {
+			return nil, http.StatusBadRequest, "ValidationError", "Must specify userName when calling with non-User credentials"
+		}
+		return caller.user, 0, "", ""
+	}
+	user, ok := s.users[name]
+	if !ok {
+		return nil, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The user with name %s cannot be found.", name)
+	}
+	return user, 0, "", ""
+}
+
+func (s *MockServer) createAccessKey(caller *mockKey, params url.Values) (interface{}, int, string, string) {
+	user, status, code, msg := s.targetUser(caller, params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	if len(s.userKeys(user.name)) >= maxAccessKeysPerUser {
+		return nil, http.StatusConflict, "LimitExceeded", fmt.Sprintf("Cannot exceed quota for AccessKeysPerUser: %d", maxAccessKeysPerUser)
+	}
+	key := s.newUserKey(user)
+	return &mockCreateAccessKeyResult{
+		AccessKey: mockAccessKey{
+			UserName:        user.name,
+			AccessKeyId:     key.id,
+			Status:          string(key.status),
+			SecretAccessKey: key.secret,
+			CreateDate:      mockTimestamp(key.created),
+		},
+	}, 0, "", ""
+}
+
+func (s *MockServer) deleteAccessKey(caller *mockKey, params url.Values) (interface{}, int, string, string) {
+	user, status, code, msg := s.targetUser(caller, params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	id := params.Get("AccessKeyId")
+	key, ok := s.keys[id]
+	if !ok || key.user != user {
+		return nil, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The Access Key with id %s cannot be found.", id)
+	}
+	delete(s.keys, id)
+	return nil, 0, "", ""
+}
+
+func (s *MockServer) listAccessKeys(caller *mockKey, params url.Values) (interface{}, int, string, string) {
+	user, status, code, msg := s.targetUser(caller, params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	result := new(mockListAccessKeysResult)
+	for _, key := range s.userKeys(user.name) {
+		result.AccessKeyMetadata = append(result.AccessKeyMetadata, mockAccessKey{
+			UserName:    user.name,
+			AccessKeyId: *key.AccessKeyId,
+			Status:      string(key.Status),
+			CreateDate:  mockTimestamp(*key.CreateDate),
+		})
+	}
+	return result, 0, "", ""
+}
+
+func (s *MockServer) getUser(caller *mockKey, params url.Values) (interface{}, int, string, string) {
+	user, status, code, msg := s.targetUser(caller, params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	return &mockGetUserResult{
+		User: mockIAMUser{
+			Path:       "/",
+			UserName:   user.name,
+			UserId:     user.id,
+			Arn:        user.arn(),
+			CreateDate: mockTimestamp(user.created),
+		},
+	}, 0, "", ""
+}
+
+func (s *MockServer) getCallerIdentity(caller *mockKey) interface{} {
+	result := &mockGetCallerIdentityResult{
+		Arn:     caller.principalArn(),
+		Account: MockServerAccountId,
+	}
+	switch {
+	case caller.user != nil:
+		result.UserId = caller.user.id
+	default:
+		result.UserId = caller.assumedRoleId
+	}
+	return result
+}
+
+func (s *MockServer) assumeRole(caller *mockKey, params url.Values) (interface{}, int, string, string) {
+	roleArn := params.Get("RoleArn")
+	role, ttl, status, code, msg := s.validateAssumeRole(params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	if params.Get("ExternalId") != role.externalId {
+		return nil, http.StatusForbidden, "AccessDenied", fmt.Sprintf("User: %s is not authorized to perform: sts:AssumeRole on resource: %s", caller.principalArn(), roleArn)
+	}
+
+	tags := make(map[string]string)
+	for i := 1; ; i++ {
+		k := params.Get(fmt.Sprintf("Tags.member.%d.Key", i))
+		if k == "" {
+			break
+		}
+		tags[k] = params.Get(fmt.Sprintf("Tags.member.%d.Value", i))
+	}
+
+	key := s.newRoleSession(role, params.Get("RoleSessionName"), ttl)
+	s.assumeRoleCalls = append(s.assumeRoleCalls, MockAssumeRoleCall{
+		CallerArn:       caller.principalArn(),
+		RoleArn:         roleArn,
+		RoleSessionName: params.Get("RoleSessionName"),
+		ExternalId:      params.Get("ExternalId"),
+		Tags:            tags,
+		AccessKeyId:     key.id,
+	})
+
+	return &mockAssumeRoleResult{
+		Credentials:     key.mockCredentials(),
+		AssumedRoleUser: key.mockAssumedRoleUser(),
+	}, 0, "", ""
+}
+
+func (s *MockServer) assumeRoleWithWebIdentity(params url.Values) (interface{}, int, string, string) {
+	role, ttl, status, code, msg := s.validateAssumeRole(params)
+	if code != "" {
+		return nil, status, code, msg
+	}
+	token := params.Get("WebIdentityToken")
+	if !s.webIdentities[token] {
+		return nil, http.StatusBadRequest, "InvalidIdentityToken", "The web identity token that was passed could not be validated by AWS."
+	}
+
+	key := s.newRoleSession(role, params.Get("RoleSessionName"), ttl)
+	s.assumeRoleCalls = append(s.assumeRoleCalls, MockAssumeRoleCall{
+		RoleArn:          role.arn,
+		RoleSessionName:  params.Get("RoleSessionName"),
+		WebIdentityToken: token,
+		AccessKeyId:      key.id,
+	})
+
+	return &mockAssumeRoleWithWebIdentityResult{
+		Credentials:     key.mockCredentials(),
+		AssumedRoleUser: key.mockAssumedRoleUser(),
+	}, 0, "", ""
+}
+
+// validateAssumeRole checks the parameters common to the AssumeRole actions,
+// returning the role and the session duration
+func (s *MockServer) validateAssumeRole(params url.Values) (*mockRole, time.Duration, int, string, string) {
+	roleArn := params.Get("RoleArn")
+	if roleArn == "" || params.Get("RoleSessionName") == "" {
+		return nil, 0, http.StatusBadRequest, "ValidationError", "RoleArn and RoleSessionName are required"
+	}
+	role, ok := s.roles[roleArn]
+	if !ok {
+		return nil, 0, http.StatusForbidden, "AccessDenied", fmt.Sprintf("Not authorized to perform sts:AssumeRole on resource: %s", roleArn)
+	}
+
+	ttl := mockDefaultSessionTTL
+	if d := params.Get("DurationSeconds"); d != "" {
+		secs, err := strconv.Atoi(d)
+		if err != nil || secs < 900 {
+			return nil, 0, http.StatusBadRequest, "ValidationError", "DurationSeconds must be at least 900"
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+	return role, ttl, 0, "", ""
+}
+
+// newRoleSession issues temporary credentials for the role; it must be called
+// with the lock held
+func (s *MockServer) newRoleSession(role *mockRole, sessionName string, ttl time.Duration) *mockKey {
+	roleName := role.arn[strings.LastIndex(role.arn, "/")+1:]
+	key := &mockKey{
+		id:             "ASIA" + mockRandomId(16),
+		secret:         mockRandomId(40),
+		sessionToken:   mockRandomId(64),
+		status:         iamTypes.StatusTypeActive,
+		created:        s.now().UTC(),
+		assumedRoleArn: fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", MockServerAccountId, roleName, sessionName),
+		assumedRoleId:  role.id + ":" + sessionName,
+		expires:        s.now().UTC().Add(ttl),
+	}
+	s.keys[key.id] = key
+	return key
+}
+
+func (k *mockKey) mockCredentials() mockCredentials {
+	return mockCredentials{
+		AccessKeyId:     k.id,
+		SecretAccessKey: k.secret,
+		SessionToken:    k.sessionToken,
+		Expiration:      mockTimestamp(k.expires),
+	}
+}
+
+func (k *mockKey) mockAssumedRoleUser() mockAssumedRoleUser {
+	return mockAssumedRoleUser{
+		Arn:           k.assumedRoleArn,
+		AssumedRoleId: k.assumedRoleId,
+	}
+}
+
+// writeResponse writes a query protocol response. The result marshals to the
+// action's Result element; a nil result writes only the response metadata.
+func (s *MockServer) writeResponse(w http.ResponseWriter, service, action string, result interface{}) {
+	namespace := mockIAMNamespace
+	if service == "sts" {
+		namespace = mockSTSNamespace
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<%sResponse xmlns="%s">`, action, namespace)
+	if result != nil {
+		out, err := xml.Marshal(result)
+		if err != nil {
+			s.writeError(w, service, http.StatusInternalServerError, "InternalFailure", err.Error())
+			return
+		}
+		buf.Write(out)
+	}
+	fmt.Fprintf(&buf, "<ResponseMetadata><RequestId>%s</RequestId></ResponseMetadata></%sResponse>", mockRequestId(), action)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeError writes a query protocol error response
+func (s *MockServer) writeError(w http.ResponseWriter, service string, status int, code, msg string) {
+	namespace := mockIAMNamespace
+	if service == "sts" {
+		namespace = mockSTSNamespace
+	}
+	errType := "Sender"
+	if status >= http.StatusInternalServerError {
+		errType = "Receiver"
+	}
+
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(msg))
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<ErrorResponse xmlns="%s"><Error><Type>%s</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>%s</RequestId></ErrorResponse>`,
+		namespace, errType, code, escaped.String(), mockRequestId())
+}
+
+type mockAccessKey struct {
+	UserName        string `xml:"UserName"`
+	AccessKeyId     string `xml:"AccessKeyId"`
+	Status          string `xml:"Status"`
+	SecretAccessKey string `xml:"SecretAccessKey,omitempty"`
+	CreateDate      string `xml:"CreateDate"`
+}
+
+type mockCreateAccessKeyResult struct {
+	XMLName   xml.Name      `xml:"CreateAccessKeyResult"`
+	AccessKey mockAccessKey `xml:"AccessKey"`
+}
+
+type mockListAccessKeysResult struct {
+	XMLName           xml.Name        `xml:"ListAccessKeysResult"`
+	AccessKeyMetadata []mockAccessKey `xml:"AccessKeyMetadata>member"`
+	IsTruncated       bool            `xml:"IsTruncated"`
+}
+
+type mockIAMUser struct {
+	Path       string `xml:"Path"`
+	UserName   string `xml:"UserName"`
+	UserId     string `xml:"UserId"`
+	Arn        string `xml:"Arn"`
+	CreateDate string `xml:"CreateDate"`
+}
+
+type mockGetUserResult struct {
+	XMLName xml.Name    `xml:"GetUserResult"`
+	User    mockIAMUser `xml:"User"`
+}
+
+type mockGetCallerIdentityResult struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResult"`
+	Arn     string   `xml:"Arn"`
+	UserId  string   `xml:"UserId"`
+	Account string   `xml:"Account"`
+}
+
+type mockCredentials struct {
+	AccessKeyId     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+type mockAssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleId string `xml:"AssumedRoleId"`
+}
+
+type mockAssumeRoleResult struct {
+	XMLName         xml.Name            `xml:"AssumeRoleResult"`
+	Credentials     mockCredentials     `xml:"Credentials"`
+	AssumedRoleUser mockAssumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+type mockAssumeRoleWithWebIdentityResult struct {
+	XMLName         xml.Name            `xml:"AssumeRoleWithWebIdentityResult"`
+	Credentials     mockCredentials     `xml:"Credentials"`
+	AssumedRoleUser mockAssumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+func mockTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func mockRequestId() string {
+	return strings.ToLower(mockRandomId(8) + "-" + mockRandomId(4) + "-" + mockRandomId(4) + "-" + mockRandomId(4) + "-" + mockRandomId(12))
+}
+
+// mockRandomId returns a random string of uppercase letters and digits, as
+// used in AWS access key IDs
+func mockRandomId(n int) string {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	for i := range buf {
+		buf[i] = chars[int(buf[i])%len(chars)]
+	}
+	return string(buf)
+}
@@ -0,0 +1,244 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	stsTypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockServerConfig returns a credentials config using the given
+// credentials against the mock server
+func newMockServerConfig(t *testing.T, s *MockServer, creds aws.Credentials, opt ...Option) *CredentialsConfig {
+	t.Helper()
+	c, err := NewCredentialsConfig(append([]Option{
+		WithAccessKey(creds.AccessKeyID),
+		WithSecretKey(creds.SecretAccessKey),
+		WithRegion("us-east-1"),
+		WithIamEndpointResolver(s.IAMEndpointResolver()),
+		WithStsEndpointResolver(s.STSEndpointResolver()),
+	}, opt...)...)
+	require.NoError(t, err)
+	c.SessionToken = creds.SessionToken
+	return c
+}
+
+func requireAPIErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var apiErr smithy.APIError
+	require.True(t, errors.As(err, &apiErr), "expected an API error, got %v", err)
+	assert.Equal(t, code, apiErr.ErrorCode())
+}
+
+func TestMockServer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("caller-identity", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(err)
+
+		c := newMockServerConfig(t, s, creds)
+		cid, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		assert.Equal("arn:aws:iam::123456789012:user/foouser", *cid.Arn)
+		assert.Equal(MockServerAccountId, *cid.Account)
+		assert.True(strings.HasPrefix(*cid.UserId, "AIDA"))
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(t, err)
+
+		cases := []struct {
+			name  string
+			creds aws.Credentials
+			code  string
+		}{
+			{
+				name:  "unknown key",
+				creds: aws.Credentials{AccessKeyID: "AKIAUNKNOWN", SecretAccessKey: creds.SecretAccessKey},
+				code:  "InvalidClientTokenId",
+			},
+			{
+				name:  "wrong secret",
+				creds: aws.Credentials{AccessKeyID: creds.AccessKeyID, SecretAccessKey: "wrong"},
+				code:  "SignatureDoesNotMatch",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				c := newMockServerConfig(t, s, tc.creds)
+				_, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+				require.Error(t, err)
+				requireAPIErrorCode(t, err, tc.code)
+			})
+		}
+
+		t.Run("inactive key", func(t *testing.T) {
+			require.NoError(t, s.SetAccessKeyStatus(creds.AccessKeyID, "Inactive"))
+			c := newMockServerConfig(t, s, creds)
+			_, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+			require.Error(t, err)
+			requireAPIErrorCode(t, err, "InvalidClientTokenId")
+		})
+
+		t.Run("unsigned", func(t *testing.T) {
+			resp, err := http.Post(s.URL(), "application/x-www-form-urlencoded", strings.NewReader("Action=GetCallerIdentity&Version=2011-06-15"))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	})
+
+	t.Run("rotate-keys", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(err)
+
+		c := newMockServerConfig(t, s, creds)
+		require.NoError(c.RotateKeys(ctx, WithSharedCredentials(false), WithValidityCheckTimeout(5*time.Second)))
+		assert.NotEqual(creds.AccessKeyID, c.AccessKey)
+
+		keys := s.AccessKeys("foouser")
+		require.Len(keys, 1)
+		assert.Equal(c.AccessKey, *keys[0].AccessKeyId)
+
+		// The old key no longer works, the new one does
+		_, err = newMockServerConfig(t, s, creds).GetCallerIdentity(ctx, WithSharedCredentials(false))
+		requireAPIErrorCode(t, err, "InvalidClientTokenId")
+		_, err = c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+	})
+
+	t.Run("key-rotation", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(err)
+
+		// Fill the user's second key slot with an inactive key
+		c := newMockServerConfig(t, s, creds)
+		stale, err := c.CreateAccessKey(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		require.NoError(s.SetAccessKeyStatus(*stale.AccessKey.AccessKeyId, "Inactive"))
+
+		r, err := c.StartKeyRotation(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		assert.Equal("foouser", r.UserName)
+		assert.Equal([]string{*stale.AccessKey.AccessKeyId}, r.DeletedStaleKeyIds)
+		assert.Len(s.AccessKeys("foouser"), 2)
+
+		// A third key exceeds the limit
+		_, err = c.CreateAccessKey(ctx, WithSharedCredentials(false))
+		requireAPIErrorCode(t, err, "LimitExceeded")
+
+		require.NoError(r.Confirm(ctx))
+		keys := s.AccessKeys("foouser")
+		require.Len(keys, 1)
+		assert.Equal(r.NewAccessKeyId, *keys[0].AccessKeyId)
+	})
+
+	t.Run("assume-role", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(err)
+		const roleArn = "arn:aws:iam::123456789012:role/foorole"
+		require.NoError(s.AddRole(roleArn, "extid"))
+
+		c := newMockServerConfig(t, s, creds)
+		client, err := c.STSClient(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+
+		_, err = client.AssumeRole(ctx, &sts.AssumeRoleInput{
+			RoleArn:         aws.String(roleArn),
+			RoleSessionName: aws.String("session"),
+		})
+		requireAPIErrorCode(t, err, "AccessDenied")
+
+		out, err := client.AssumeRole(ctx, &sts.AssumeRoleInput{
+			RoleArn:         aws.String(roleArn),
+			RoleSessionName: aws.String("session"),
+			ExternalId:      aws.String("extid"),
+			Tags:            []stsTypes.Tag{{Key: aws.String("team"), Value: aws.String("foo")}},
+		})
+		require.NoError(err)
+		assert.Equal("arn:aws:sts::123456789012:assumed-role/foorole/session", *out.AssumedRoleUser.Arn)
+		assert.WithinDuration(time.Now().Add(time.Hour), *out.Credentials.Expiration, time.Minute)
+
+		calls := s.AssumeRoleCalls()
+		require.Len(calls, 1)
+		assert.Equal(MockAssumeRoleCall{
+			CallerArn:       "arn:aws:iam::123456789012:user/foouser",
+			RoleArn:         roleArn,
+			RoleSessionName: "session",
+			ExternalId:      "extid",
+			Tags:            map[string]string{"team": "foo"},
+			AccessKeyId:     *out.Credentials.AccessKeyId,
+		}, calls[0])
+
+		// The temporary credentials are accepted only with their session token
+		roleCreds := aws.Credentials{
+			AccessKeyID:     *out.Credentials.AccessKeyId,
+			SecretAccessKey: *out.Credentials.SecretAccessKey,
+			SessionToken:    *out.Credentials.SessionToken,
+		}
+		cid, err := newMockServerConfig(t, s, roleCreds).GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		assert.Equal(*out.AssumedRoleUser.Arn, *cid.Arn)
+
+		roleCreds.SessionToken = "wrong"
+		_, err = newMockServerConfig(t, s, roleCreds).GetCallerIdentity(ctx, WithSharedCredentials(false))
+		requireAPIErrorCode(t, err, "SignatureDoesNotMatch")
+
+		// Temporary credentials cannot manage user keys without a user name
+		_, err = newMockServerConfig(t, s, aws.Credentials{
+			AccessKeyID:     *out.Credentials.AccessKeyId,
+			SecretAccessKey: *out.Credentials.SecretAccessKey,
+			SessionToken:    *out.Credentials.SessionToken,
+		}).CreateAccessKey(ctx, WithSharedCredentials(false))
+		requireAPIErrorCode(t, err, "ValidationError")
+	})
+
+	t.Run("faults", func(t *testing.T) {
+		require := require.New(t)
+		s := NewMockServer()
+		defer s.Close()
+		creds, err := s.AddUser("foouser")
+		require.NoError(err)
+
+		// The SDK retries throttling errors
+		s.FailNext("GetCallerIdentity", 1, http.StatusBadRequest, &MockAWSErr{Code: "Throttling", Message: "Rate exceeded"})
+		c := newMockServerConfig(t, s, creds)
+		_, err = c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+
+		// MaxRetries is passed to the SDK as the maximum number of attempts
+		maxRetries := 1
+		s.FailNext("GetCallerIdentity", 1, http.StatusBadRequest, &MockAWSErr{Code: "Throttling", Message: "Rate exceeded"})
+		c = newMockServerConfig(t, s, creds, WithMaxRetries(&maxRetries))
+		_, err = c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		requireAPIErrorCode(t, err, "Throttling")
+	})
+}
@@ -16,6 +16,7 @@ var (
 	_ awserr.APIError         = (*MockAWSErr)(nil)
 	_ aws.CredentialsProvider = (*MockCredentialsProvider)(nil)
 	_ IAMClient               = (*MockIAM)(nil)
+	_ IAMAccessKeyClient      = (*MockIAM)(nil)
 	_ STSClient               = (*MockSTS)(nil)
 )
 
@@ -118,6 +119,10 @@ type MockIAM struct {
 	ListAccessKeysError   error
 	GetUserOutput         *iam.GetUserOutput
 	GetUserError          error
+
+	GetAccessKeyLastUsedOutputs map[string]*iam.GetAccessKeyLastUsedOutput
+	GetAccessKeyLastUsedError   error
+	UpdateAccessKeyError        error
 }
 
 // MockIAMOption is a function for setting the various fields on a MockIAM
@@ -182,6 +187,36 @@ func WithGetUserError(e error) MockIAMOption {
 	}
 }
 
+// WithGetAccessKeyLastUsedOutput sets the output for the GetAccessKeyLastUsed
+// method for the given access key. Other access keys return an empty output.
+func WithGetAccessKeyLastUsedOutput(accessKeyId string, o *iam.GetAccessKeyLastUsedOutput) MockIAMOption {
+	return func(m *MockIAM) error {
+		if m.GetAccessKeyLastUsedOutputs == nil {
+			m.GetAccessKeyLastUsedOutputs = make(map[string]*iam.GetAccessKeyLastUsedOutput)
+		}
+		m.GetAccessKeyLastUsedOutputs[accessKeyId] = o
+		return nil
+	}
+}
+
+// WithGetAccessKeyLastUsedError sets the error output for the
+// GetAccessKeyLastUsed method.
+func WithGetAccessKeyLastUsedError(e error) MockIAMOption {
+	return func(m *MockIAM) error {
+		m.GetAccessKeyLastUsedError = e
+		return nil
+	}
+}
+
+// WithUpdateAccessKeyError sets the error output for the UpdateAccessKey
+// method.
+func WithUpdateAccessKeyError(e error) MockIAMOption {
+	return func(m *MockIAM) error {
+		m.UpdateAccessKeyError = e
+		return nil
+	}
+}
+
 // NewMockIAM provides a factory function to use with the WithIAMAPIFunc
 // option.
 func NewMockIAM(opts ...MockIAMOption) IAMAPIFunc {
@@ -225,6 +260,23 @@ func (m *MockIAM) GetUser(context.Context, *iam.GetUserInput, ...func(*iam.Optio
 	return m.GetUserOutput, nil
 }
 
+func (m *MockIAM) GetAccessKeyLastUsed(_ context.Context, input *iam.GetAccessKeyLastUsedInput, _ ...func(*iam.Options)) (*iam.GetAccessKeyLastUsedOutput, error) {
+	if m.GetAccessKeyLastUsedError != nil {
+		return nil, m.GetAccessKeyLastUsedError
+	}
+
+	if input != nil && input.AccessKeyId != nil {
+		if o, ok := m.GetAccessKeyLastUsedOutputs[*input.AccessKeyId]; ok {
+			return o, nil
+		}
+	}
+	return &iam.GetAccessKeyLastUsedOutput{}, nil
+}
+
+func (m *MockIAM) UpdateAccessKey(context.Context, *iam.UpdateAccessKeyInput, ...func(*iam.Options)) (*iam.UpdateAccessKeyOutput, error) {
+	return &iam.UpdateAccessKeyOutput{}, m.UpdateAccessKeyError
+}
+
 // MockSTS provides a way to mock the AWS STS API.
 type MockSTS struct {
 	STSClient
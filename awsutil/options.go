@@ -4,6 +4,7 @@
 package awsutil
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -53,6 +54,18 @@ type options struct {
 	withIAMAPIFunc           IAMAPIFunc
 	withSTSAPIFunc           STSAPIFunc
 	withCredentialsProvider  aws.CredentialsProvider
+	withRefreshWindow        time.Duration
+	withNowFunc              func() time.Time
+	withGracePeriod          time.Duration
+	withServerIdHeaderValue  string
+	withIMDSDisabled         bool
+	withIMDSTimeout          time.Duration
+	withRoleChain            []RoleHop
+	withCredentialProcess    string
+	withRetryAttempts        int
+	withRetryBaseDelay       time.Duration
+	withRetryMaxDelay        time.Duration
+	withAuditHook            AuditHook
 }
 
 func getDefaultOptions() options {
@@ -244,3 +257,132 @@ func WithCredentialsProvider(with aws.CredentialsProvider) Option {
 		return nil
 	}
 }
+
+// WithRefreshWindow allows passing how long before expiry cached credentials
+// should be refreshed
+func WithRefreshWindow(with time.Duration) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("refresh window must not be negative")
+		}
+		o.withRefreshWindow = with
+		return nil
+	}
+}
+
+// withNowFunc allows overriding the current time, for testing
+func withNowFunc(with func() time.Time) Option {
+	return func(o *options) error {
+		o.withNowFunc = with
+		return nil
+	}
+}
+
+// WithGracePeriod allows passing how long both the old and new access keys
+// remain valid during a key rotation before the old key is deleted
+func WithGracePeriod(with time.Duration) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("grace period must not be negative")
+		}
+		o.withGracePeriod = with
+		return nil
+	}
+}
+
+// WithServerIdHeaderValue allows passing a value for the
+// X-Vault-AWS-IAM-Server-ID header, binding a signed GetCallerIdentity request
+// to the server it is intended for
+func WithServerIdHeaderValue(with string) Option {
+	return func(o *options) error {
+		o.withServerIdHeaderValue = with
+		return nil
+	}
+}
+
+// WithIMDSDisabled allows skipping the EC2 instance metadata service when
+// resolving the region
+func WithIMDSDisabled(with bool) Option {
+	return func(o *options) error {
+		o.withIMDSDisabled = with
+		return nil
+	}
+}
+
+// WithIMDSTimeout allows passing a timeout for requests to the EC2 instance
+// metadata service
+func WithIMDSTimeout(with time.Duration) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("IMDS timeout must not be negative")
+		}
+		o.withIMDSTimeout = with
+		return nil
+	}
+}
+
+// WithRoleChain allows passing roles to assume in order once the other
+// credentials have been resolved, each using the credentials from the one
+// before
+func WithRoleChain(with []RoleHop) Option {
+	return func(o *options) error {
+		o.withRoleChain = with
+		return nil
+	}
+}
+
+// WithCredentialProcess allows passing a command to run to obtain
+// credentials, in the format of the credential_process shared config setting
+func WithCredentialProcess(with string) Option {
+	return func(o *options) error {
+		o.withCredentialProcess = with
+		return nil
+	}
+}
+
+// WithRetryAttempts allows passing the number of times to make a call,
+// including the first, when retrying temporary errors. A value of 1 disables
+// retries; 0 uses DefaultRetryAttempts.
+func WithRetryAttempts(with int) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("retry attempts must not be negative")
+		}
+		o.withRetryAttempts = with
+		return nil
+	}
+}
+
+// WithRetryBaseDelay allows passing the maximum backoff before the first
+// retry of a temporary error; it doubles for each subsequent retry
+func WithRetryBaseDelay(with time.Duration) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("retry base delay must not be negative")
+		}
+		o.withRetryBaseDelay = with
+		return nil
+	}
+}
+
+// WithRetryMaxDelay allows passing the upper bound on the backoff before any
+// retry of a temporary error
+func WithRetryMaxDelay(with time.Duration) Option {
+	return func(o *options) error {
+		if with < 0 {
+			return errors.New("retry max delay must not be negative")
+		}
+		o.withRetryMaxDelay = with
+		return nil
+	}
+}
+
+// WithAuditHook allows passing a hook that receives an event for each access
+// key created, deleted, deactivated or rotated, and for each role assumed
+// while retrieving credentials
+func WithAuditHook(with AuditHook) Option {
+	return func(o *options) error {
+		o.withAuditHook = with
+		return nil
+	}
+}
@@ -4,6 +4,7 @@
 package awsutil
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -170,4 +171,98 @@ func Test_GetOpts(t *testing.T) {
 		testOpts.withCredentialsProvider = credProvider
 		assert.Equal(t, opts, testOpts)
 	})
+	t.Run("WithRefreshWindow", func(t *testing.T) {
+		opts, err := getOpts(WithRefreshWindow(time.Minute))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withRefreshWindow = time.Minute
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithRefreshWindow(-time.Minute))
+		require.Error(t, err)
+	})
+	t.Run("WithGracePeriod", func(t *testing.T) {
+		opts, err := getOpts(WithGracePeriod(time.Hour))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withGracePeriod = time.Hour
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithGracePeriod(-time.Hour))
+		require.Error(t, err)
+	})
+	t.Run("WithServerIdHeaderValue", func(t *testing.T) {
+		opts, err := getOpts(WithServerIdHeaderValue("vault.example.com"))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withServerIdHeaderValue = "vault.example.com"
+		assert.Equal(t, opts, testOpts)
+	})
+	t.Run("WithIMDSDisabled", func(t *testing.T) {
+		opts, err := getOpts(WithIMDSDisabled(true))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withIMDSDisabled = true
+		assert.Equal(t, opts, testOpts)
+	})
+	t.Run("WithIMDSTimeout", func(t *testing.T) {
+		opts, err := getOpts(WithIMDSTimeout(time.Second))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withIMDSTimeout = time.Second
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithIMDSTimeout(-time.Second))
+		require.Error(t, err)
+	})
+	t.Run("WithRoleChain", func(t *testing.T) {
+		chain := []RoleHop{{RoleARN: "arn:aws:iam::123456789012:role/foo", ExternalId: "bar"}}
+		opts, err := getOpts(WithRoleChain(chain))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withRoleChain = chain
+		assert.Equal(t, opts, testOpts)
+	})
+	t.Run("WithCredentialProcess", func(t *testing.T) {
+		opts, err := getOpts(WithCredentialProcess("/usr/bin/creds"))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withCredentialProcess = "/usr/bin/creds"
+		assert.Equal(t, opts, testOpts)
+	})
+	t.Run("WithRetryAttempts", func(t *testing.T) {
+		opts, err := getOpts(WithRetryAttempts(5))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withRetryAttempts = 5
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithRetryAttempts(-1))
+		require.Error(t, err)
+	})
+	t.Run("WithRetryBaseDelay", func(t *testing.T) {
+		opts, err := getOpts(WithRetryBaseDelay(time.Second))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withRetryBaseDelay = time.Second
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithRetryBaseDelay(-time.Second))
+		require.Error(t, err)
+	})
+	t.Run("WithRetryMaxDelay", func(t *testing.T) {
+		opts, err := getOpts(WithRetryMaxDelay(time.Minute))
+		require.NoError(t, err)
+		testOpts := getDefaultOptions()
+		testOpts.withRetryMaxDelay = time.Minute
+		assert.Equal(t, opts, testOpts)
+
+		_, err = getOpts(WithRetryMaxDelay(-time.Minute))
+		require.Error(t, err)
+	})
+	t.Run("WithAuditHook", func(t *testing.T) {
+		opts, err := getOpts(WithAuditHook(func(context.Context, AuditEvent) {}))
+		require.NoError(t, err)
+		assert.NotNil(t, opts.withAuditHook)
+	})
 }
@@ -5,10 +5,13 @@ package awsutil
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/hashicorp/go-hclog"
 )
 
 // "us-east-1 is used because it's where AWS first provides support for new features,
@@ -37,28 +40,139 @@ Our chosen approach is:
 4. Configuration retrieved from the EC2 instance metadata service is shared by all invocations on a given machine, and so it has the lowest precedence.
 
 This approach should be used in future updates to this logic.
+
+GetRegion is equivalent to ResolveRegion on a CredentialsConfig with only
+Region set. Use ResolveRegion to honor a named profile or shared credentials
+file, or to learn where the region came from.
 */
 func GetRegion(ctx context.Context, configuredRegion string) (string, error) {
-	if configuredRegion != "" {
-		return configuredRegion, nil
+	region, _, err := (&CredentialsConfig{Region: configuredRegion}).ResolveRegion(ctx)
+	return region, err
+}
+
+// RegionSource describes where a resolved region came from
+type RegionSource string
+
+const (
+	// RegionSourceConfig means the region was explicitly configured
+	RegionSourceConfig RegionSource = "config"
+	// RegionSourceEnv means the region came from the AWS_REGION or
+	// AWS_DEFAULT_REGION environment variables
+	RegionSourceEnv RegionSource = "env"
+	// RegionSourceSharedConfig means the region came from the profile in the
+	// shared config or credentials files
+	RegionSourceSharedConfig RegionSource = "shared_config"
+	// RegionSourceIMDS means the region came from the EC2 instance metadata
+	// service
+	RegionSourceIMDS RegionSource = "imds"
+	// RegionSourceDefault means no region was found and DefaultRegion was used
+	RegionSourceDefault RegionSource = "default"
+)
+
+// ResolveRegion determines the region to use following the precedence
+// described on GetRegion: the config's Region, then the environment, then the
+// config's profile in the shared config and credentials files, then the EC2
+// instance metadata service, and finally DefaultRegion. It returns the region
+// along with where it was found.
+//
+// The profile is the config's Profile, else AWS_PROFILE, else "default"; it is
+// an error for an explicitly named profile not to exist. The shared
+// credentials file is the config's Filename if set. A Region that
+// NewCredentialsConfig defaulted, rather than one that was configured, is
+// ignored.
+//
+// Supported options: WithIMDSDisabled, WithIMDSTimeout
+//
+// The instance metadata service is also skipped if AWS_EC2_METADATA_DISABLED
+// is set to true.
+func (c *CredentialsConfig) ResolveRegion(ctx context.Context, opt ...Option) (string, RegionSource, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading options in ResolveRegion: %w", err)
+	}
+
+	region, source, err := c.resolveRegion(ctx, opts)
+	if err != nil {
+		return "", "", err
+	}
+	c.log(hclog.Debug, "resolved region", "region", region, "source", source)
+	return region, source, nil
+}
+
+func (c *CredentialsConfig) resolveRegion(ctx context.Context, opts options) (string, RegionSource, error) {
+	switch c.regionSource {
+	case RegionSourceDefault, RegionSourceEnv:
+		// Re-read below so the source is reported accurately
+	default:
+		if c.Region != "" {
+			return c.Region, RegionSourceConfig, nil
+		}
+	}
+
+	for _, envKey := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(envKey); region != "" {
+			return region, RegionSourceEnv, nil
+		}
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	profile := c.Profile
+	if profile == "" {
+		profile = os.Getenv(envAwsProfile)
+	}
+	explicitProfile := profile != ""
+	if !explicitProfile {
+		profile = defaultStr
+	}
+	sharedCfg, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		if f := os.Getenv("AWS_CONFIG_FILE"); f != "" {
+			o.ConfigFiles = []string{f}
+		}
+		switch {
+		case c.Filename != "":
+			o.CredentialsFiles = []string{c.Filename}
+		case os.Getenv("AWS_SHARED_CREDENTIALS_FILE") != "":
+			o.CredentialsFiles = []string{os.Getenv("AWS_SHARED_CREDENTIALS_FILE")}
+		}
+	})
+	// aws-sdk's special errors don't work with go's errors.Is
+	var notExistErr config.SharedConfigProfileNotExistError
+	switch {
+	case err == nil:
+		if sharedCfg.Region != "" {
+			return sharedCfg.Region, RegionSourceSharedConfig, nil
+		}
+	case errors.As(err, &notExistErr) && !explicitProfile:
+	default:
+		return "", "", fmt.Errorf("error loading shared config profile %q: %w", profile, err)
+	}
+
+	envCfg, err := config.NewEnvConfig()
 	if err != nil {
-		return "", fmt.Errorf("got error when loading default configuration: %w", err)
+		return "", "", fmt.Errorf("error loading environment config: %w", err)
 	}
-	if cfg.Region != "" {
-		return cfg.Region, nil
+	if opts.withIMDSDisabled || envCfg.EC2IMDSClientEnableState == imds.ClientDisabled {
+		return DefaultRegion, RegionSourceDefault, nil
 	}
 
-	client := imds.NewFromConfig(cfg)
-	resp, err := client.GetRegion(ctx, &imds.GetRegionInput{})
+	imdsOpts := imds.Options{
+		Endpoint:     envCfg.EC2IMDSEndpoint,
+		EndpointMode: envCfg.EC2IMDSEndpointMode,
+	}
+	if ec2Endpoint != nil {
+		imdsOpts.Endpoint = *ec2Endpoint
+	}
+	if opts.withIMDSTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.withIMDSTimeout)
+		defer cancel()
+	}
+	resp, err := imds.New(imdsOpts).GetRegion(ctx, &imds.GetRegionInput{})
 	if err != nil {
-		return "", fmt.Errorf("unable to retrieve region from instance metadata: %w", err)
+		return "", "", fmt.Errorf("unable to retrieve region from instance metadata: %w", err)
 	}
 	if resp.Region != "" {
-		return resp.Region, nil
+		return resp.Region, RegionSourceIMDS, nil
 	}
 
-	return DefaultRegion, nil
+	return DefaultRegion, RegionSourceDefault, nil
 }
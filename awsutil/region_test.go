@@ -5,14 +5,19 @@ package awsutil
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/user"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testConfigFile = `[default]
@@ -245,20 +250,7 @@ func setConfigFileRegion(t *testing.T, region string) (cleanup func()) {
 }
 
 func setInstanceMetadata(t *testing.T, region string) (cleanup func()) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqPath := r.URL.String()
-		switch reqPath {
-		case "/latest/meta-data/instance-id":
-			w.Write([]byte("i-1234567890abcdef0"))
-			return
-		case "/latest/meta-data/placement/availability-zone":
-			// add a letter suffix, as a normal response is formatted like "us-east-1a"
-			w.Write([]byte(region + "a"))
-			return
-		default:
-			t.Fatalf("received unexpected request path: %s", reqPath)
-		}
-	}))
+	ts := newInstanceMetadataServer(t, region, 0)
 	ec2Endpoint = aws.String(ts.URL)
 	cleanup = func() {
 		ts.Close()
@@ -266,3 +258,217 @@ func setInstanceMetadata(t *testing.T, region string) (cleanup func()) {
 	}
 	return
 }
+
+// newInstanceMetadataServer returns a stand-in for the IMDSv2 endpoints used
+// to look up the region, which waits for delay before responding
+func newInstanceMetadataServer(t *testing.T, region string, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			w.Write([]byte("token"))
+		case r.Method == http.MethodGet && r.URL.Path == "/latest/dynamic/instance-identity/document":
+			if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"region": %q, "instanceId": "i-1234567890abcdef0"}`, region)
+		default:
+			t.Errorf("received unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// isolateRegionEnv clears the environment variables that influence region
+// resolution and points the shared config files at the given files, which
+// need not exist
+func isolateRegionEnv(t *testing.T, configFile, credentialsFile string) {
+	for _, envKey := range append(regionEnvKeys, "AWS_PROFILE", "AWS_EC2_METADATA_DISABLED", "AWS_EC2_METADATA_SERVICE_ENDPOINT") {
+		t.Setenv(envKey, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+}
+
+func TestResolveRegion(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	credentialsFile := filepath.Join(dir, "credentials")
+	require.NoError(t, os.WriteFile(configFile, []byte(`[default]
+region = eu-west-1
+
+[profile foo]
+region = ap-south-1
+
+[profile noregion]
+output = json
+`), 0o600))
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(`[bar]
+region = sa-east-1
+`), 0o600))
+
+	imdsServer := newInstanceMetadataServer(t, "ca-central-1", 0)
+	defer imdsServer.Close()
+
+	cases := []struct {
+		name           string
+		env            map[string]string
+		config         func(t *testing.T) *CredentialsConfig
+		opts           []Option
+		expectedRegion string
+		expectedSource RegionSource
+		requireErr     string
+	}{
+		{
+			name: "configured",
+			env:  map[string]string{"AWS_REGION": unexpectedTestRegion},
+			config: func(t *testing.T) *CredentialsConfig {
+				c, err := NewCredentialsConfig(WithRegion(expectedTestRegion))
+				require.NoError(t, err)
+				return c
+			},
+			expectedRegion: expectedTestRegion,
+			expectedSource: RegionSourceConfig,
+		},
+		{
+			name: "struct literal",
+			config: func(t *testing.T) *CredentialsConfig {
+				return &CredentialsConfig{Region: expectedTestRegion}
+			},
+			expectedRegion: expectedTestRegion,
+			expectedSource: RegionSourceConfig,
+		},
+		{
+			name: "env",
+			env:  map[string]string{"AWS_DEFAULT_REGION": expectedTestRegion},
+			config: func(t *testing.T) *CredentialsConfig {
+				c, err := NewCredentialsConfig()
+				require.NoError(t, err)
+				return c
+			},
+			expectedRegion: expectedTestRegion,
+			expectedSource: RegionSourceEnv,
+		},
+		{
+			name: "default profile",
+			config: func(t *testing.T) *CredentialsConfig {
+				// The region NewCredentialsConfig defaults to is ignored
+				c, err := NewCredentialsConfig()
+				require.NoError(t, err)
+				return c
+			},
+			expectedRegion: "eu-west-1",
+			expectedSource: RegionSourceSharedConfig,
+		},
+		{
+			name:           "named profile",
+			config:         func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{Profile: "foo"} },
+			expectedRegion: "ap-south-1",
+			expectedSource: RegionSourceSharedConfig,
+		},
+		{
+			name:           "profile from env",
+			env:            map[string]string{"AWS_PROFILE": "foo"},
+			config:         func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{} },
+			expectedRegion: "ap-south-1",
+			expectedSource: RegionSourceSharedConfig,
+		},
+		{
+			name: "credentials file",
+			config: func(t *testing.T) *CredentialsConfig {
+				return &CredentialsConfig{Profile: "bar", Filename: credentialsFile}
+			},
+			expectedRegion: "sa-east-1",
+			expectedSource: RegionSourceSharedConfig,
+		},
+		{
+			name:       "missing profile",
+			config:     func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{Profile: "missing"} },
+			requireErr: `error loading shared config profile "missing"`,
+		},
+		{
+			name:           "imds",
+			env:            map[string]string{"AWS_EC2_METADATA_SERVICE_ENDPOINT": imdsServer.URL},
+			config:         func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{Profile: "noregion"} },
+			expectedRegion: "ca-central-1",
+			expectedSource: RegionSourceIMDS,
+		},
+		{
+			name:           "imds disabled",
+			env:            map[string]string{"AWS_EC2_METADATA_SERVICE_ENDPOINT": imdsServer.URL},
+			config:         func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{Profile: "noregion"} },
+			opts:           []Option{WithIMDSDisabled(true)},
+			expectedRegion: DefaultRegion,
+			expectedSource: RegionSourceDefault,
+		},
+		{
+			name: "imds disabled by env",
+			env: map[string]string{
+				"AWS_EC2_METADATA_SERVICE_ENDPOINT": imdsServer.URL,
+				"AWS_EC2_METADATA_DISABLED":         "true",
+			},
+			config:         func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{Profile: "noregion"} },
+			expectedRegion: DefaultRegion,
+			expectedSource: RegionSourceDefault,
+		},
+		{
+			name:       "options error",
+			config:     func(t *testing.T) *CredentialsConfig { return &CredentialsConfig{} },
+			opts:       []Option{MockOptionErr(errors.New("option error"))},
+			requireErr: "option error",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require, assert := require.New(t), assert.New(t)
+			isolateRegionEnv(t, configFile, credentialsFile)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			region, source, err := tc.config(t).ResolveRegion(ctx, tc.opts...)
+			if tc.requireErr != "" {
+				require.Error(err)
+				assert.Contains(err.Error(), tc.requireErr)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tc.expectedRegion, region)
+			assert.Equal(tc.expectedSource, source)
+		})
+	}
+
+	t.Run("imds timeout", func(t *testing.T) {
+		isolateRegionEnv(t, configFile, credentialsFile)
+		slowServer := newInstanceMetadataServer(t, "ca-central-1", time.Minute)
+		defer slowServer.Close()
+		t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", slowServer.URL)
+
+		start := time.Now()
+		_, _, err := (&CredentialsConfig{Profile: "noregion"}).ResolveRegion(ctx, WithIMDSTimeout(100*time.Millisecond))
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("GetRegion", func(t *testing.T) {
+		isolateRegionEnv(t, configFile, credentialsFile)
+		cleanupMetadata := setInstanceMetadata(t, unexpectedTestRegion)
+		defer cleanupMetadata()
+
+		region, err := GetRegion(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", region)
+
+		t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "missing"))
+		region, err = GetRegion(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, unexpectedTestRegion, region)
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// DefaultRetryAttempts is the number of times Retry makes a call, including
+	// the first, when WithRetryAttempts is not given
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBaseDelay is the backoff before the first retry when
+	// WithRetryBaseDelay is not given
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+
+	// DefaultRetryMaxDelay is the upper bound on any single backoff when
+	// WithRetryMaxDelay is not given
+	DefaultRetryMaxDelay = 5 * time.Second
+)
+
+// Retry calls fn until it succeeds, it returns an error that is not
+// temporary according to ClassifyAWSError, the attempts are exhausted, or ctx
+// is done. Between attempts it waits for a random duration of up to the base
+// delay doubled for each prior attempt, capped at the max delay ("full
+// jitter"). The error from the last attempt is returned.
+//
+// Note that AWS SDK clients already retry some errors themselves; this is
+// intended for retrying whole operations on top of that.
+//
+// Supported options: WithRetryAttempts, WithRetryBaseDelay, WithRetryMaxDelay,
+// WithLogger
+func Retry(ctx context.Context, fn func(context.Context) error, opt ...Option) error {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return fmt.Errorf("error reading options in Retry: %w", err)
+	}
+	return retryWithBackoff(ctx, opts, opts.withLogger, IsTemporaryAWSError, fn)
+}
+
+// retryWithBackoff implements Retry, retrying errors for which retryable
+// returns true
+func retryWithBackoff(ctx context.Context, opts options, logger hclog.Logger, retryable func(error) bool, fn func(context.Context) error) error {
+	attempts := opts.withRetryAttempts
+	if attempts == 0 {
+		attempts = DefaultRetryAttempts
+	}
+	baseDelay := opts.withRetryBaseDelay
+	if baseDelay == 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+	maxDelay := opts.withRetryMaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+
+		delay := retryBackoff(attempt, baseDelay, maxDelay)
+		if logger != nil {
+			logger.Debug("retrying after error", "attempt", attempt, "delay", delay, "category", ClassifyAWSError(err), "error", err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// retryBackoff returns a random delay between zero and the base delay doubled
+// for each attempt already made, capped at the max delay
+func retryBackoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	ceiling := maxDelay
+	if shift := attempt - 1; shift < 62 && baseDelay <= maxDelay>>shift {
+		ceiling = baseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
@@ -0,0 +1,133 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	awserr "github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	fast := []Option{WithRetryBaseDelay(time.Millisecond), WithRetryMaxDelay(time.Millisecond)}
+
+	failing := func(errs ...error) (func(context.Context) error, *int) {
+		var calls int
+		return func(context.Context) error {
+			calls++
+			if calls <= len(errs) {
+				return errs[calls-1]
+			}
+			return nil
+		}, &calls
+	}
+
+	t.Run("temporary", func(t *testing.T) {
+		fn, calls := failing(MockAWSThrottleErr(), &MockAWSErr{Code: "InternalFailure", Fault: awserr.FaultServer})
+		require.NoError(t, Retry(ctx, fn, fast...))
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("not temporary", func(t *testing.T) {
+		accessDenied := &MockAWSErr{Code: "AccessDenied", Fault: awserr.FaultClient}
+		fn, calls := failing(accessDenied)
+		require.Equal(t, accessDenied, Retry(ctx, fn, fast...))
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		throttleErr := MockAWSThrottleErr()
+		fn, calls := failing(throttleErr, throttleErr, throttleErr, throttleErr)
+		require.Equal(t, throttleErr, Retry(ctx, fn, append(fast, WithRetryAttempts(2))...))
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		throttleErr := MockAWSThrottleErr()
+		var calls int
+		err := Retry(ctx, func(context.Context) error {
+			calls++
+			cancel()
+			return throttleErr
+		}, WithRetryBaseDelay(time.Hour), WithRetryMaxDelay(time.Hour))
+		require.Equal(t, throttleErr, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("bad options", func(t *testing.T) {
+		err := Retry(ctx, func(context.Context) error { return nil }, MockOptionErr(errors.New("option error")))
+		require.Error(t, err)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt, ceiling := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		10: time.Second,
+		90: time.Second,
+	} {
+		for range 100 {
+			delay := retryBackoff(attempt, 100*time.Millisecond, time.Second)
+			require.GreaterOrEqual(t, delay, time.Duration(0))
+			require.LessOrEqual(t, delay, ceiling, "attempt %d", attempt)
+		}
+	}
+}
+
+func TestRotateKeysRetry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMockServer()
+	defer s.Close()
+
+	// Only a single SDK attempt is made per call, so the retries below are
+	// our own
+	maxAttempts := 1
+	fast := []Option{WithSharedCredentials(false), WithRetryBaseDelay(time.Millisecond), WithRetryMaxDelay(time.Millisecond)}
+	newConfig := func(t *testing.T) *CredentialsConfig {
+		creds, err := s.AddUser(t.Name())
+		require.NoError(t, err)
+		return newMockServerConfig(t, s, creds, WithMaxRetries(&maxAttempts))
+	}
+
+	t.Run("temporary errors", func(t *testing.T) {
+		c := newConfig(t)
+		s.FailNext("GetUser", 1, http.StatusServiceUnavailable, &MockAWSErr{Code: "ServiceUnavailable", Message: "unavailable"})
+		s.FailNext("CreateAccessKey", 2, http.StatusBadRequest, &MockAWSErr{Code: "Throttling", Message: "Rate exceeded"})
+		s.FailNext("DeleteAccessKey", 1, http.StatusInternalServerError, &MockAWSErr{Code: "InternalFailure", Message: "internal"})
+		oldKey := c.AccessKey
+		require.NoError(t, c.RotateKeys(ctx, fast...))
+		assert.NotEqual(t, oldKey, c.AccessKey)
+		keys := s.AccessKeys(t.Name())
+		require.Len(t, keys, 1)
+		assert.Equal(t, c.AccessKey, *keys[0].AccessKeyId)
+	})
+
+	t.Run("transient create", func(t *testing.T) {
+		c := newConfig(t)
+		s.FailNext("CreateAccessKey", 1, http.StatusInternalServerError, &MockAWSErr{Code: "InternalFailure", Message: "internal"})
+		oldKey := c.AccessKey
+		err := c.RotateKeys(ctx, fast...)
+		requireAPIErrorCode(t, err, "InternalFailure")
+		assert.Equal(t, oldKey, c.AccessKey)
+		assert.Len(t, s.AccessKeys(t.Name()), 1)
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		c := newConfig(t)
+		s.FailNext("GetUser", 1, http.StatusBadRequest, &MockAWSErr{Code: "Throttling", Message: "Rate exceeded"})
+		err := c.RotateKeys(ctx, append(fast, WithRetryAttempts(1))...)
+		requireAPIErrorCode(t, err, "Throttling")
+		assert.Equal(t, ErrorCategoryThrottled, ClassifyAWSError(err))
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// RoleHop is one role in a chain of assumed roles. Each hop is assumed using
+// the credentials from the previous one.
+type RoleHop struct {
+	// RoleARN is the role to assume
+	RoleARN string
+
+	// RoleSessionName is the session name to use; if not set the SDK
+	// generates one
+	RoleSessionName string
+
+	// ExternalId is the external ID required by the role's trust policy, if
+	// any
+	ExternalId string
+
+	// Tags are the session tags to pass when assuming the role
+	Tags map[string]string
+
+	// Duration is how long the role's credentials are valid for; if not set
+	// the SDK default is used
+	Duration time.Duration
+}
+
+// chainRoles wraps the credentials of the config in a provider for each hop
+// of the config's RoleChain, in order
+func (c *CredentialsConfig) chainRoles(awsConfig *aws.Config, opts options) error {
+	for i, hop := range c.RoleChain {
+		if hop.RoleARN == "" {
+			return fmt.Errorf("role chain hop %d has no role ARN", i+1)
+		}
+
+		client := sts.NewFromConfig(*awsConfig, func(o *sts.Options) {
+			if c.STSEndpointResolver != nil {
+				o.EndpointResolverV2 = c.STSEndpointResolver
+			}
+		})
+		provider := stscreds.NewAssumeRoleProvider(client, hop.RoleARN, func(options *stscreds.AssumeRoleOptions) {
+			options.RoleSessionName = hop.RoleSessionName
+			if hop.ExternalId != "" {
+				options.ExternalID = aws.String(hop.ExternalId)
+			}
+			for k, v := range hop.Tags {
+				options.Tags = append(options.Tags, types.Tag{
+					Key:   aws.String(k),
+					Value: aws.String(v),
+				})
+			}
+			if hop.Duration != 0 {
+				options.Duration = hop.Duration
+			}
+		})
+
+		awsConfig.Credentials = aws.NewCredentialsCache(&roleHopProvider{
+			provider: provider,
+			c:        c,
+			hop:      i + 1,
+			roleARN:  hop.RoleARN,
+			audit:    opts.withAuditHook,
+		})
+		c.log(hclog.Debug, "added chained assume role provider", "hop", i+1, "roleARN", hop.RoleARN)
+	}
+	return nil
+}
+
+// roleHopProvider logs each time a hop of a role chain is assumed
+type roleHopProvider struct {
+	provider aws.CredentialsProvider
+	c        *CredentialsConfig
+	hop      int
+	roleARN  string
+	audit    AuditHook
+}
+
+var _ aws.CredentialsProvider = (*roleHopProvider)(nil)
+
+// Retrieve implements aws.CredentialsProvider
+func (p *roleHopProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.provider.Retrieve(ctx)
+	emitAuditEvent(ctx, p.audit, AuditEvent{
+		Operation:    AuditOperationAssumeRole,
+		PrincipalArn: p.roleARN,
+		AccessKeyId:  creds.AccessKeyID,
+	}, err)
+	if err != nil {
+		p.c.log(hclog.Error, "error assuming chained role", "hop", p.hop, "roleARN", p.roleARN, "error", err)
+		return aws.Credentials{}, fmt.Errorf("error assuming role %q in hop %d of role chain: %w", p.roleARN, p.hop, err)
+	}
+	p.c.log(hclog.Debug, "assumed chained role", "hop", p.hop, "roleARN", p.roleARN, "AccessKey", creds.AccessKeyID, "expires", creds.Expires)
+	return creds, nil
+}
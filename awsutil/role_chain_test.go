@@ -0,0 +1,125 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleChain(t *testing.T) {
+	ctx := context.Background()
+	const (
+		roleA = "arn:aws:iam::123456789012:role/role-a"
+		roleB = "arn:aws:iam::123456789012:role/role-b"
+	)
+
+	s := NewMockServer()
+	defer s.Close()
+	creds, err := s.AddUser("foouser")
+	require.NoError(t, err)
+	require.NoError(t, s.AddRole(roleA, "ext-a"))
+	require.NoError(t, s.AddRole(roleB, ""))
+
+	t.Run("chain", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		var logs bytes.Buffer
+		c := newMockServerConfig(t, s, creds,
+			WithLogger(hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Debug})),
+			WithRoleChain([]RoleHop{
+				{RoleARN: roleA, RoleSessionName: "hop-a", ExternalId: "ext-a", Tags: map[string]string{"team": "foo"}},
+				{RoleARN: roleB, RoleSessionName: "hop-b", Duration: 15 * time.Minute},
+			}),
+		)
+
+		cid, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		assert.Equal("arn:aws:sts::123456789012:assumed-role/role-b/hop-b", *cid.Arn)
+
+		calls := s.AssumeRoleCalls()
+		require.Len(calls, 2)
+		assert.Equal("arn:aws:iam::123456789012:user/foouser", calls[0].CallerArn)
+		assert.Equal(roleA, calls[0].RoleArn)
+		assert.Equal("ext-a", calls[0].ExternalId)
+		assert.Equal(map[string]string{"team": "foo"}, calls[0].Tags)
+		assert.Equal("arn:aws:sts::123456789012:assumed-role/role-a/hop-a", calls[1].CallerArn)
+		assert.Equal(roleB, calls[1].RoleArn)
+		assert.Empty(calls[1].ExternalId)
+
+		cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		final, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		assert.WithinDuration(time.Now().Add(15*time.Minute), final.Expires, time.Minute)
+
+		for _, hop := range []string{"hop=1 roleARN=" + roleA, "hop=2 roleARN=" + roleB} {
+			assert.Contains(logs.String(), "assumed chained role: "+hop)
+		}
+		assert.NotContains(logs.String(), final.SecretAccessKey)
+	})
+
+	t.Run("hop error", func(t *testing.T) {
+		c := newMockServerConfig(t, s, creds, WithRoleChain([]RoleHop{
+			{RoleARN: roleA, ExternalId: "wrong"},
+		}))
+		_, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fmt.Sprintf("error assuming role %q in hop 1 of role chain", roleA))
+	})
+
+	t.Run("missing role ARN", func(t *testing.T) {
+		_, err := NewCredentialsConfig(WithRoleChain([]RoleHop{{RoleARN: roleA}, {}}))
+		require.EqualError(t, err, "role chain hop 2 has no role ARN")
+
+		c := &CredentialsConfig{RoleChain: []RoleHop{{}}}
+		_, err = c.GenerateCredentialChain(ctx, WithSharedCredentials(false))
+		require.EqualError(t, err, "role chain hop 1 has no role ARN")
+	})
+}
+
+func TestCredentialProcess(t *testing.T) {
+	ctx := context.Background()
+	process := `echo '{"Version": 1, "AccessKeyId": "AKIAPROCESS", "SecretAccessKey": "secret"}'`
+
+	t.Run("config", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		c, err := NewCredentialsConfig(WithCredentialProcess(process))
+		require.NoError(err)
+		cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("AKIAPROCESS", creds.AccessKeyID)
+		assert.Equal("secret", creds.SecretAccessKey)
+	})
+
+	t.Run("shared config", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		configFile := filepath.Join(t.TempDir(), "config")
+		require.NoError(os.WriteFile(configFile, []byte("[profile proc]\ncredential_process = "+process+"\n"), 0o600))
+		t.Setenv("AWS_CONFIG_FILE", configFile)
+		t.Setenv("AWS_PROFILE", "")
+
+		c := &CredentialsConfig{Profile: "proc", Filename: filepath.Join(t.TempDir(), "credentials")}
+		cfg, err := c.GenerateCredentialChain(ctx)
+		require.NoError(err)
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal("AKIAPROCESS", creds.AccessKeyID)
+	})
+
+	t.Run("with static credentials", func(t *testing.T) {
+		_, err := NewCredentialsConfig(WithCredentialProcess(process), WithAccessKey("foo"), WithSecretKey("bar"))
+		require.EqualError(t, err, "credential process specified alongside static credentials")
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
@@ -26,11 +27,13 @@ import (
 //
 // Supported options: WithSharedCredentials, WithAwsConfig
 // WithUsername, WithValidityCheckTimeout, WithIAMAPIFunc,
-// WithSTSAPIFunc
+// WithSTSAPIFunc, WithRetryAttempts, WithRetryBaseDelay, WithRetryMaxDelay,
+// WithAuditHook
 //
 // Note that WithValidityCheckTimeout here, when non-zero, controls the
 // WithValidityCheckTimeout option on access key creation. See CreateAccessKey
-// for more details.
+// for more details. Temporary IAM errors are retried as described on
+// CreateAccessKey and DeleteAccessKey.
 func (c *CredentialsConfig) RotateKeys(ctx context.Context, opt ...Option) error {
 	if c.AccessKey == "" || c.SecretKey == "" {
 		return errors.New("cannot rotate credentials when either access_key or secret_key is empty")
@@ -49,19 +52,33 @@ func (c *CredentialsConfig) RotateKeys(ctx context.Context, opt ...Option) error
 		}
 	}
 
+	event := AuditEvent{
+		Operation:           AuditOperationRotateKeys,
+		UserName:            opts.withUsername,
+		PreviousAccessKeyId: c.AccessKey,
+	}
 	opt = append(opt, WithAwsConfig(cfg))
-	createAccessKeyRes, err := c.CreateAccessKey(ctx, opt...)
+	createAccessKeyRes, user, err := c.createAccessKey(ctx, opt...)
+	if user != nil {
+		event.PrincipalArn, event.UserName = aws.ToString(user.Arn), aws.ToString(user.UserName)
+	}
 	if err != nil {
-		return fmt.Errorf("error calling CreateAccessKey: %w", err)
+		err = fmt.Errorf("error calling CreateAccessKey: %w", err)
+		emitAuditEvent(ctx, opts.withAuditHook, event, err)
+		return err
 	}
 
-	err = c.DeleteAccessKey(ctx, c.AccessKey, append(opt, WithUsername(*createAccessKeyRes.AccessKey.UserName))...)
+	err = c.deleteAccessKey(ctx, c.AccessKey, event.PrincipalArn, append(opt, WithUsername(*createAccessKeyRes.AccessKey.UserName))...)
 	if err != nil {
-		return fmt.Errorf("error deleting old access key: %w", err)
+		err = fmt.Errorf("error deleting old access key: %w", err)
+		emitAuditEvent(ctx, opts.withAuditHook, event, err)
+		return err
 	}
 
 	c.AccessKey = *createAccessKeyRes.AccessKey.AccessKeyId
 	c.SecretKey = *createAccessKeyRes.AccessKey.SecretAccessKey
+	event.AccessKeyId = c.AccessKey
+	emitAuditEvent(ctx, opts.withAuditHook, event, nil)
 
 	return nil
 }
@@ -70,55 +87,89 @@ func (c *CredentialsConfig) RotateKeys(ctx context.Context, opt ...Option) error
 //
 // Supported options: WithSharedCredentials, WithAwsConfig,
 // WithUsername, WithValidityCheckTimeout, WithIAMAPIFunc,
-// WithSTSAPIFunc
+// WithSTSAPIFunc, WithRetryAttempts, WithRetryBaseDelay, WithRetryMaxDelay,
+// WithAuditHook
 //
 // When WithValidityCheckTimeout is non-zero, it specifies a timeout to wait on
-// the created credentials to be valid and ready for use.
+// the created credentials to be valid and ready for use. The check uses the
+// region, STS endpoint resolver, HTTP client and max retries of this config.
+//
+// Looking up the user is retried on temporary errors, as with Retry. Creating
+// the key is only retried when throttled, since after a transient failure the
+// key may have been created anyway.
 func (c *CredentialsConfig) CreateAccessKey(ctx context.Context, opt ...Option) (*iam.CreateAccessKeyOutput, error) {
+	createAccessKeyRes, _, err := c.createAccessKey(ctx, opt...)
+	return createAccessKeyRes, err
+}
+
+// createAccessKey implements CreateAccessKey, also returning the user the key
+// was created for if it was looked up
+func (c *CredentialsConfig) createAccessKey(ctx context.Context, opt ...Option) (_ *iam.CreateAccessKeyOutput, user *iamTypes.User, retErr error) {
 	opts, err := getOpts(opt...)
 	if err != nil {
-		return nil, fmt.Errorf("error reading options in CreateAccessKey: %w", err)
+		return nil, nil, fmt.Errorf("error reading options in CreateAccessKey: %w", err)
 	}
 
+	event := AuditEvent{
+		Operation: AuditOperationCreateAccessKey,
+		UserName:  opts.withUsername,
+	}
+	defer func() {
+		emitAuditEvent(ctx, opts.withAuditHook, event, retErr)
+	}()
+
 	client, err := c.IAMClient(ctx, opt...)
 	if err != nil {
-		return nil, fmt.Errorf("error loading IAM client: %w", err)
+		return nil, nil, fmt.Errorf("error loading IAM client: %w", err)
 	}
 
 	var getUserInput iam.GetUserInput
 	if opts.withUsername != "" {
 		getUserInput.UserName = aws.String(opts.withUsername)
 	} // otherwise, empty input means get current user
-	getUserRes, err := client.GetUser(ctx, &getUserInput)
+	var getUserRes *iam.GetUserOutput
+	err = retryWithBackoff(ctx, opts, c.Logger, IsTemporaryAWSError, func(ctx context.Context) error {
+		var err error
+		getUserRes, err = client.GetUser(ctx, &getUserInput)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error calling iam.GetUser: %w", err)
+		return nil, nil, fmt.Errorf("error calling iam.GetUser: %w", err)
 	}
 	if getUserRes == nil {
-		return nil, fmt.Errorf("nil response from iam.GetUser")
+		return nil, nil, fmt.Errorf("nil response from iam.GetUser")
 	}
 	if getUserRes.User == nil {
-		return nil, fmt.Errorf("nil user returned from iam.GetUser")
+		return nil, nil, fmt.Errorf("nil user returned from iam.GetUser")
 	}
 	if getUserRes.User.UserName == nil {
-		return nil, fmt.Errorf("nil UserName returned from iam.GetUser")
+		return nil, nil, fmt.Errorf("nil UserName returned from iam.GetUser")
 	}
+	user = getUserRes.User
+	event.PrincipalArn, event.UserName = aws.ToString(user.Arn), *user.UserName
 
 	createAccessKeyInput := iam.CreateAccessKeyInput{
 		UserName: getUserRes.User.UserName,
 	}
-	createAccessKeyRes, err := client.CreateAccessKey(ctx, &createAccessKeyInput)
+	var createAccessKeyRes *iam.CreateAccessKeyOutput
+	err = retryWithBackoff(ctx, opts, c.Logger, isThrottledAWSError, func(ctx context.Context) error {
+		var err error
+		createAccessKeyRes, err = client.CreateAccessKey(ctx, &createAccessKeyInput)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error calling iam.CreateAccessKey: %w", err)
+		return nil, user, fmt.Errorf("error calling iam.CreateAccessKey: %w", err)
 	}
 	if createAccessKeyRes == nil {
-		return nil, fmt.Errorf("nil response from iam.CreateAccessKey")
+		return nil, user, fmt.Errorf("nil response from iam.CreateAccessKey")
 	}
 	if createAccessKeyRes.AccessKey == nil {
-		return nil, fmt.Errorf("nil access key in response from iam.CreateAccessKey")
+		return nil, user, fmt.Errorf("nil access key in response from iam.CreateAccessKey")
 	}
 	if createAccessKeyRes.AccessKey.AccessKeyId == nil || createAccessKeyRes.AccessKey.SecretAccessKey == nil {
-		return nil, fmt.Errorf("nil AccessKeyId or SecretAccessKey returned from iam.CreateAccessKey")
+		return nil, user, fmt.Errorf("nil AccessKeyId or SecretAccessKey returned from iam.CreateAccessKey")
 	}
+	event.AccessKeyId = *createAccessKeyRes.AccessKey.AccessKeyId
 
 	// Check the credentials to make sure they are usable. We only do
 	// this if withValidityCheckTimeout is non-zero to ensue that we don't
@@ -128,9 +179,12 @@ func (c *CredentialsConfig) CreateAccessKey(ctx context.Context, opt ...Option)
 			WithAccessKey(*createAccessKeyRes.AccessKey.AccessKeyId),
 			WithSecretKey(*createAccessKeyRes.AccessKey.SecretAccessKey),
 			WithRegion(c.Region),
+			WithStsEndpointResolver(c.STSEndpointResolver),
+			WithHttpClient(c.HTTPClient),
+			WithMaxRetries(c.MaxRetries),
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create credential config with new static credential: %w", err)
+			return nil, user, fmt.Errorf("failed to create credential config with new static credential: %w", err)
 		}
 
 		if _, err := newStaticCreds.GetCallerIdentity(
@@ -138,22 +192,41 @@ func (c *CredentialsConfig) CreateAccessKey(ctx context.Context, opt ...Option)
 			WithValidityCheckTimeout(opts.withValidityCheckTimeout),
 			WithSTSAPIFunc(opts.withSTSAPIFunc),
 		); err != nil {
-			return nil, fmt.Errorf("error verifying new credentials: %w", err)
+			return nil, user, fmt.Errorf("error verifying new credentials: %w", err)
 		}
 	}
 
-	return createAccessKeyRes, nil
+	return createAccessKeyRes, user, nil
 }
 
 // DeleteAccessKey deletes an access key.
 //
-// Supported options: WithSharedCredentials, WithAwsConfig, WithUserName, WithIAMAPIFunc
+// Supported options: WithSharedCredentials, WithAwsConfig, WithUserName, WithIAMAPIFunc,
+// WithRetryAttempts, WithRetryBaseDelay, WithRetryMaxDelay, WithAuditHook
+//
+// Temporary errors are retried as with Retry. If a retry finds the key no
+// longer exists, an earlier attempt is assumed to have deleted it.
 func (c *CredentialsConfig) DeleteAccessKey(ctx context.Context, accessKeyId string, opt ...Option) error {
+	return c.deleteAccessKey(ctx, accessKeyId, "", opt...)
+}
+
+// deleteAccessKey implements DeleteAccessKey, reporting the given principal
+// ARN, if known, in its audit event
+func (c *CredentialsConfig) deleteAccessKey(ctx context.Context, accessKeyId, principalArn string, opt ...Option) (retErr error) {
 	opts, err := getOpts(opt...)
 	if err != nil {
 		return fmt.Errorf("error reading options in RotateKeys: %w", err)
 	}
 
+	defer func() {
+		emitAuditEvent(ctx, opts.withAuditHook, AuditEvent{
+			Operation:    AuditOperationDeleteAccessKey,
+			PrincipalArn: principalArn,
+			UserName:     opts.withUsername,
+			AccessKeyId:  accessKeyId,
+		}, retErr)
+	}()
+
 	client, err := c.IAMClient(ctx, opt...)
 	if err != nil {
 		return fmt.Errorf("error loading IAM client: %w", err)
@@ -166,7 +239,15 @@ func (c *CredentialsConfig) DeleteAccessKey(ctx context.Context, accessKeyId str
 		deleteAccessKeyInput.UserName = aws.String(opts.withUsername)
 	}
 
-	_, err = client.DeleteAccessKey(ctx, &deleteAccessKeyInput)
+	var attempt int
+	err = retryWithBackoff(ctx, opts, c.Logger, IsTemporaryAWSError, func(ctx context.Context) error {
+		attempt++
+		_, err := client.DeleteAccessKey(ctx, &deleteAccessKeyInput)
+		if attempt > 1 && ClassifyAWSError(err) == ErrorCategoryNotFound {
+			return nil
+		}
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting old access key: %w", err)
 	}
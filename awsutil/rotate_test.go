@@ -7,8 +7,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -256,6 +258,47 @@ func TestCreateAccessKeyWithIAMAndSTSMockGetCallerIdentityError(t *testing.T) {
 	require.EqualError(err, expectedErr)
 }
 
+// recordingTransport records the requests made through it
+type recordingTransport struct {
+	l        sync.Mutex
+	requests []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.l.Lock()
+	rt.requests = append(rt.requests, r)
+	rt.l.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestCreateAccessKeyValidityCheckUsesConfig(t *testing.T) {
+	require, assert := require.New(t), assert.New(t)
+	s := NewMockServer()
+	defer s.Close()
+	creds, err := s.AddUser("foouser")
+	require.NoError(err)
+
+	// The new key is checked against the configured STS endpoint with the
+	// configured HTTP client
+	rt := new(recordingTransport)
+	c := newMockServerConfig(t, s, creds, WithHttpClient(&http.Client{Transport: rt}))
+	out, err := c.CreateAccessKey(context.Background(), WithSharedCredentials(false), WithValidityCheckTimeout(5*time.Second))
+	require.NoError(err)
+	newKeyId := *out.AccessKey.AccessKeyId
+
+	rt.l.Lock()
+	defer rt.l.Unlock()
+	var checked bool
+	for _, r := range rt.requests {
+		if strings.Contains(r.Header.Get("Authorization"), "Credential="+newKeyId+"/") {
+			assert.Equal(s.URL(), "http://"+r.URL.Host)
+			assert.Contains(r.Header.Get("Authorization"), "/sts/")
+			checked = true
+		}
+	}
+	assert.True(checked, "no request signed with the new key")
+}
+
 func TestCreateAccessKeyNilResponse(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,145 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/hashicorp/go-hclog"
+)
+
+// WebIdentityRefreshError is returned when credentials for a web identity role
+// cannot be obtained, either because the token could not be read or because
+// STS rejected it
+type WebIdentityRefreshError struct {
+	// RoleARN is the role being assumed
+	RoleARN string
+	// TokenFile is the token file in use, if any
+	TokenFile string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *WebIdentityRefreshError) Error() string {
+	if e.TokenFile != "" {
+		return fmt.Sprintf("error refreshing web identity credentials for role %q using token file %q: %v", e.RoleARN, e.TokenFile, e.Err)
+	}
+	return fmt.Sprintf("error refreshing web identity credentials for role %q: %v", e.RoleARN, e.Err)
+}
+
+func (e *WebIdentityRefreshError) Unwrap() error {
+	return e.Err
+}
+
+// webIdentityTokenFile reads a web identity token from a file, such as a
+// Kubernetes projected service account token, re-reading it only when the
+// file's modification time or size changes
+type webIdentityTokenFile struct {
+	path string
+	c    *CredentialsConfig
+
+	l       sync.Mutex
+	token   []byte
+	modTime time.Time
+	size    int64
+}
+
+var _ stscreds.IdentityTokenRetriever = (*webIdentityTokenFile)(nil)
+
+// GetIdentityToken implements stscreds.IdentityTokenRetriever
+func (f *webIdentityTokenFile) GetIdentityToken() ([]byte, error) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading web identity token file: %w", err)
+	}
+	if f.token != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	token, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading web identity token file: %w", err)
+	}
+	if f.token != nil {
+		f.c.log(hclog.Debug, "web identity token file changed", "path", f.path)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return token, nil
+}
+
+// webIdentityProvider returns a provider that assumes the config's role using
+// its web identity token or token file, refreshing the credentials once they
+// are within the refresh window of expiring
+func (c *CredentialsConfig) webIdentityProvider(awsConfig aws.Config, opts options) aws.CredentialsProvider {
+	var retriever stscreds.IdentityTokenRetriever = FetchTokenContents(c.WebIdentityToken)
+	if c.WebIdentityTokenFile != "" {
+		retriever = &webIdentityTokenFile{path: c.WebIdentityTokenFile, c: c}
+	}
+
+	client := sts.NewFromConfig(awsConfig, func(o *sts.Options) {
+		if c.STSEndpointResolver != nil {
+			o.EndpointResolverV2 = c.STSEndpointResolver
+		}
+	})
+	provider := stscreds.NewWebIdentityRoleProvider(client, c.RoleARN, retriever, func(o *stscreds.WebIdentityRoleOptions) {
+		o.RoleSessionName = c.RoleSessionName
+	})
+
+	refreshWindow := opts.withRefreshWindow
+	if refreshWindow == 0 {
+		refreshWindow = DefaultCredentialsRefreshWindow
+	}
+	return aws.NewCredentialsCache(&webIdentityRefresher{
+		provider: provider,
+		c:        c,
+		audit:    opts.withAuditHook,
+	}, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = refreshWindow
+	})
+}
+
+// webIdentityRefresher logs each assumption of a web identity role and
+// converts failures into a WebIdentityRefreshError
+type webIdentityRefresher struct {
+	provider aws.CredentialsProvider
+	c        *CredentialsConfig
+	audit    AuditHook
+}
+
+var _ aws.CredentialsProvider = (*webIdentityRefresher)(nil)
+
+// Retrieve implements aws.CredentialsProvider
+func (p *webIdentityRefresher) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.provider.Retrieve(ctx)
+	emitAuditEvent(ctx, p.audit, AuditEvent{
+		Operation:    AuditOperationAssumeRoleWithWebIdentity,
+		PrincipalArn: p.c.RoleARN,
+		AccessKeyId:  creds.AccessKeyID,
+	}, err)
+	if err != nil {
+		p.c.log(hclog.Error, "error assuming web identity role", "roleARN", p.c.RoleARN, "error", err)
+		var refreshErr *WebIdentityRefreshError
+		if errors.As(err, &refreshErr) {
+			return aws.Credentials{}, err
+		}
+		return aws.Credentials{}, &WebIdentityRefreshError{
+			RoleARN:   p.c.RoleARN,
+			TokenFile: p.c.WebIdentityTokenFile,
+			Err:       err,
+		}
+	}
+	p.c.log(hclog.Debug, "assumed web identity role", "roleARN", p.c.RoleARN, "expires", creds.Expires)
+	return creds, nil
+}
@@ -0,0 +1,194 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package awsutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebIdentityTokenFile(t *testing.T) {
+	ctx := context.Background()
+	const roleArn = "arn:aws:iam::123456789012:role/web"
+
+	s := NewMockServer()
+	defer s.Close()
+	require.NoError(t, s.AddRole(roleArn, ""))
+	s.AddWebIdentityToken("token-1")
+	s.AddWebIdentityToken("token-2")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeToken := func(t *testing.T, token string, modTime time.Time) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(tokenFile, []byte(token), 0o600))
+		require.NoError(t, os.Chtimes(tokenFile, modTime, modTime))
+	}
+	newConfig := func(t *testing.T, logs *bytes.Buffer) *CredentialsConfig {
+		t.Helper()
+		c, err := NewCredentialsConfig(
+			WithRegion("us-east-1"),
+			WithStsEndpointResolver(s.STSEndpointResolver()),
+			WithRoleArn(roleArn),
+			WithRoleSessionName("web-session"),
+			WithWebIdentityTokenFile(tokenFile),
+			WithLogger(hclog.New(&hclog.LoggerOptions{Output: logs, Level: hclog.Debug})),
+		)
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		var logs bytes.Buffer
+		start := time.Now().Add(-time.Hour)
+		writeToken(t, "token-1", start)
+
+		// With a refresh window longer than the session, every retrieval
+		// re-assumes the role
+		cfg, err := newConfig(t, &logs).GenerateCredentialChain(ctx, WithSharedCredentials(false), WithRefreshWindow(2*time.Hour))
+		require.NoError(err)
+		first, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+
+		writeToken(t, "token-2", start.Add(time.Minute))
+		second, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		assert.NotEqual(first.AccessKeyID, second.AccessKeyID)
+
+		calls := s.AssumeRoleCalls()
+		require.GreaterOrEqual(len(calls), 2)
+		assert.Equal("token-1", calls[len(calls)-2].WebIdentityToken)
+		assert.Equal("token-2", calls[len(calls)-1].WebIdentityToken)
+		assert.Equal("web-session", calls[len(calls)-1].RoleSessionName)
+		assert.Contains(logs.String(), "web identity token file changed")
+	})
+
+	t.Run("refresh window", func(t *testing.T) {
+		require, assert := require.New(t), assert.New(t)
+		writeToken(t, "token-1", time.Now())
+
+		// Outside the default window the cached credentials are reused
+		cfg, err := newConfig(t, new(bytes.Buffer)).GenerateCredentialChain(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		first, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		second, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(err)
+		assert.Equal(first.AccessKeyID, second.AccessKeyID)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			token     string
+			removed   bool
+			errSubstr string
+		}{
+			{
+				name:      "rejected token",
+				token:     "invalid",
+				errSubstr: "InvalidIdentityToken",
+			},
+			{
+				name:      "missing file",
+				removed:   true,
+				errSubstr: "error reading web identity token file",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				require, assert := require.New(t), assert.New(t)
+				writeToken(t, tc.token, time.Now())
+				if tc.removed {
+					require.NoError(os.Remove(tokenFile))
+				}
+
+				var logs bytes.Buffer
+				cfg, err := newConfig(t, &logs).GenerateCredentialChain(ctx, WithSharedCredentials(false))
+				require.NoError(err)
+				_, err = cfg.Credentials.Retrieve(ctx)
+				require.Error(err)
+
+				var refreshErr *WebIdentityRefreshError
+				require.True(errors.As(err, &refreshErr))
+				assert.Equal(roleArn, refreshErr.RoleARN)
+				assert.Equal(tokenFile, refreshErr.TokenFile)
+				assert.Contains(refreshErr.Error(), tc.errSubstr)
+				assert.Contains(logs.String(), "error assuming web identity role")
+			})
+		}
+	})
+
+	t.Run("token contents", func(t *testing.T) {
+		require := require.New(t)
+		c, err := NewCredentialsConfig(
+			WithRegion("us-east-1"),
+			WithStsEndpointResolver(s.STSEndpointResolver()),
+			WithRoleArn(roleArn),
+			WithRoleSessionName("web-session"),
+			WithWebIdentityToken("token-2"),
+		)
+		require.NoError(err)
+		cid, err := c.GetCallerIdentity(ctx, WithSharedCredentials(false))
+		require.NoError(err)
+		require.Equal("arn:aws:sts::123456789012:assumed-role/web/web-session", *cid.Arn)
+	})
+
+	t.Run("overrides other credentials", func(t *testing.T) {
+		writeToken(t, "token-1", time.Now())
+		sharedFile := filepath.Join(t.TempDir(), "credentials")
+		require.NoError(t, os.WriteFile(sharedFile, []byte("[default]\naws_access_key_id = shared-key\naws_secret_access_key = shared-secret\n"), 0o600))
+		process := `echo '{"Version": 1, "AccessKeyId": "process-key", "SecretAccessKey": "process-secret"}'`
+
+		// A role with a token takes precedence over static, credential
+		// process and shared profile credentials
+		cases := map[string][]Option{
+			"static":  {WithAccessKey("static-key"), WithSecretKey("static-secret")},
+			"process": {WithCredentialProcess(process)},
+			"shared":  nil,
+		}
+		for name, extra := range cases {
+			t.Run(name, func(t *testing.T) {
+				require, assert := require.New(t), assert.New(t)
+				c, err := NewCredentialsConfig(append([]Option{
+					WithRegion("us-east-1"),
+					WithStsEndpointResolver(s.STSEndpointResolver()),
+					WithRoleArn(roleArn),
+					WithRoleSessionName("web-session"),
+					WithWebIdentityTokenFile(tokenFile),
+				}, extra...)...)
+				require.NoError(err)
+				c.Filename = sharedFile
+				c.Profile = "default"
+
+				cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(true))
+				require.NoError(err)
+				creds, err := cfg.Credentials.Retrieve(ctx)
+				require.NoError(err)
+				assert.NotContains([]string{"static-key", "process-key", "shared-key"}, creds.AccessKeyID)
+				calls := s.AssumeRoleCalls()
+				assert.Equal("token-1", calls[len(calls)-1].WebIdentityToken)
+			})
+		}
+
+		// Only an explicit credentials provider overrides it
+		c := newConfig(t, new(bytes.Buffer))
+		cfg, err := c.GenerateCredentialChain(ctx, WithSharedCredentials(false),
+			WithCredentialsProvider(credentials.NewStaticCredentialsProvider("explicit-key", "explicit-secret", "")))
+		require.NoError(t, err)
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "explicit-key", creds.AccessKeyID)
+	})
+}
@@ -0,0 +1,226 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Command configcrypt encrypts and decrypts parameters within a configuration
+// file, using the kms blocks from a configuration file.
+//
+// Values to be encrypted are marked as {{encrypt(value)}}; once encrypted they
+// become {{decrypt(ciphertext)}}, which configutil.ParseConfig decrypts when
+// given WithDecryptionWrapper. By default the kms blocks with the "config"
+// purpose are used. When there are several, values are encrypted with the
+// highest-priority kms and decrypted with whichever kms matches their key ID.
+//
+// Usage:
+//
+//	configcrypt [options] <encrypt|decrypt|strip|rotate> <file>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-kms-wrapping/v2/aead"
+	"github.com/hashicorp/go-secure-stdlib/configutil/v2"
+	"github.com/hashicorp/go-secure-stdlib/pluginutil/v2"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const usage = `Usage: configcrypt [options] <operation> <file>
+
+Operations:
+  encrypt  Encrypt {{encrypt(...)}} parameters, replacing them with
+           {{decrypt(...)}}
+  decrypt  Decrypt {{decrypt(...)}} parameters, replacing them with
+           {{encrypt(...)}} so they can be edited and encrypted again
+  strip    Decrypt {{decrypt(...)}} parameters, replacing them with the
+           plaintext value
+  rotate   Decrypt {{decrypt(...)}} parameters and encrypt them again with
+           the highest-priority kms
+
+The kms type "aead" is available without a plugin; other types must specify
+plugin_path and plugin_checksum in their kms block.
+
+Options:
+`
+
+// operations maps each operation to the transformation it performs
+var operations = map[string]func(string, *configutil.MultiWrapper) (string, error){
+	"encrypt": func(raw string, w *configutil.MultiWrapper) (string, error) {
+		return configutil.EncryptDecrypt(raw, false, false, w)
+	},
+	"decrypt": func(raw string, w *configutil.MultiWrapper) (string, error) {
+		return configutil.EncryptDecrypt(raw, true, false, w)
+	},
+	"strip": func(raw string, w *configutil.MultiWrapper) (string, error) {
+		return configutil.EncryptDecrypt(raw, true, true, w)
+	},
+	"rotate": func(raw string, w *configutil.MultiWrapper) (string, error) {
+		decrypted, err := configutil.EncryptDecrypt(raw, true, false, w)
+		if err != nil {
+			return "", err
+		}
+		return configutil.EncryptDecrypt(decrypted, false, false, w)
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 on
+// error and 2 on invalid usage
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("configcrypt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	kmsConfig := flags.String("kms-config", "", "The file containing the kms blocks to use. Defaults to the target file.")
+	purpose := flags.String("purpose", "config", "The purpose of the kms blocks to use.")
+	inPlace := flags.Bool("w", false, "Write the result to the target file instead of stdout.")
+	dryRun := flags.Bool("dry-run", false, "Print a diff of the changes to stdout instead of writing them.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	op, target := flags.Arg(0), flags.Arg(1)
+	transform, ok := operations[op]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown operation %q\n", op)
+		flags.Usage()
+		return 2
+	}
+	if *kmsConfig == "" {
+		*kmsConfig = target
+	}
+
+	if err := execute(transform, target, *kmsConfig, *purpose, *inPlace, *dryRun, stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func execute(
+	transform func(string, *configutil.MultiWrapper) (string, error),
+	target, kmsConfig, purpose string,
+	inPlace, dryRun bool,
+	stdout, stderr io.Writer,
+) error {
+	ctx := context.Background()
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "configcrypt",
+		Output: stderr,
+		Level:  hclog.Warn,
+	})
+
+	kmses, err := configutil.LoadConfigKMSes(kmsConfig)
+	if err != nil {
+		return fmt.Errorf("error loading kms blocks from %s: %w", kmsConfig, err)
+	}
+	var matching []*configutil.KMS
+	for _, k := range kmses {
+		for _, p := range k.Purpose {
+			if p == purpose {
+				matching = append(matching, k)
+				break
+			}
+		}
+	}
+	if len(matching) == 0 {
+		return fmt.Errorf("no kms blocks with purpose %q found in %s", purpose, kmsConfig)
+	}
+
+	wrapper, cleanup, err := configutil.NewMultiWrapper(ctx, matching,
+		configutil.WithLogger(logger),
+		configutil.WithPluginOptions(
+			pluginutil.WithPluginsMap(map[string]pluginutil.InmemCreationFunc{
+				"aead": func() (interface{}, error) {
+					return aead.NewWrapper(), nil
+				},
+			}),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("error configuring kms: %w", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			logger.Warn("error cleaning up kms", "error", err)
+		}
+	}()
+
+	raw, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	out, err := transform(string(raw), wrapper)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case dryRun:
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(raw)),
+			B:        difflib.SplitLines(out),
+			FromFile: target,
+			ToFile:   target,
+			Context:  3,
+		})
+		if err != nil {
+			return fmt.Errorf("error generating diff: %w", err)
+		}
+		_, err = io.WriteString(stdout, diff)
+		return err
+
+	case inPlace:
+		return writeFile(target, out)
+
+	default:
+		_, err = io.WriteString(stdout, out)
+		return err
+	}
+}
+
+// writeFile atomically replaces the contents of the file, keeping its
+// permissions
+func writeFile(path, contents string) (retErr error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer func() {
+		if retErr != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.WriteString(contents); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error setting permissions on temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
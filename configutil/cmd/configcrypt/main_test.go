@@ -0,0 +1,194 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTarget = `cluster_name = "{{encrypt(foo)}}"
+pid_file = "/var/run/app.pid"
+`
+
+func testKmsBlock(t *testing.T, keyId string, priority int) string {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return fmt.Sprintf(`
+kms "aead" {
+	purpose = "config"
+	priority = %d
+	aead_type = "aes-gcm"
+	key = "%s"
+	key_id = "%s"
+}
+`, priority, base64.StdEncoding.EncodeToString(key), keyId)
+}
+
+func runCmd(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	oldKms := testKmsBlock(t, "old", 2)
+	newKms := testKmsBlock(t, "new", 1)
+	kmsFile := filepath.Join(dir, "kms.hcl")
+	require.NoError(t, os.WriteFile(kmsFile, []byte(oldKms), 0o600))
+	target := filepath.Join(dir, "config.hcl")
+	require.NoError(t, os.WriteFile(target, []byte(testTarget), 0o640))
+
+	t.Run("usage", func(t *testing.T) {
+		assert := assert.New(t)
+		code, _, stderr := runCmd(t)
+		assert.Equal(2, code)
+		assert.Contains(stderr, "Usage: configcrypt")
+
+		code, _, stderr = runCmd(t, "frobnicate", target)
+		assert.Equal(2, code)
+		assert.Contains(stderr, `unknown operation "frobnicate"`)
+
+		code, _, _ = runCmd(t, "-bogus", "encrypt", target)
+		assert.Equal(2, code)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+		code, _, stderr := runCmd(t, "-kms-config", kmsFile, "-purpose", "root", "encrypt", target)
+		assert.Equal(1, code)
+		assert.Contains(stderr, `no kms blocks with purpose "root"`)
+
+		code, _, stderr = runCmd(t, "encrypt", target)
+		assert.Equal(1, code)
+		assert.Contains(stderr, `no kms blocks with purpose "config"`)
+
+		code, _, stderr = runCmd(t, "-kms-config", kmsFile, "encrypt", filepath.Join(dir, "missing.hcl"))
+		assert.Equal(1, code)
+		assert.Contains(stderr, "no such file")
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		assert := assert.New(t)
+		code, stdout, stderr := runCmd(t, "-kms-config", kmsFile, "-w", "-dry-run", "encrypt", target)
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(stdout, "--- "+target)
+		assert.Contains(stdout, `-cluster_name = "{{encrypt(foo)}}"`)
+		assert.Contains(stdout, `+cluster_name = "{{decrypt(`)
+		assert.Contains(stdout, "\n pid_file")
+
+		contents, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(testTarget, string(contents))
+	})
+
+	t.Run("round-trip", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+
+		// Encrypt to stdout leaves the file untouched
+		code, stdout, stderr := runCmd(t, "-kms-config", kmsFile, "encrypt", target)
+		require.Equal(0, code, stderr)
+		assert.Contains(stdout, `cluster_name = "{{decrypt(`)
+		assert.Contains(stdout, `pid_file = "/var/run/app.pid"`)
+		contents, err := os.ReadFile(target)
+		require.NoError(err)
+		assert.Equal(testTarget, string(contents))
+
+		// Encrypt in place
+		code, stdout, stderr = runCmd(t, "-kms-config", kmsFile, "-w", "encrypt", target)
+		require.Equal(0, code, stderr)
+		assert.Empty(stdout)
+		encrypted, err := os.ReadFile(target)
+		require.NoError(err)
+		assert.Contains(string(encrypted), `cluster_name = "{{decrypt(`)
+		info, err := os.Stat(target)
+		require.NoError(err)
+		assert.Equal(os.FileMode(0o640), info.Mode().Perm())
+
+		// Decrypt restores the original markers
+		code, stdout, stderr = runCmd(t, "-kms-config", kmsFile, "decrypt", target)
+		require.Equal(0, code, stderr)
+		assert.Equal(testTarget, stdout)
+
+		// Strip removes the markers entirely
+		code, stdout, stderr = runCmd(t, "-kms-config", kmsFile, "strip", target)
+		require.Equal(0, code, stderr)
+		assert.Equal("cluster_name = \"foo\"\npid_file = \"/var/run/app.pid\"\n", stdout)
+
+		// Rotate to the new, higher-priority kms
+		require.NoError(os.WriteFile(kmsFile, []byte(oldKms+newKms), 0o600))
+		code, _, stderr = runCmd(t, "-kms-config", kmsFile, "-w", "rotate", target)
+		require.Equal(0, code, stderr)
+		rotated, err := os.ReadFile(target)
+		require.NoError(err)
+		assert.NotEqual(string(encrypted), string(rotated))
+
+		// Once rotated, the old kms is no longer needed
+		require.NoError(os.WriteFile(kmsFile, []byte(newKms), 0o600))
+		code, stdout, stderr = runCmd(t, "-kms-config", kmsFile, "decrypt", target)
+		require.Equal(0, code, stderr)
+		assert.Equal(testTarget, stdout)
+	})
+
+	t.Run("kms-in-target", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		combined := filepath.Join(dir, "combined.hcl")
+		require.NoError(os.WriteFile(combined, []byte(testTarget+newKms), 0o600))
+
+		code, _, stderr := runCmd(t, "-w", "encrypt", combined)
+		require.Equal(0, code, stderr)
+		code, stdout, stderr := runCmd(t, "strip", combined)
+		require.Equal(0, code, stderr)
+		assert.Contains(stdout, `cluster_name = "foo"`)
+	})
+}
+
+func TestRunFilePlugin(t *testing.T) {
+	pluginPath := os.Getenv("PLUGIN_PATH")
+	if pluginPath == "" {
+		t.Skipf("skipping plugin test as no PLUGIN_PATH specified")
+	}
+	assert, require := assert.New(t), require.New(t)
+
+	pluginBytes, err := os.ReadFile(pluginPath)
+	require.NoError(err)
+	sha2256Bytes := sha256.Sum256(pluginBytes)
+
+	dir := t.TempDir()
+	kmsFile := filepath.Join(dir, "kms.hcl")
+	require.NoError(os.WriteFile(kmsFile, []byte(fmt.Sprintf(`
+		kms "aead" {
+			purpose = "config"
+			key_id = "plugin"
+			plugin_path = "%s"
+			plugin_checksum = "%s"
+		}
+		`, pluginPath, hex.EncodeToString(sha2256Bytes[:]))), 0o600))
+	target := filepath.Join(dir, "config.hcl")
+	require.NoError(os.WriteFile(target, []byte(testTarget), 0o600))
+
+	code, _, stderr := runCmd(t, "-kms-config", kmsFile, "-w", "encrypt", target)
+	require.Equal(0, code, stderr)
+	encrypted, err := os.ReadFile(target)
+	require.NoError(err)
+	assert.Contains(string(encrypted), `cluster_name = "{{decrypt(`)
+
+	code, stdout, stderr := runCmd(t, "-kms-config", kmsFile, "decrypt", target)
+	require.Equal(0, code, stderr)
+	assert.Equal(testTarget, stdout)
+}
@@ -53,19 +53,26 @@ type SharedConfig struct {
 	PidFile string `hcl:"pid_file"`
 
 	ClusterName string `hcl:"cluster_name"`
+
+	// sourceFile and provenance are populated when parsing with
+	// WithProvenance
+	sourceFile string                 `hcl:"-"`
+	provenance map[string]*Provenance `hcl:"-"`
 }
 
 // LoadConfigFile loads the configuration from the given file.
 // Supported options:
 //   - WithMaxKmsBlocks
 //   - WithListenerOptions
+//   - WithProvenance
+//   - WithDecryptionWrapper
 func LoadConfigFile(path string, opt ...Option) (*SharedConfig, error) {
 	// Read the file
 	d, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return ParseConfig(string(d), opt...)
+	return ParseConfig(string(d), append(append([]Option(nil), opt...), withSourceFile(path))...)
 }
 
 // LoadConfigKMSes loads KMS configuration from the provided path.
@@ -84,14 +91,23 @@ func LoadConfigKMSes(path string, opt ...Option) ([]*KMS, error) {
 // Supported options:
 //   - WithMaxKmsBlocks
 //   - WithListenerOptions
+//   - WithProvenance
+//   - WithDecryptionWrapper
 func ParseConfig(d string, opt ...Option) (*SharedConfig, error) {
-	// Parse!
-	obj, err := hcl.Parse(d)
+	opts, err := getOpts(opt...)
 	if err != nil {
 		return nil, err
 	}
 
-	opts, err := getOpts(opt...)
+	var lines *configLines
+	if opts.withDecryptionWrapper != nil {
+		if d, lines, err = decryptConfig(d, opts.withDecryptionWrapper); err != nil {
+			return nil, fmt.Errorf("error decrypting config: %w", err)
+		}
+	}
+
+	// Parse!
+	obj, err := hcl.Parse(d)
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +173,10 @@ func ParseConfig(d string, opt ...Option) (*SharedConfig, error) {
 		return nil, fmt.Errorf("error parsing enterprise config: %w", err)
 	}
 
+	if opts.withProvenance {
+		result.recordProvenance(list, opts.withSourceFile, lines)
+	}
+
 	return &result, nil
 }
 
@@ -167,54 +187,9 @@ func ParseConfig(d string, opt ...Option) (*SharedConfig, error) {
 // Specifically, the fields that this method strips are:
 // - KMS.Config
 // - Telemetry.CirconusAPIToken
+//
+// To include some KMS.Config values, or to redact listener values, use
+// SanitizedWithPolicy.
 func (c *SharedConfig) Sanitized() map[string]interface{} {
-	if c == nil {
-		return nil
-	}
-
-	result := map[string]interface{}{
-		"disable_mlock": c.DisableMlock,
-
-		"default_max_request_duration": c.DefaultMaxRequestDuration,
-
-		"log_level":  c.LogLevel,
-		"log_format": c.LogFormat,
-
-		"pid_file": c.PidFile,
-
-		"cluster_name": c.ClusterName,
-	}
-
-	// Sanitize listeners
-	if len(c.Listeners) != 0 {
-		var sanitizedListeners []interface{}
-		for _, ln := range c.Listeners {
-			cleanLn := map[string]interface{}{
-				"type":   ln.Type,
-				"config": ln.RawConfig,
-			}
-			sanitizedListeners = append(sanitizedListeners, cleanLn)
-		}
-		result["listeners"] = sanitizedListeners
-	}
-
-	// Sanitize seals stanza
-	if len(c.Seals) != 0 {
-		var sanitizedSeals []interface{}
-		for _, s := range c.Seals {
-			cleanSeal := map[string]interface{}{
-				"type":     s.Type,
-				"disabled": s.Disabled,
-			}
-			sanitizedSeals = append(sanitizedSeals, cleanSeal)
-		}
-		result["seals"] = sanitizedSeals
-	}
-
-	// Sanitize telemetry stanza
-	if c.Telemetry != nil {
-		result["telemetry"] = SanitizeTelemetry(c.Telemetry)
-	}
-
-	return result
+	return c.SanitizedWithPolicy(nil)
 }
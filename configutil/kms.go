@@ -52,6 +52,11 @@ type KMS struct {
 	// deprecated in favor of using purposes.
 	Disabled bool
 
+	// Priority can be used to order KMSes when more than one is configured for
+	// the same purpose, e.g. by NewMultiWrapper. Lower values are higher
+	// priority; zero means unspecified and sorts after any explicit priority.
+	Priority int
+
 	// PluginPath can be used, if using a file on disk as a wrapper plugin, to
 	// specify a path to the file. This can also be specified via pluginutil
 	// options from the application.
@@ -67,6 +72,19 @@ type KMS struct {
 	// Empty will default to "sha2-256".
 	PluginHashMethod string `hcl:"plugin_hash_method"`
 
+	// PluginContainerImage can be used, as an alternative to PluginPath, to run
+	// the wrapper plugin inside a container using the given image (without the
+	// tag). PluginContainerSHA256 is required when specifying an image so that,
+	// as with PluginChecksum, the exact plugin that is run is pinned. Settings
+	// for the container runtime itself can be provided via
+	// WithPluginContainerConfig.
+	PluginContainerImage string `hcl:"plugin_container_image"`
+	// PluginContainerTag is the optional tag of the image to run
+	PluginContainerTag string `hcl:"plugin_container_tag"`
+	// PluginContainerSHA256 is the hex-encoded SHA256 digest of the image,
+	// optionally prefixed with "sha256:"
+	PluginContainerSHA256 string `hcl:"plugin_container_sha256"`
+
 	// Config is passed to the underlying wrappers
 	Config map[string]string
 }
@@ -126,18 +144,35 @@ func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, opt ...Opt
 			delete(m, "disabled")
 		}
 
+		var priority int
+		if v, ok := m["priority"]; ok {
+			p, err := parseutil.ParseInt(v)
+			if err != nil {
+				return multierror.Prefix(fmt.Errorf("unable to parse 'priority' in kms type %q: %w", key, err), fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			if p < 0 {
+				return multierror.Prefix(fmt.Errorf("'priority' in kms type %q must not be negative", key), fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			priority = int(p)
+			delete(m, "priority")
+		}
+
 		seal := &KMS{
 			Type:     strings.ToLower(key),
 			Purpose:  purpose,
 			Disabled: disabled,
+			Priority: priority,
 		}
 
 		const (
-			pluginPath       = "plugin_path"
-			pluginChecksum   = "plugin_checksum"
-			pluginHashMethod = "plugin_hash_method"
+			pluginPath            = "plugin_path"
+			pluginChecksum        = "plugin_checksum"
+			pluginHashMethod      = "plugin_hash_method"
+			pluginContainerImage  = "plugin_container_image"
+			pluginContainerTag    = "plugin_container_tag"
+			pluginContainerSha256 = "plugin_container_sha256"
 		)
-		for _, v := range []string{pluginPath, pluginChecksum, pluginHashMethod} {
+		for _, v := range []string{pluginPath, pluginChecksum, pluginHashMethod, pluginContainerImage, pluginContainerTag, pluginContainerSha256} {
 			currVal := m[v]
 			if currVal == nil {
 				continue
@@ -160,6 +195,15 @@ func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, opt ...Opt
 			case pluginHashMethod:
 				seal.PluginHashMethod = s
 				delete(m, pluginHashMethod)
+			case pluginContainerImage:
+				seal.PluginContainerImage = s
+				delete(m, pluginContainerImage)
+			case pluginContainerTag:
+				seal.PluginContainerTag = s
+				delete(m, pluginContainerTag)
+			case pluginContainerSha256:
+				seal.PluginContainerSHA256 = s
+				delete(m, pluginContainerSha256)
 			}
 		}
 		switch {
@@ -167,6 +211,11 @@ func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, opt ...Opt
 			return multierror.Prefix(fmt.Errorf("%s specified but %s empty", pluginPath, pluginChecksum), fmt.Sprintf("%s.%s:", blockName, key))
 		case seal.PluginPath == "" && seal.PluginChecksum != "":
 			return multierror.Prefix(fmt.Errorf("%s specified but %s empty", pluginChecksum, pluginPath), fmt.Sprintf("%s.%s:", blockName, key))
+		case seal.PluginPath != "" && seal.PluginContainerImage != "":
+			return multierror.Prefix(fmt.Errorf("only one of %s and %s may be specified", pluginPath, pluginContainerImage), fmt.Sprintf("%s.%s:", blockName, key))
+		}
+		if err := validatePluginContainer(seal); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
 		}
 
 		// Put the rest into config
@@ -260,6 +309,12 @@ func filterKMSes(list *ast.ObjectList, maxBlocks int) ([]*KMS, error) {
 // an fs.FS (for external plugins) or an instantiation map (for internal
 // functions) and returns a wrapper, a cleanup function to execute on shutdown
 // of the enclosing program, and an error.
+//
+// Supported options:
+//   - WithPluginOptions
+//   - WithLogger
+//   - WithKmsVerification
+//   - WithPluginContainerConfig
 func configureWrapper(
 	ctx context.Context,
 	configKMS *KMS,
@@ -287,64 +342,82 @@ func configureWrapper(
 		return nil, nil, fmt.Errorf("error parsing config options: %w", err)
 	}
 
-	// If the KMS block contained plugin file information, add it
-	pluginOpts := opts.withPluginOptions
+	// If the KMS block specified a container image, run the plugin from that;
+	// otherwise find it via the plugin sources
+	var plugClient interface{}
 	switch {
-	case configKMS.PluginPath == "" && configKMS.PluginChecksum == "":
-	case configKMS.PluginPath == "" && configKMS.PluginChecksum != "":
-		return nil, nil, errors.New("plugin checksum specified in kms but plugin path empty")
-	case configKMS.PluginPath != "" && configKMS.PluginChecksum == "" && len(configKMS.pluginChecksumBytes) == 0:
-		return nil, nil, errors.New("plugin path specified in kms but plugin checksum empty")
+	case configKMS.PluginContainerImage != "":
+		if configKMS.PluginPath != "" || configKMS.PluginChecksum != "" {
+			return nil, nil, errors.New("plugin container image and plugin path both specified in kms")
+		}
+		if err := validatePluginContainer(configKMS); err != nil {
+			return nil, nil, err
+		}
+		plugClient, cleanup, err = createContainerPlugin(configKMS, opts)
+		if err != nil {
+			return nil, cleanup, err
+		}
+
 	default:
-		if len(configKMS.pluginChecksumBytes) == 0 {
-			configKMS.pluginChecksumBytes, err = hex.DecodeString(configKMS.PluginChecksum)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error parsing plugin checksum as hex: %w", err)
+		// If the KMS block contained plugin file information, add it
+		pluginOpts := opts.withPluginOptions
+		switch {
+		case configKMS.PluginPath == "" && configKMS.PluginChecksum == "":
+		case configKMS.PluginPath == "" && configKMS.PluginChecksum != "":
+			return nil, nil, errors.New("plugin checksum specified in kms but plugin path empty")
+		case configKMS.PluginPath != "" && configKMS.PluginChecksum == "" && len(configKMS.pluginChecksumBytes) == 0:
+			return nil, nil, errors.New("plugin path specified in kms but plugin checksum empty")
+		default:
+			if len(configKMS.pluginChecksumBytes) == 0 {
+				configKMS.pluginChecksumBytes, err = hex.DecodeString(configKMS.PluginChecksum)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error parsing plugin checksum as hex: %w", err)
+				}
 			}
+			pluginOpts = append(pluginOpts, pluginutil.WithPluginFile(
+				pluginutil.PluginFileInfo{
+					Name:       configKMS.Type,
+					Path:       configKMS.PluginPath,
+					Checksum:   configKMS.pluginChecksumBytes,
+					HashMethod: pluginutil.HashMethod(configKMS.PluginHashMethod),
+				},
+			))
 		}
-		pluginOpts = append(pluginOpts, pluginutil.WithPluginFile(
-			pluginutil.PluginFileInfo{
-				Name:       configKMS.Type,
-				Path:       configKMS.PluginPath,
-				Checksum:   configKMS.pluginChecksumBytes,
-				HashMethod: pluginutil.HashMethod(configKMS.PluginHashMethod),
-			},
-		))
-	}
 
-	// First, scan available plugins and build info
-	pluginMap, err := pluginutil.BuildPluginMap(
-		append(
-			pluginOpts,
-			pluginutil.WithPluginClientCreationFunc(
-				func(pluginPath string, rtOpt ...pluginutil.Option) (*plugin.Client, error) {
-					rtOpts, err := pluginutil.GetOpts(rtOpt...)
-					if err != nil {
-						return nil, fmt.Errorf("error parsing round-tripped plugin client options: %w", err)
-					}
-					return gkwp.NewWrapperClient(pluginPath,
-						gkwp.WithLogger(opts.withLogger),
-						gkwp.WithSecureConfig(rtOpts.WithSecureConfig),
-					)
-				}),
-		)...)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error building plugin map: %w", err)
-	}
+		// First, scan available plugins and build info
+		pluginMap, err := pluginutil.BuildPluginMap(
+			append(
+				pluginOpts,
+				pluginutil.WithPluginClientCreationFunc(
+					func(pluginPath string, rtOpt ...pluginutil.Option) (*plugin.Client, error) {
+						rtOpts, err := pluginutil.GetOpts(rtOpt...)
+						if err != nil {
+							return nil, fmt.Errorf("error parsing round-tripped plugin client options: %w", err)
+						}
+						return gkwp.NewWrapperClient(pluginPath,
+							gkwp.WithLogger(opts.withLogger),
+							gkwp.WithSecureConfig(rtOpts.WithSecureConfig),
+						)
+					}),
+			)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error building plugin map: %w", err)
+		}
 
-	// Now, find the right plugin
-	var plug *pluginutil.PluginInfo
-	switch kmsType {
-	case wrapping.WrapperTypeShamir.String():
-		return nil, nil, nil
-	default:
-		plug = pluginMap[kmsType]
-	}
+		// Now, find the right plugin
+		var plug *pluginutil.PluginInfo
+		switch kmsType {
+		case wrapping.WrapperTypeShamir.String():
+			return nil, nil, nil
+		default:
+			plug = pluginMap[kmsType]
+		}
 
-	// Create the plugin and cleanup func
-	plugClient, cleanup, err := pluginutil.CreatePlugin(plug, pluginOpts...)
-	if err != nil {
-		return nil, cleanup, err
+		// Create the plugin and cleanup func
+		plugClient, cleanup, err = pluginutil.CreatePlugin(plug, pluginOpts...)
+		if err != nil {
+			return nil, cleanup, err
+		}
 	}
 
 	// Figure out whether it was internal and directly handles that interface or
@@ -379,58 +452,112 @@ func configureWrapper(
 		populateInfo(configKMS, infoKeys, info, kmsInfo)
 	}
 
+	if opts.withKmsVerification {
+		v, err := VerifyKMS(ctx, configKMS, wrapper)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("error verifying kms: %w", err)
+		}
+		if opts.withLogger != nil {
+			opts.withLogger.Debug("kms verified", "type", v.Type, "purpose", v.Purpose, "key_id", v.KeyId, "latency", v.Latency())
+		}
+	}
+
 	return wrapper, cleanup, nil
 }
 
-// populateInfo is a shared function to populate some common information
-func populateInfo(kms *KMS, infoKeys *[]string, info *map[string]string, kmsInfo map[string]string) {
-	parsedInfo := make(map[string]string)
-	switch kms.Type {
+// knownKmsTypes are the KMS types for which kmsInfoFields reports values
+var knownKmsTypes = []string{
+	wrapping.WrapperTypeAead.String(),
+	wrapping.WrapperTypeAliCloudKms.String(),
+	wrapping.WrapperTypeAwsKms.String(),
+	wrapping.WrapperTypeAzureKeyVault.String(),
+	wrapping.WrapperTypeGcpCkms.String(),
+	wrapping.WrapperTypeOciKms.String(),
+	wrapping.WrapperTypeTransit.String(),
+}
+
+// kmsInfoField describes a non-sensitive value reported by a KMS type
+type kmsInfoField struct {
+	// key is the key in both the wrapper metadata and the KMS config
+	key string
+	// label is the human-readable label used in info output
+	label string
+	// optional fields are only reported if present
+	optional bool
+}
+
+// kmsInfoFields returns the non-sensitive values reported for the given KMS
+// type. It is used to populate info and as the default set of KMS config
+// values shown by DefaultRedactionPolicy.
+func kmsInfoFields(kmsType string) []kmsInfoField {
+	switch kmsType {
 	case wrapping.WrapperTypeAead.String():
-		str := "AEAD Type"
-		if len(kms.Purpose) > 0 {
-			str = fmt.Sprintf("%v %s", kms.Purpose, str)
+		return []kmsInfoField{
+			{key: "aead_type", label: "AEAD Type"},
 		}
-		parsedInfo[str] = kmsInfo["aead_type"]
 
 	case wrapping.WrapperTypeAliCloudKms.String():
-		parsedInfo["AliCloud KMS Region"] = kmsInfo["region"]
-		parsedInfo["AliCloud KMS KeyID"] = kmsInfo["kms_key_id"]
-		if domain, ok := kmsInfo["domain"]; ok {
-			parsedInfo["AliCloud KMS Domain"] = domain
+		return []kmsInfoField{
+			{key: "region", label: "AliCloud KMS Region"},
+			{key: "kms_key_id", label: "AliCloud KMS KeyID"},
+			{key: "domain", label: "AliCloud KMS Domain", optional: true},
 		}
 
 	case wrapping.WrapperTypeAwsKms.String():
-		parsedInfo["AWS KMS Region"] = kmsInfo["region"]
-		parsedInfo["AWS KMS KeyID"] = kmsInfo["kms_key_id"]
-		if endpoint, ok := kmsInfo["endpoint"]; ok {
-			parsedInfo["AWS KMS Endpoint"] = endpoint
+		return []kmsInfoField{
+			{key: "region", label: "AWS KMS Region"},
+			{key: "kms_key_id", label: "AWS KMS KeyID"},
+			{key: "endpoint", label: "AWS KMS Endpoint", optional: true},
 		}
 
 	case wrapping.WrapperTypeAzureKeyVault.String():
-		parsedInfo["Azure Environment"] = kmsInfo["environment"]
-		parsedInfo["Azure Vault Name"] = kmsInfo["vault_name"]
-		parsedInfo["Azure Key Name"] = kmsInfo["key_name"]
+		return []kmsInfoField{
+			{key: "environment", label: "Azure Environment"},
+			{key: "vault_name", label: "Azure Vault Name"},
+			{key: "key_name", label: "Azure Key Name"},
+		}
 
 	case wrapping.WrapperTypeGcpCkms.String():
-		parsedInfo["GCP KMS Project"] = kmsInfo["project"]
-		parsedInfo["GCP KMS Region"] = kmsInfo["region"]
-		parsedInfo["GCP KMS Key Ring"] = kmsInfo["key_ring"]
-		parsedInfo["GCP KMS Crypto Key"] = kmsInfo["crypto_key"]
+		return []kmsInfoField{
+			{key: "project", label: "GCP KMS Project"},
+			{key: "region", label: "GCP KMS Region"},
+			{key: "key_ring", label: "GCP KMS Key Ring"},
+			{key: "crypto_key", label: "GCP KMS Crypto Key"},
+		}
 
 	case wrapping.WrapperTypeOciKms.String():
-		parsedInfo["OCI KMS KeyID"] = kmsInfo["key_id"]
-		parsedInfo["OCI KMS Crypto Endpoint"] = kmsInfo["crypto_endpoint"]
-		parsedInfo["OCI KMS Management Endpoint"] = kmsInfo["management_endpoint"]
-		parsedInfo["OCI KMS Principal Type"] = kmsInfo["principal_type"]
+		return []kmsInfoField{
+			{key: "key_id", label: "OCI KMS KeyID"},
+			{key: "crypto_endpoint", label: "OCI KMS Crypto Endpoint"},
+			{key: "management_endpoint", label: "OCI KMS Management Endpoint"},
+			{key: "principal_type", label: "OCI KMS Principal Type"},
+		}
 
 	case wrapping.WrapperTypeTransit.String():
-		parsedInfo["Transit Address"] = kmsInfo["address"]
-		parsedInfo["Transit Mount Path"] = kmsInfo["mount_path"]
-		parsedInfo["Transit Key Name"] = kmsInfo["key_name"]
-		if namespace, ok := kmsInfo["namespace"]; ok {
-			parsedInfo["Transit Namespace"] = namespace
+		return []kmsInfoField{
+			{key: "address", label: "Transit Address"},
+			{key: "mount_path", label: "Transit Mount Path"},
+			{key: "key_name", label: "Transit Key Name"},
+			{key: "namespace", label: "Transit Namespace", optional: true},
+		}
+	}
+
+	return nil
+}
+
+// populateInfo is a shared function to populate some common information
+func populateInfo(kms *KMS, infoKeys *[]string, info *map[string]string, kmsInfo map[string]string) {
+	parsedInfo := make(map[string]string)
+	for _, field := range kmsInfoFields(kms.Type) {
+		val, ok := kmsInfo[field.key]
+		if field.optional && !ok {
+			continue
+		}
+		label := field.label
+		if kms.Type == wrapping.WrapperTypeAead.String() && len(kms.Purpose) > 0 {
+			label = fmt.Sprintf("%v %s", kms.Purpose, label)
 		}
+		parsedInfo[label] = val
 	}
 
 	if infoKeys != nil && info != nil {
@@ -0,0 +1,91 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gkwp "github.com/hashicorp/go-kms-wrapping/plugin/v2"
+	"github.com/hashicorp/go-kms-wrapping/v2/aead"
+	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/go-secure-stdlib/plugincontainer"
+)
+
+// validatePluginContainer ensures that container information in the KMS block,
+// if any, is complete and pins the image by digest
+func validatePluginContainer(configKMS *KMS) error {
+	switch {
+	case configKMS.PluginContainerImage == "" && configKMS.PluginContainerTag == "" && configKMS.PluginContainerSHA256 == "":
+		return nil
+	case configKMS.PluginContainerImage == "":
+		return errors.New("plugin_container_tag or plugin_container_sha256 specified but plugin_container_image empty")
+	case configKMS.PluginContainerSHA256 == "":
+		return errors.New("plugin_container_image specified but plugin_container_sha256 empty")
+	case strings.Contains(configKMS.PluginContainerImage, ":"):
+		return fmt.Errorf("plugin_container_image %q must not contain ':', use plugin_container_tag to specify a tag", configKMS.PluginContainerImage)
+	}
+
+	digest, err := hex.DecodeString(strings.TrimPrefix(configKMS.PluginContainerSHA256, "sha256:"))
+	if err != nil {
+		return fmt.Errorf("error parsing plugin_container_sha256 as hex: %w", err)
+	}
+	if len(digest) != 32 {
+		return fmt.Errorf("plugin_container_sha256 must be a SHA256 digest, got %d bytes", len(digest))
+	}
+	return nil
+}
+
+// createContainerPlugin starts the wrapper plugin for the KMS inside a
+// container and returns its RPC client along with a cleanup function
+func createContainerPlugin(configKMS *KMS, opts *options) (interface{}, func() error, error) {
+	cfg := new(plugincontainer.Config)
+	if opts.withPluginContainerConfig != nil {
+		*cfg = *opts.withPluginContainerConfig
+	}
+	cfg.Image = configKMS.PluginContainerImage
+	cfg.Tag = configKMS.PluginContainerTag
+	cfg.SHA256 = configKMS.PluginContainerSHA256
+
+	// The plugin set is only used on the client side here, so the implementation
+	// given to the server constructor is never called
+	wrapperPlugin, err := gkwp.NewWrapperServer(aead.NewWrapper())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating kms plugin definition: %w", err)
+	}
+
+	clientConfig := &plugin.ClientConfig{
+		HandshakeConfig: gkwp.HandshakeConfig,
+		VersionedPlugins: map[int]plugin.PluginSet{
+			1: {"wrapping": wrapperPlugin},
+		},
+		RunnerFunc: cfg.NewContainerRunner,
+		AllowedProtocols: []plugin.Protocol{
+			plugin.ProtocolGRPC,
+		},
+		Logger:      opts.withLogger,
+		AutoMTLS:    true,
+		SkipHostEnv: true,
+	}
+	if cfg.GroupAdd != 0 {
+		clientConfig.UnixSocketConfig = &plugin.UnixSocketConfig{
+			Group: strconv.Itoa(cfg.GroupAdd),
+		}
+	}
+
+	client := plugin.NewClient(clientConfig)
+	cleanup := func() error {
+		client.Kill()
+		return nil
+	}
+	rpcClient, err := client.Client()
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("error starting kms plugin container: %w", err)
+	}
+
+	return rpcClient, cleanup, nil
+}
@@ -0,0 +1,150 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-secure-stdlib/plugincontainer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginContainerConfig(t *testing.T) {
+	digest := sha256.Sum256([]byte("image"))
+	sha := hex.EncodeToString(digest[:])
+
+	testCases := []struct {
+		name                  string
+		hacheSeeEll           string
+		wantConfigErrContains string
+		wantKms               *KMS
+	}{
+		{
+			name: "valid",
+			hacheSeeEll: fmt.Sprintf(`
+				kms "aead" {
+					aead_type = "aes-gcm"
+					plugin_container_image = "example/kms-plugin"
+					plugin_container_tag = "1.0.0"
+					plugin_container_sha256 = "%s"
+				}
+				`, sha),
+			wantKms: &KMS{
+				Type:                  "aead",
+				PluginContainerImage:  "example/kms-plugin",
+				PluginContainerTag:    "1.0.0",
+				PluginContainerSHA256: sha,
+				Config:                map[string]string{"aead_type": "aes-gcm"},
+			},
+		},
+		{
+			name: "valid prefixed sha",
+			hacheSeeEll: fmt.Sprintf(`
+				kms "aead" {
+					plugin_container_image = "example/kms-plugin"
+					plugin_container_sha256 = "sha256:%s"
+				}
+				`, sha),
+			wantKms: &KMS{
+				Type:                  "aead",
+				PluginContainerImage:  "example/kms-plugin",
+				PluginContainerSHA256: "sha256:" + sha,
+			},
+		},
+		{
+			name: "no sha",
+			hacheSeeEll: `
+				kms "aead" {
+					plugin_container_image = "example/kms-plugin"
+					plugin_container_tag = "1.0.0"
+				}
+				`,
+			wantConfigErrContains: "plugin_container_image specified but plugin_container_sha256 empty",
+		},
+		{
+			name: "no image",
+			hacheSeeEll: fmt.Sprintf(`
+				kms "aead" {
+					plugin_container_sha256 = "%s"
+				}
+				`, sha),
+			wantConfigErrContains: "plugin_container_image empty",
+		},
+		{
+			name: "tag in image",
+			hacheSeeEll: fmt.Sprintf(`
+				kms "aead" {
+					plugin_container_image = "example/kms-plugin:1.0.0"
+					plugin_container_sha256 = "%s"
+				}
+				`, sha),
+			wantConfigErrContains: "must not contain ':'",
+		},
+		{
+			name: "invalid sha",
+			hacheSeeEll: `
+				kms "aead" {
+					plugin_container_image = "example/kms-plugin"
+					plugin_container_sha256 = "abcd"
+				}
+				`,
+			wantConfigErrContains: "must be a SHA256 digest",
+		},
+		{
+			name: "path and image",
+			hacheSeeEll: fmt.Sprintf(`
+				kms "aead" {
+					plugin_path = "/tmp/plugin"
+					plugin_checksum = "%[1]s"
+					plugin_container_image = "example/kms-plugin"
+					plugin_container_sha256 = "%[1]s"
+				}
+				`, sha),
+			wantConfigErrContains: "only one of plugin_path and plugin_container_image may be specified",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			kmses, err := ParseKMSes(tc.hacheSeeEll)
+			if tc.wantConfigErrContains != "" {
+				require.Error(err)
+				assert.Contains(err.Error(), tc.wantConfigErrContains)
+				return
+			}
+			require.NoError(err)
+			require.Len(kmses, 1)
+			assert.Equal(tc.wantKms, kmses[0])
+		})
+	}
+}
+
+func TestConfigureWrapperPluginContainer(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+
+	_, _, err := configureWrapper(ctx, &KMS{
+		Type:                 "aead",
+		PluginContainerImage: "example/kms-plugin",
+	}, nil, nil)
+	require.Error(err)
+	assert.Contains(err.Error(), "plugin_container_sha256 empty")
+
+	// No image with this digest exists, so whether or not a container runtime
+	// is available, starting the plugin should fail
+	digest := sha256.Sum256([]byte("nonexistent"))
+	_, cleanup, err := configureWrapper(ctx, &KMS{
+		Type:                  "aead",
+		PluginContainerImage:  "example/kms-plugin",
+		PluginContainerSHA256: hex.EncodeToString(digest[:]),
+	}, nil, nil, WithPluginContainerConfig(&plugincontainer.Config{Image: "ignored"}))
+	require.Error(err)
+	assert.Contains(err.Error(), "kms plugin container")
+	assert.NotNil(cleanup)
+}
@@ -59,3 +59,40 @@ func TestConfigureWrapperPropagatesOptions(t *testing.T) {
 	require.NoError(err)
 	assert.EqualValues("secret", decrypted)
 }
+
+func TestParseKMSesPriority(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+
+	kmses, err := ParseKMSes(`
+		kms "aead" {
+			purpose = "root"
+			priority = 2
+			aead_type = "aes-gcm"
+		}
+		kms "aead" {
+			purpose = "root"
+			aead_type = "aes-gcm"
+		}
+		`)
+	require.NoError(err)
+	require.Len(kmses, 2)
+	assert.Equal(2, kmses[0].Priority)
+	assert.Equal(map[string]string{"aead_type": "aes-gcm"}, kmses[0].Config)
+	assert.Zero(kmses[1].Priority)
+
+	_, err = ParseKMSes(`
+		kms "aead" {
+			priority = -1
+		}
+		`)
+	require.Error(err)
+	assert.Contains(err.Error(), "must not be negative")
+
+	_, err = ParseKMSes(`
+		kms "aead" {
+			priority = "high"
+		}
+		`)
+	require.Error(err)
+	assert.Contains(err.Error(), "unable to parse 'priority'")
+}
@@ -0,0 +1,307 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+)
+
+// DefaultHealthCheckInterval is the interval used by KmsHealthChecker if
+// WithHealthCheckInterval is not provided
+const DefaultHealthCheckInterval = time.Minute
+
+// kmsVerificationPlaintext is the value round-tripped through a KMS to verify
+// it
+const kmsVerificationPlaintext = "configutil kms verification"
+
+// KmsVerification contains the result of round-tripping a test value through a
+// KMS
+type KmsVerification struct {
+	// Type is the KMS type, e.g. "aead" or "awskms"
+	Type string
+	// Purpose is the set of purposes from the KMS configuration
+	Purpose []string
+	// KeyId is the key ID reported by the wrapper, if it could be fetched
+	KeyId string
+	// EncryptLatency is the time taken by the encrypt call
+	EncryptLatency time.Duration
+	// DecryptLatency is the time taken by the decrypt call
+	DecryptLatency time.Duration
+	// Error is the reason verification failed, if it did
+	Error error
+	// CheckedAt is the time the verification started
+	CheckedAt time.Time
+}
+
+// Latency returns the total time taken to encrypt and decrypt
+func (v *KmsVerification) Latency() time.Duration {
+	return v.EncryptLatency + v.DecryptLatency
+}
+
+// VerifyKMS round-trips a test value through the given wrapper, built from the
+// given KMS configuration, and reports the key ID and latency. A verification
+// result is always returned; if verification failed, its Error field is set
+// and the same error is returned.
+func VerifyKMS(ctx context.Context, configKMS *KMS, wrapper wrapping.Wrapper) (*KmsVerification, error) {
+	ret := &KmsVerification{
+		CheckedAt: time.Now(),
+	}
+	if configKMS != nil {
+		ret.Type = configKMS.Type
+		ret.Purpose = configKMS.Purpose
+	}
+	fail := func(err error) (*KmsVerification, error) {
+		ret.Error = err
+		return ret, err
+	}
+
+	if wrapper == nil {
+		return fail(errors.New("nil wrapper passed in"))
+	}
+
+	keyId, err := wrapper.KeyId(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("error fetching key id: %w", err))
+	}
+	ret.KeyId = keyId
+
+	start := time.Now()
+	blob, err := wrapper.Encrypt(ctx, []byte(kmsVerificationPlaintext))
+	ret.EncryptLatency = time.Since(start)
+	if err != nil {
+		return fail(fmt.Errorf("error encrypting verification value: %w", err))
+	}
+	if blob == nil {
+		return fail(errors.New("nil value returned from encrypting verification value"))
+	}
+
+	start = time.Now()
+	pt, err := wrapper.Decrypt(ctx, blob)
+	ret.DecryptLatency = time.Since(start)
+	if err != nil {
+		return fail(fmt.Errorf("error decrypting verification value: %w", err))
+	}
+	if !bytes.Equal(pt, []byte(kmsVerificationPlaintext)) {
+		return fail(errors.New("decrypted verification value does not match"))
+	}
+
+	return ret, nil
+}
+
+// Verify round-trips a test value through each KMS in the MultiWrapper and
+// updates their health accordingly. Results are returned in priority order.
+func (m *MultiWrapper) Verify(ctx context.Context) []*KmsVerification {
+	m.l.RLock()
+	members := make([]*multiWrapperMember, len(m.members))
+	copy(members, m.members)
+	m.l.RUnlock()
+
+	ret := make([]*KmsVerification, 0, len(members))
+	for _, member := range members {
+		v, err := VerifyKMS(ctx, member.kms, member.wrapper)
+		m.record(member, err)
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// KmsStatus contains the health check history of a single KMS
+type KmsStatus struct {
+	// Type is the KMS type, e.g. "aead" or "awskms"
+	Type string
+	// Purpose is the set of purposes from the KMS configuration
+	Purpose []string
+	// KeyId is the key ID seen in the most recent check
+	KeyId string
+	// Healthy is true if the most recent check succeeded
+	Healthy bool
+	// LastVerification is the result of the most recent check
+	LastVerification *KmsVerification
+	// LastSuccess is the time of the most recent successful check
+	LastSuccess time.Time
+	// ConsecutiveFailures is the number of checks that have failed since the
+	// last success
+	ConsecutiveFailures int
+}
+
+// KmsHealthChecker periodically verifies one or more KMSes and keeps their
+// status, logging failures and recoveries
+type KmsHealthChecker struct {
+	check    func(context.Context) []*KmsVerification
+	interval time.Duration
+	logger   hclog.Logger
+
+	l        sync.RWMutex
+	statuses []*KmsStatus
+	cancel   context.CancelFunc
+	doneCh   chan struct{}
+}
+
+// NewKmsHealthChecker returns a health checker for a single KMS and the wrapper
+// built from it.
+//
+// Supported options:
+//   - WithLogger
+//   - WithHealthCheckInterval
+func NewKmsHealthChecker(configKMS *KMS, wrapper wrapping.Wrapper, opt ...Option) (*KmsHealthChecker, error) {
+	if wrapper == nil {
+		return nil, errors.New("nil wrapper passed in")
+	}
+	return newKmsHealthChecker(func(ctx context.Context) []*KmsVerification {
+		v, _ := VerifyKMS(ctx, configKMS, wrapper)
+		return []*KmsVerification{v}
+	}, opt...)
+}
+
+// NewHealthChecker returns a health checker that verifies every KMS in the
+// MultiWrapper, updating the MultiWrapper's health as it does so. This allows
+// KMSes that were marked unhealthy to be used again once they recover.
+//
+// Supported options:
+//   - WithLogger
+//   - WithHealthCheckInterval
+func (m *MultiWrapper) NewHealthChecker(opt ...Option) (*KmsHealthChecker, error) {
+	return newKmsHealthChecker(m.Verify, opt...)
+}
+
+func newKmsHealthChecker(check func(context.Context) []*KmsVerification, opt ...Option) (*KmsHealthChecker, error) {
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config options: %w", err)
+	}
+
+	c := &KmsHealthChecker{
+		check:    check,
+		interval: opts.withHealthCheckInterval,
+		logger:   opts.withLogger,
+	}
+	if c.interval <= 0 {
+		c.interval = DefaultHealthCheckInterval
+	}
+	if c.logger == nil {
+		c.logger = hclog.NewNullLogger()
+	}
+	return c, nil
+}
+
+// Check runs a verification of each KMS immediately, updates their status, and
+// returns the results
+func (c *KmsHealthChecker) Check(ctx context.Context) []*KmsVerification {
+	results := c.check(ctx)
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if len(c.statuses) != len(results) {
+		c.statuses = make([]*KmsStatus, len(results))
+	}
+	for i, v := range results {
+		status := c.statuses[i]
+		if status == nil {
+			status = &KmsStatus{Type: v.Type, Purpose: v.Purpose}
+			c.statuses[i] = status
+		}
+		status.KeyId = v.KeyId
+		status.LastVerification = v
+
+		logArgs := []interface{}{"type", v.Type, "purpose", v.Purpose, "key_id", v.KeyId}
+		switch {
+		case v.Error != nil:
+			status.Healthy = false
+			status.ConsecutiveFailures++
+			c.logger.Warn("kms health check failed", append(logArgs, "consecutive_failures", status.ConsecutiveFailures, "error", v.Error)...)
+		default:
+			if status.ConsecutiveFailures > 0 {
+				c.logger.Info("kms health check recovered", append(logArgs, "failures", status.ConsecutiveFailures)...)
+			}
+			status.Healthy = true
+			status.ConsecutiveFailures = 0
+			status.LastSuccess = v.CheckedAt
+			c.logger.Trace("kms health check succeeded", append(logArgs, "encrypt_latency", v.EncryptLatency, "decrypt_latency", v.DecryptLatency)...)
+		}
+	}
+
+	return results
+}
+
+// Status returns a copy of the status of each KMS as of the most recent check.
+// It is empty until the first check has run.
+func (c *KmsHealthChecker) Status() []*KmsStatus {
+	c.l.RLock()
+	defer c.l.RUnlock()
+
+	ret := make([]*KmsStatus, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		s := *status
+		ret = append(ret, &s)
+	}
+	return ret
+}
+
+// Start runs a check immediately and then at each interval in the background
+// until Stop is called or the context is canceled. It returns an error if the
+// checker is already running. Once stopped either way, it can be started
+// again.
+func (c *KmsHealthChecker) Start(ctx context.Context) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.cancel != nil {
+		return errors.New("kms health checker is already running")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	doneCh := make(chan struct{})
+	c.cancel = cancel
+	c.doneCh = doneCh
+
+	go func() {
+		defer func() {
+			// Clear the running state if the context was canceled rather
+			// than Stop being called, unless a new run has replaced it
+			c.l.Lock()
+			if c.doneCh == doneCh {
+				c.cancel, c.doneCh = nil, nil
+			}
+			c.l.Unlock()
+			cancel()
+			close(doneCh)
+		}()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.Check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops background checks started by Start and waits for any in-progress
+// check to finish. It is safe to call if the checker is not running.
+func (c *KmsHealthChecker) Stop() {
+	c.l.Lock()
+	cancel, doneCh := c.cancel, c.doneCh
+	c.cancel, c.doneCh = nil, nil
+	c.l.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-doneCh
+}
@@ -0,0 +1,193 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-kms-wrapping/v2/aead"
+	"github.com/hashicorp/go-secure-stdlib/pluginutil/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyKMS(t *testing.T) {
+	ctx := context.Background()
+	kms := &KMS{Type: "aead", Purpose: []string{"root"}}
+
+	t.Run("success", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		v, err := VerifyKMS(ctx, kms, aead.TestWrapper(t))
+		require.NoError(err)
+		assert.NoError(v.Error)
+		assert.Equal("aead", v.Type)
+		assert.Equal([]string{"root"}, v.Purpose)
+		assert.Equal("w1", v.KeyId)
+		assert.False(v.CheckedAt.IsZero())
+		assert.Equal(v.EncryptLatency+v.DecryptLatency, v.Latency())
+	})
+
+	t.Run("nil-wrapper", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		v, err := VerifyKMS(ctx, kms, nil)
+		require.Error(err)
+		require.NotNil(v)
+		assert.Equal(err, v.Error)
+	})
+
+	t.Run("unconfigured", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		v, err := VerifyKMS(ctx, kms, aead.NewWrapper())
+		require.Error(err)
+		assert.Contains(err.Error(), "error encrypting verification value")
+		assert.Equal(err, v.Error)
+	})
+
+	t.Run("configure-wrapper", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail := new(atomic.Bool)
+		fail.Store(true)
+		pluginOpts := WithPluginOptions(pluginutil.WithPluginsMap(map[string]pluginutil.InmemCreationFunc{
+			"aead": func() (interface{}, error) {
+				return aead.NewWrapper(), nil
+			},
+			"failing": func() (interface{}, error) {
+				return &failingWrapper{Wrapper: aead.NewWrapper(), fail: fail}, nil
+			},
+		}))
+
+		wrapper, _, err := configureWrapper(ctx, &KMS{Type: "failing", Config: testAeadKmsConfig(t, "foo")}, nil, nil, pluginOpts)
+		require.NoError(err)
+		assert.NotNil(wrapper)
+
+		_, _, err = configureWrapper(ctx, &KMS{Type: "failing", Config: testAeadKmsConfig(t, "foo")}, nil, nil, pluginOpts, WithKmsVerification(true))
+		require.Error(err)
+		assert.Contains(err.Error(), "error verifying kms")
+
+		wrapper, _, err = configureWrapper(ctx, &KMS{Type: "aead", Config: testAeadKmsConfig(t, "foo")}, nil, nil, pluginOpts, WithKmsVerification(true))
+		require.NoError(err)
+		assert.NotNil(wrapper)
+	})
+}
+
+func TestKmsHealthChecker(t *testing.T) {
+	ctx := context.Background()
+	fail := new(atomic.Bool)
+	pluginOpts := WithPluginOptions(pluginutil.WithPluginsMap(map[string]pluginutil.InmemCreationFunc{
+		"aead": func() (interface{}, error) {
+			return aead.NewWrapper(), nil
+		},
+		"failing": func() (interface{}, error) {
+			return &failingWrapper{Wrapper: aead.NewWrapper(), fail: fail}, nil
+		},
+	}))
+
+	t.Run("single", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewKmsHealthChecker(nil, nil)
+		require.Error(err)
+
+		kms := &KMS{Type: "failing", Config: testAeadKmsConfig(t, "foo")}
+		wrapper, _, err := configureWrapper(ctx, kms, nil, nil, pluginOpts)
+		require.NoError(err)
+
+		buf := new(bytes.Buffer)
+		logger := hclog.New(&hclog.LoggerOptions{Output: buf, Level: hclog.Info})
+		checker, err := NewKmsHealthChecker(kms, wrapper, WithLogger(logger))
+		require.NoError(err)
+		assert.Equal(DefaultHealthCheckInterval, checker.interval)
+		assert.Empty(checker.Status())
+
+		fail.Store(false)
+		results := checker.Check(ctx)
+		require.Len(results, 1)
+		assert.NoError(results[0].Error)
+		status := checker.Status()
+		require.Len(status, 1)
+		assert.True(status[0].Healthy)
+		assert.Equal("foo", status[0].KeyId)
+		assert.False(status[0].LastSuccess.IsZero())
+
+		fail.Store(true)
+		checker.Check(ctx)
+		checker.Check(ctx)
+		status = checker.Status()
+		assert.False(status[0].Healthy)
+		assert.Equal(2, status[0].ConsecutiveFailures)
+		assert.Error(status[0].LastVerification.Error)
+		assert.Contains(buf.String(), "kms health check failed")
+
+		fail.Store(false)
+		checker.Check(ctx)
+		status = checker.Status()
+		assert.True(status[0].Healthy)
+		assert.Zero(status[0].ConsecutiveFailures)
+		assert.Contains(buf.String(), "kms health check recovered")
+	})
+
+	t.Run("multi-background", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail.Store(true)
+		multi, cleanup, err := NewMultiWrapper(ctx, []*KMS{
+			{Type: "failing", Priority: 1, Config: testAeadKmsConfig(t, "first")},
+			{Type: "aead", Priority: 2, Config: testAeadKmsConfig(t, "second")},
+		}, pluginOpts)
+		require.NoError(err)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+
+		checker, err := multi.NewHealthChecker(WithHealthCheckInterval(10 * time.Millisecond))
+		require.NoError(err)
+		require.NoError(checker.Start(ctx))
+		require.Error(checker.Start(ctx))
+		t.Cleanup(checker.Stop)
+
+		require.Eventually(func() bool {
+			status := checker.Status()
+			return len(status) == 2 && !status[0].Healthy && status[1].Healthy
+		}, time.Second, 10*time.Millisecond)
+		assert.False(multi.Health()[0].Healthy)
+		keyId, err := multi.KeyId(ctx)
+		require.NoError(err)
+		assert.Equal("second", keyId)
+
+		// Once the first KMS recovers, background checks mark it healthy and it
+		// is used for encryption again
+		fail.Store(false)
+		require.Eventually(func() bool {
+			return multi.Health()[0].Healthy
+		}, time.Second, 10*time.Millisecond)
+		keyId, err = multi.KeyId(ctx)
+		require.NoError(err)
+		assert.Equal("first", keyId)
+
+		checker.Stop()
+		checker.Stop()
+	})
+
+	t.Run("restart-after-cancel", func(t *testing.T) {
+		require := require.New(t)
+		fail.Store(false)
+		kms := &KMS{Type: "aead", Config: testAeadKmsConfig(t, "foo")}
+		wrapper, _, err := configureWrapper(ctx, kms, nil, nil, pluginOpts)
+		require.NoError(err)
+		checker, err := NewKmsHealthChecker(kms, wrapper, WithHealthCheckInterval(10*time.Millisecond))
+		require.NoError(err)
+
+		// Canceling the context stops the checker without calling Stop, after
+		// which it can be started again
+		cancelCtx, cancel := context.WithCancel(ctx)
+		require.NoError(checker.Start(cancelCtx))
+		cancel()
+		require.Eventually(func() bool {
+			return checker.Start(ctx) == nil
+		}, time.Second, 10*time.Millisecond)
+		t.Cleanup(checker.Stop)
+		require.Error(checker.Start(ctx))
+	})
+}
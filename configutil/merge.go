@@ -56,5 +56,29 @@ func (c *SharedConfig) Merge(c2 *SharedConfig) *SharedConfig {
 		result.ClusterName = c2.ClusterName
 	}
 
+	if c.provenance != nil || c2.provenance != nil {
+		result.provenance = make(map[string]*Provenance)
+		mergeProvenance(result.provenance, c, 0, 0, map[string]bool{
+			"entropy":                      result.Entropy == c.Entropy,
+			"telemetry":                    c2.Telemetry == nil,
+			"disable_mlock":                !c2.DisableMlock,
+			"default_max_request_duration": c2.DefaultMaxRequestDuration <= c.DefaultMaxRequestDuration,
+			"log_level":                    c2.LogLevel == "",
+			"log_format":                   c2.LogFormat == "",
+			"pid_file":                     c2.PidFile == "",
+			"cluster_name":                 c2.ClusterName == "",
+		})
+		mergeProvenance(result.provenance, c2, len(c.Listeners), len(c.Seals), map[string]bool{
+			"entropy":                      c2.Entropy != nil,
+			"telemetry":                    c2.Telemetry != nil,
+			"disable_mlock":                c2.DisableMlock,
+			"default_max_request_duration": c2.DefaultMaxRequestDuration > c.DefaultMaxRequestDuration,
+			"log_level":                    c2.LogLevel != "",
+			"log_format":                   c2.LogFormat != "",
+			"pid_file":                     c2.PidFile != "",
+			"cluster_name":                 c2.ClusterName != "",
+		})
+	}
+
 	return result
 }
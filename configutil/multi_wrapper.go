@@ -0,0 +1,308 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+	"github.com/hashicorp/go-multierror"
+)
+
+var _ wrapping.Wrapper = (*MultiWrapper)(nil)
+
+// ErrNoHealthyKms is returned when no configured KMS was able to service a
+// request
+var ErrNoHealthyKms = errors.New("no kms was able to service the request")
+
+// ErrKmsDecryptFailed is returned when no configured KMS was able to decrypt a
+// value even though at least one of them was healthy, e.g. because none holds
+// the key that encrypted it
+var ErrKmsDecryptFailed = errors.New("no kms was able to decrypt the value")
+
+// KmsHealth contains point-in-time health information about a single KMS
+// within a MultiWrapper
+type KmsHealth struct {
+	// Type is the KMS type, e.g. "aead" or "awskms"
+	Type string
+	// Purpose is the set of purposes from the KMS configuration
+	Purpose []string
+	// Priority is the priority from the KMS configuration
+	Priority int
+	// KeyId is the key ID reported by the wrapper at configuration time
+	KeyId string
+	// Disabled indicates the KMS is only used for decryption
+	Disabled bool
+	// Healthy is false if the last operation against the KMS failed
+	Healthy bool
+	// LastError is the error from the last failed operation, if any
+	LastError error
+	// LastChecked is the time of the last operation against the KMS, or the
+	// time the KMS was configured if none has occurred yet
+	LastChecked time.Time
+}
+
+// multiWrapperMember tracks a single configured KMS and its health
+type multiWrapperMember struct {
+	kms     *KMS
+	wrapper wrapping.Wrapper
+	keyId   string
+
+	healthy     bool
+	lastErr     error
+	lastChecked time.Time
+}
+
+// MultiWrapper is a wrapping.Wrapper composed of several configured KMSes.
+// Encryption is performed by the highest-priority healthy KMS that is not
+// disabled; if it fails, the next one is tried. Decryption first tries any KMS
+// whose key ID matches the one recorded in the blob's KeyInfo, then fails over
+// to the rest.
+type MultiWrapper struct {
+	l       sync.RWMutex
+	members []*multiWrapperMember
+}
+
+// NewMultiWrapper configures a wrapper for each of the given KMSes via
+// ConfigureWrapper and returns a MultiWrapper composed of them, along with a
+// cleanup function that runs the cleanup of each underlying wrapper. Shamir
+// KMSes are skipped. KMSes are ordered by Priority, with unspecified (zero)
+// priorities sorting last in the order given.
+//
+// Supported options:
+//   - WithPluginOptions
+//   - WithLogger
+func NewMultiWrapper(ctx context.Context, kmses []*KMS, opt ...Option) (
+	multi *MultiWrapper,
+	cleanup func() error,
+	retErr error,
+) {
+	var cleanups []func() error
+	cleanupAll := func() error {
+		var retErr *multierror.Error
+		for _, c := range cleanups {
+			if err := c(); err != nil {
+				retErr = multierror.Append(retErr, err)
+			}
+		}
+		return retErr.ErrorOrNil()
+	}
+	defer func() {
+		if retErr != nil {
+			_ = cleanupAll()
+		}
+	}()
+
+	if len(kmses) == 0 {
+		return nil, nil, fmt.Errorf("no kms configurations passed in")
+	}
+
+	sorted := make([]*KMS, len(kmses))
+	copy(sorted, kmses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return effectivePriority(sorted[i]) < effectivePriority(sorted[j])
+	})
+
+	multi = new(MultiWrapper)
+	for _, k := range sorted {
+		if k == nil {
+			return nil, nil, fmt.Errorf("nil kms configuration passed in")
+		}
+		wrapper, wrapperCleanup, err := ConfigureWrapper(ctx, k, nil, nil, opt...)
+		if wrapperCleanup != nil {
+			cleanups = append(cleanups, wrapperCleanup)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error configuring kms %q: %w", k.Type, err)
+		}
+		if wrapper == nil {
+			// Shamir
+			continue
+		}
+		keyId, err := wrapper.KeyId(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching key id for kms %q: %w", k.Type, err)
+		}
+		multi.members = append(multi.members, &multiWrapperMember{
+			kms:         k,
+			wrapper:     wrapper,
+			keyId:       keyId,
+			healthy:     true,
+			lastChecked: time.Now(),
+		})
+	}
+
+	if len(multi.members) == 0 {
+		return nil, nil, fmt.Errorf("no usable kms configurations found")
+	}
+
+	return multi, cleanupAll, nil
+}
+
+// effectivePriority maps an unspecified priority to the lowest possible one
+func effectivePriority(k *KMS) int {
+	if k == nil || k.Priority <= 0 {
+		return math.MaxInt
+	}
+	return k.Priority
+}
+
+// Type returns the pooled wrapper type, as a MultiWrapper is a composite of
+// other wrappers
+func (m *MultiWrapper) Type(_ context.Context) (wrapping.WrapperType, error) {
+	return wrapping.WrapperTypePooled, nil
+}
+
+// KeyId returns the key ID of the KMS that would currently be used for
+// encryption
+func (m *MultiWrapper) KeyId(_ context.Context) (string, error) {
+	encryptors := m.encryptors()
+	if len(encryptors) == 0 {
+		return "", ErrNoHealthyKms
+	}
+	return encryptors[0].keyId, nil
+}
+
+// SetConfig sets config, but there is currently nothing to set on
+// multi wrappers; configuration is set on each underlying wrapper when it is
+// created from its KMS block.
+func (m *MultiWrapper) SetConfig(_ context.Context, _ ...wrapping.Option) (*wrapping.WrapperConfig, error) {
+	return nil, nil
+}
+
+// Encrypt encrypts using the highest-priority healthy KMS, failing over to the
+// others in priority order. Unhealthy KMSes are tried last. If ctx is canceled
+// or expires, Encrypt stops without failing over, and the failure does not
+// affect the health of any KMS.
+func (m *MultiWrapper) Encrypt(ctx context.Context, plaintext []byte, opt ...wrapping.Option) (*wrapping.BlobInfo, error) {
+	var retErr *multierror.Error
+	for _, member := range m.encryptors() {
+		blob, err := member.wrapper.Encrypt(ctx, plaintext, opt...)
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("error encrypting with kms %q: %w", member.kms.Type, ctx.Err())
+		}
+		m.record(member, err)
+		if err != nil {
+			retErr = multierror.Append(retErr, fmt.Errorf("kms %q: %w", member.kms.Type, err))
+			continue
+		}
+		return blob, nil
+	}
+	if retErr == nil {
+		return nil, ErrNoHealthyKms
+	}
+	return nil, fmt.Errorf("%w: %w", ErrNoHealthyKms, retErr)
+}
+
+// Decrypt decrypts using the KMS whose key ID matches the one in the blob's
+// KeyInfo, if any, then fails over to every other KMS in priority order.
+// Decryption failures do not affect health, since a KMS that cannot decrypt a
+// value may simply not hold the key that encrypted it. If every KMS fails, the
+// error wraps ErrKmsDecryptFailed, or ErrNoHealthyKms if none of them was
+// healthy. As with Encrypt, a canceled or expired ctx stops the failover.
+func (m *MultiWrapper) Decrypt(ctx context.Context, ciphertext *wrapping.BlobInfo, opt ...wrapping.Option) ([]byte, error) {
+	if ciphertext == nil {
+		return nil, fmt.Errorf("given ciphertext for decryption is nil")
+	}
+
+	var retErr *multierror.Error
+	var anyHealthy bool
+	for _, member := range m.decryptors(ciphertext.GetKeyInfo().GetKeyId()) {
+		pt, err := member.wrapper.Decrypt(ctx, ciphertext, opt...)
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("error decrypting with kms %q: %w", member.kms.Type, ctx.Err())
+		}
+		if err != nil {
+			anyHealthy = anyHealthy || m.isHealthy(member)
+			retErr = multierror.Append(retErr, fmt.Errorf("kms %q: %w", member.kms.Type, err))
+			continue
+		}
+		return pt, nil
+	}
+	if !anyHealthy {
+		return nil, fmt.Errorf("%w: %w", ErrNoHealthyKms, retErr)
+	}
+	return nil, fmt.Errorf("%w: %w", ErrKmsDecryptFailed, retErr)
+}
+
+// Health returns the current health of each KMS, in priority order
+func (m *MultiWrapper) Health() []*KmsHealth {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	ret := make([]*KmsHealth, 0, len(m.members))
+	for _, member := range m.members {
+		ret = append(ret, &KmsHealth{
+			Type:        member.kms.Type,
+			Purpose:     member.kms.Purpose,
+			Priority:    member.kms.Priority,
+			KeyId:       member.keyId,
+			Disabled:    member.kms.Disabled,
+			Healthy:     member.healthy,
+			LastError:   member.lastErr,
+			LastChecked: member.lastChecked,
+		})
+	}
+	return ret
+}
+
+// encryptors returns the non-disabled members, healthy ones first, each group
+// in priority order
+func (m *MultiWrapper) encryptors() []*multiWrapperMember {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	var healthy, unhealthy []*multiWrapperMember
+	for _, member := range m.members {
+		switch {
+		case member.kms.Disabled:
+		case member.healthy:
+			healthy = append(healthy, member)
+		default:
+			unhealthy = append(unhealthy, member)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// decryptors returns all members, those matching the given key ID first, each
+// group in priority order
+func (m *MultiWrapper) decryptors(keyId string) []*multiWrapperMember {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	var matching, rest []*multiWrapperMember
+	for _, member := range m.members {
+		switch {
+		case keyId != "" && member.keyId == keyId:
+			matching = append(matching, member)
+		default:
+			rest = append(rest, member)
+		}
+	}
+	return append(matching, rest...)
+}
+
+// isHealthy returns whether the last operation against the member succeeded
+func (m *MultiWrapper) isHealthy(member *multiWrapperMember) bool {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	return member.healthy
+}
+
+// record updates the health of the member based on the result of an operation
+func (m *MultiWrapper) record(member *multiWrapperMember, err error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	member.healthy = err == nil
+	member.lastErr = err
+	member.lastChecked = time.Now()
+}
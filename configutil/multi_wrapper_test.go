@@ -0,0 +1,276 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+	"github.com/hashicorp/go-kms-wrapping/v2/aead"
+	"github.com/hashicorp/go-secure-stdlib/pluginutil/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingWrapper is an aead wrapper whose encryption can be made to fail
+type failingWrapper struct {
+	*aead.Wrapper
+	fail *atomic.Bool
+}
+
+func (f *failingWrapper) Encrypt(ctx context.Context, pt []byte, opt ...wrapping.Option) (*wrapping.BlobInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.fail.Load() {
+		return nil, errors.New("kms unavailable")
+	}
+	return f.Wrapper.Encrypt(ctx, pt, opt...)
+}
+
+func testAeadKmsConfig(t *testing.T, keyId string) map[string]string {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return map[string]string{
+		"aead_type": "aes-gcm",
+		"key":       base64.StdEncoding.EncodeToString(key),
+		"key_id":    keyId,
+	}
+}
+
+func TestMultiWrapper(t *testing.T) {
+	ctx := context.Background()
+	fail := new(atomic.Bool)
+	pluginOpts := []pluginutil.Option{
+		pluginutil.WithPluginsMap(map[string]pluginutil.InmemCreationFunc{
+			"aead": func() (interface{}, error) {
+				return aead.NewWrapper(), nil
+			},
+			"failing": func() (interface{}, error) {
+				return &failingWrapper{Wrapper: aead.NewWrapper(), fail: fail}, nil
+			},
+		}),
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, _, err := NewMultiWrapper(ctx, nil, WithPluginOptions(pluginOpts...))
+		require.Error(err)
+		assert.Contains(err.Error(), "no kms configurations")
+
+		_, _, err = NewMultiWrapper(ctx, []*KMS{{Type: "shamir"}}, WithPluginOptions(pluginOpts...))
+		require.Error(err)
+		assert.Contains(err.Error(), "no usable kms")
+
+		_, _, err = NewMultiWrapper(ctx, []*KMS{{Type: "aead", Config: map[string]string{"aead_type": "foobar", "key": "Zm9vYmFy"}}}, WithPluginOptions(pluginOpts...))
+		require.Error(err)
+		assert.Contains(err.Error(), `error configuring kms "aead"`)
+	})
+
+	t.Run("priority-and-failover", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail.Store(false)
+		kmses := []*KMS{
+			{Type: "aead", Config: testAeadKmsConfig(t, "unprioritized")},
+			{Type: "aead", Priority: 2, Config: testAeadKmsConfig(t, "second")},
+			{Type: "failing", Priority: 1, Config: testAeadKmsConfig(t, "first")},
+			{Type: "aead", Priority: 3, Disabled: true, Config: testAeadKmsConfig(t, "disabled")},
+		}
+		multi, cleanup, err := NewMultiWrapper(ctx, kmses, WithPluginOptions(pluginOpts...))
+		require.NoError(err)
+		require.NotNil(cleanup)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+
+		health := multi.Health()
+		require.Len(health, 4)
+		var order []string
+		for _, h := range health {
+			order = append(order, h.KeyId)
+			assert.True(h.Healthy)
+		}
+		assert.Equal([]string{"first", "second", "disabled", "unprioritized"}, order)
+
+		keyId, err := multi.KeyId(ctx)
+		require.NoError(err)
+		assert.Equal("first", keyId)
+
+		firstBlob, err := multi.Encrypt(ctx, []byte("foo"))
+		require.NoError(err)
+		assert.Equal("first", firstBlob.KeyInfo.KeyId)
+
+		// Fail the first KMS; encryption should move to the second
+		fail.Store(true)
+		secondBlob, err := multi.Encrypt(ctx, []byte("bar"))
+		require.NoError(err)
+		assert.Equal("second", secondBlob.KeyInfo.KeyId)
+
+		health = multi.Health()
+		assert.False(health[0].Healthy)
+		assert.Error(health[0].LastError)
+		assert.True(health[1].Healthy)
+
+		keyId, err = multi.KeyId(ctx)
+		require.NoError(err)
+		assert.Equal("second", keyId)
+
+		// Both values should still decrypt
+		pt, err := multi.Decrypt(ctx, firstBlob)
+		require.NoError(err)
+		assert.Equal("foo", string(pt))
+		pt, err = multi.Decrypt(ctx, secondBlob)
+		require.NoError(err)
+		assert.Equal("bar", string(pt))
+
+		// A value with a missing key ID fails over to every KMS
+		secondBlob.KeyInfo = nil
+		pt, err = multi.Decrypt(ctx, secondBlob)
+		require.NoError(err)
+		assert.Equal("bar", string(pt))
+
+		// Recovery of the first KMS is not noticed until it is checked again
+		fail.Store(false)
+		blob, err := multi.Encrypt(ctx, []byte("baz"))
+		require.NoError(err)
+		assert.Equal("second", blob.KeyInfo.KeyId)
+		assert.False(multi.Health()[0].Healthy)
+	})
+
+	t.Run("all-unavailable", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail.Store(true)
+		kmses := []*KMS{
+			{Type: "failing", Config: testAeadKmsConfig(t, "first")},
+			{Type: "aead", Disabled: true, Config: testAeadKmsConfig(t, "disabled")},
+		}
+		multi, cleanup, err := NewMultiWrapper(ctx, kmses, WithPluginOptions(pluginOpts...))
+		require.NoError(err)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+
+		_, err = multi.Encrypt(ctx, []byte("foo"))
+		require.Error(err)
+		assert.ErrorIs(err, ErrNoHealthyKms)
+
+		// The disabled KMS is still healthy, so this is a decryption failure
+		_, err = multi.Decrypt(ctx, &wrapping.BlobInfo{Ciphertext: make([]byte, 32)})
+		require.Error(err)
+		assert.ErrorIs(err, ErrKmsDecryptFailed)
+		assert.NotErrorIs(err, ErrNoHealthyKms)
+
+		multi, cleanup, err = NewMultiWrapper(ctx, kmses[:1], WithPluginOptions(pluginOpts...))
+		require.NoError(err)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+		_, err = multi.Encrypt(ctx, []byte("foo"))
+		require.Error(err)
+		_, err = multi.Decrypt(ctx, &wrapping.BlobInfo{Ciphertext: make([]byte, 32)})
+		require.Error(err)
+		assert.ErrorIs(err, ErrNoHealthyKms)
+	})
+
+	t.Run("undecryptable", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail.Store(false)
+		kmses := []*KMS{
+			{Type: "aead", Config: testAeadKmsConfig(t, "first")},
+			{Type: "aead", Config: testAeadKmsConfig(t, "second")},
+		}
+		multi, cleanup, err := NewMultiWrapper(ctx, kmses, WithPluginOptions(pluginOpts...))
+		require.NoError(err)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+
+		_, err = multi.Decrypt(ctx, &wrapping.BlobInfo{Ciphertext: make([]byte, 32)})
+		require.Error(err)
+		assert.ErrorIs(err, ErrKmsDecryptFailed)
+		assert.NotErrorIs(err, ErrNoHealthyKms)
+		for _, h := range multi.Health() {
+			assert.True(h.Healthy)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		fail.Store(false)
+		kmses := []*KMS{
+			{Type: "failing", Priority: 1, Config: testAeadKmsConfig(t, "first")},
+			{Type: "aead", Priority: 2, Config: testAeadKmsConfig(t, "second")},
+		}
+		multi, cleanup, err := NewMultiWrapper(ctx, kmses, WithPluginOptions(pluginOpts...))
+		require.NoError(err)
+		t.Cleanup(func() { require.NoError(cleanup()) })
+
+		// A canceled request neither fails over nor marks any KMS unhealthy
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = multi.Encrypt(cancelCtx, []byte("foo"))
+		require.Error(err)
+		assert.ErrorIs(err, context.Canceled)
+		assert.NotErrorIs(err, ErrNoHealthyKms)
+		for _, h := range multi.Health() {
+			assert.True(h.Healthy)
+			assert.NoError(h.LastError)
+		}
+
+		blob, err := multi.Encrypt(ctx, []byte("foo"))
+		require.NoError(err)
+		assert.Equal("first", blob.KeyInfo.KeyId)
+	})
+}
+
+func TestMultiWrapperFilePlugin(t *testing.T) {
+	pluginPath := os.Getenv("PLUGIN_PATH")
+	if pluginPath == "" {
+		t.Skipf("skipping plugin test as no PLUGIN_PATH specified")
+	}
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+
+	pluginBytes, err := os.ReadFile(pluginPath)
+	require.NoError(err)
+	sha2256Bytes := sha256.Sum256(pluginBytes)
+
+	kmses, err := ParseKMSes(fmt.Sprintf(`
+		kms "aead" {
+			purpose = "root"
+			priority = 2
+			key_id = "second"
+			plugin_path = "%[1]s"
+			plugin_checksum = "%[2]s"
+		}
+		kms "aead" {
+			purpose = "root"
+			priority = 1
+			key_id = "first"
+			plugin_path = "%[1]s"
+			plugin_checksum = "%[2]s"
+		}
+		`, pluginPath, hex.EncodeToString(sha2256Bytes[:])))
+	require.NoError(err)
+	require.Len(kmses, 2)
+
+	multi, cleanup, err := NewMultiWrapper(ctx, kmses)
+	require.NoError(err)
+	t.Cleanup(func() { require.NoError(cleanup()) })
+
+	health := multi.Health()
+	require.Len(health, 2)
+	assert.Equal("first", health[0].KeyId)
+	assert.Equal("second", health[1].KeyId)
+
+	blob, err := multi.Encrypt(ctx, []byte("secret"))
+	require.NoError(err)
+	assert.Equal("first", blob.KeyInfo.KeyId)
+	decrypted, err := multi.Decrypt(ctx, blob)
+	require.NoError(err)
+	assert.EqualValues("secret", decrypted)
+}
@@ -4,8 +4,12 @@
 package configutil
 
 import (
+	"time"
+
 	"github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
 	"github.com/hashicorp/go-secure-stdlib/listenerutil"
+	"github.com/hashicorp/go-secure-stdlib/plugincontainer"
 	"github.com/hashicorp/go-secure-stdlib/pluginutil/v2"
 )
 
@@ -31,6 +35,21 @@ type options struct {
 	withMaxKmsBlocks    int
 	withLogger          hclog.Logger
 	withListenerOptions []listenerutil.Option
+
+	withKmsVerification     bool
+	withHealthCheckInterval time.Duration
+
+	withPluginContainerConfig *plugincontainer.Config
+
+	withProvenance        bool
+	withDecryptionWrapper wrapping.Wrapper
+	withSourceFile        string
+
+	withConfigValidator   ConfigValidateFunc
+	withWatchFiles        []string
+	withWatchDebounce     time.Duration
+	withWatchPollInterval time.Duration
+	withWatchPolling      bool
 }
 
 func getDefaultOptions() options {
@@ -73,3 +92,106 @@ func WithListenerOptions(opts ...listenerutil.Option) Option {
 		return nil
 	}
 }
+
+// WithKmsVerification causes a configured KMS to be verified by round-tripping
+// a test value through it before it is returned, so that a misconfigured KMS is
+// discovered at startup rather than on first use
+func WithKmsVerification(with bool) Option {
+	return func(o *options) error {
+		o.withKmsVerification = with
+		return nil
+	}
+}
+
+// WithHealthCheckInterval sets the interval between background KMS health
+// checks. 0 uses the lib default, DefaultHealthCheckInterval.
+func WithHealthCheckInterval(with time.Duration) Option {
+	return func(o *options) error {
+		o.withHealthCheckInterval = with
+		return nil
+	}
+}
+
+// WithProvenance causes the parsed configuration to record where each value
+// came from; see SharedConfig.Provenance
+func WithProvenance(with bool) Option {
+	return func(o *options) error {
+		o.withProvenance = with
+		return nil
+	}
+}
+
+// WithDecryptionWrapper provides a wrapper used to decrypt any
+// `{{decrypt()}}` parameters in the configuration before it is parsed
+func WithDecryptionWrapper(with wrapping.Wrapper) Option {
+	return func(o *options) error {
+		o.withDecryptionWrapper = with
+		return nil
+	}
+}
+
+// withSourceFile records the file the configuration was loaded from
+func withSourceFile(with string) Option {
+	return func(o *options) error {
+		o.withSourceFile = with
+		return nil
+	}
+}
+
+// WithPluginContainerConfig provides container runtime settings, such as the
+// OCI runtime, GroupAdd/Rootless socket sharing and resource limits, used when
+// a kms block specifies plugin_container_image. The image, tag and SHA256 are
+// always taken from the kms block.
+func WithPluginContainerConfig(with *plugincontainer.Config) Option {
+	return func(o *options) error {
+		o.withPluginContainerConfig = with
+		return nil
+	}
+}
+
+// WithConfigValidator provides a function used by ConfigWatcher to validate a
+// reloaded config before it is made current
+func WithConfigValidator(with ConfigValidateFunc) Option {
+	return func(o *options) error {
+		o.withConfigValidator = with
+		return nil
+	}
+}
+
+// WithWatchFiles provides additional files, such as TLS certificates, that a
+// ConfigWatcher should watch alongside the config file
+func WithWatchFiles(with ...string) Option {
+	return func(o *options) error {
+		o.withWatchFiles = append(o.withWatchFiles, with...)
+		return nil
+	}
+}
+
+// WithWatchDebounce sets how long a ConfigWatcher waits after the last change
+// before reloading. 0 uses the lib default, DefaultWatchDebounce.
+func WithWatchDebounce(with time.Duration) Option {
+	return func(o *options) error {
+		o.withWatchDebounce = with
+		return nil
+	}
+}
+
+// WithWatchPollInterval sets the interval at which a ConfigWatcher polls for
+// changes when polling is used. 0 uses the lib default,
+// DefaultWatchPollInterval.
+func WithWatchPollInterval(with time.Duration) Option {
+	return func(o *options) error {
+		o.withWatchPollInterval = with
+		return nil
+	}
+}
+
+// WithWatchPolling causes a ConfigWatcher to poll for changes rather than use
+// filesystem notifications, e.g. for network filesystems where notifications
+// are unreliable
+func WithWatchPolling(with bool) Option {
+	return func(o *options) error {
+		o.withWatchPolling = with
+		return nil
+	}
+}
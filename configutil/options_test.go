@@ -5,9 +5,11 @@ package configutil
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-secure-stdlib/listenerutil"
+	"github.com/hashicorp/go-secure-stdlib/plugincontainer"
 	"github.com/hashicorp/go-secure-stdlib/pluginutil/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -66,4 +68,106 @@ func Test_GetOpts(t *testing.T) {
 		require.NotNil(opts)
 		assert.Len(opts.withListenerOptions, 1)
 	})
+	t.Run("with-kms-verification", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.False(opts.withKmsVerification)
+		opts, err = getOpts(WithKmsVerification(true))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.True(opts.withKmsVerification)
+	})
+	t.Run("with-health-check-interval", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Zero(opts.withHealthCheckInterval)
+		opts, err = getOpts(WithHealthCheckInterval(time.Second))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal(time.Second, opts.withHealthCheckInterval)
+	})
+	t.Run("with-provenance", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.False(opts.withProvenance)
+		opts, err = getOpts(WithProvenance(true))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.True(opts.withProvenance)
+	})
+	t.Run("with-decryption-wrapper", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Nil(opts.withDecryptionWrapper)
+		wrapper := new(reversingWrapper)
+		opts, err = getOpts(WithDecryptionWrapper(wrapper))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal(wrapper, opts.withDecryptionWrapper)
+	})
+	t.Run("with-plugin-container-config", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Nil(opts.withPluginContainerConfig)
+		cfg := &plugincontainer.Config{Runtime: "runsc"}
+		opts, err = getOpts(WithPluginContainerConfig(cfg))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal(cfg, opts.withPluginContainerConfig)
+	})
+	t.Run("with-config-validator", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Nil(opts.withConfigValidator)
+		opts, err = getOpts(WithConfigValidator(func(*SharedConfig) error { return nil }))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.NotNil(opts.withConfigValidator)
+	})
+	t.Run("with-watch-files", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Empty(opts.withWatchFiles)
+		opts, err = getOpts(WithWatchFiles("a.pem"), WithWatchFiles("b.pem", "c.pem"))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal([]string{"a.pem", "b.pem", "c.pem"}, opts.withWatchFiles)
+	})
+	t.Run("with-watch-debounce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Zero(opts.withWatchDebounce)
+		opts, err = getOpts(WithWatchDebounce(time.Second))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal(time.Second, opts.withWatchDebounce)
+	})
+	t.Run("with-watch-poll-interval", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.Zero(opts.withWatchPollInterval)
+		opts, err = getOpts(WithWatchPollInterval(time.Second))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.Equal(time.Second, opts.withWatchPollInterval)
+	})
+	t.Run("with-watch-polling", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := getOpts()
+		require.NoError(err)
+		assert.False(opts.withWatchPolling)
+		opts, err = getOpts(WithWatchPolling(true))
+		require.NoError(err)
+		require.NotNil(opts)
+		assert.True(opts.withWatchPolling)
+	})
 }
@@ -0,0 +1,336 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Provenance records where a configuration value came from. It is only
+// populated when parsing with WithProvenance.
+type Provenance struct {
+	// File is the configuration file the value was set in, if known
+	File string
+	// Line is the line in the configuration where the value was set
+	Line int
+	// EnvVar is the environment variable the value was read from via an
+	// env:// path
+	EnvVar string
+	// ReferencedFile is the file the value was read from via a file:// path
+	ReferencedFile string
+	// Decrypted indicates the value was an encrypted parameter that was
+	// decrypted during parsing, see WithDecryptionWrapper
+	Decrypted bool
+	// MergedFrom is the configuration file of the config the value was taken
+	// from when configs were combined via Merge. It is set to "<unknown>" if
+	// that config was not loaded from a file.
+	MergedFrom string
+}
+
+// String returns a human-readable description of the provenance, e.g.
+// "config.hcl:12 (env://CLUSTER_NAME, decrypted)"
+func (p *Provenance) String() string {
+	if p == nil {
+		return ""
+	}
+	loc := p.File
+	if loc == "" {
+		loc = "<config>"
+	}
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, p.Line)
+	}
+	var extra []string
+	if p.EnvVar != "" {
+		extra = append(extra, "env://"+p.EnvVar)
+	}
+	if p.ReferencedFile != "" {
+		extra = append(extra, "file://"+p.ReferencedFile)
+	}
+	if p.Decrypted {
+		extra = append(extra, "decrypted")
+	}
+	if p.MergedFrom != "" {
+		extra = append(extra, "merged from "+p.MergedFrom)
+	}
+	if len(extra) > 0 {
+		loc = fmt.Sprintf("%s (%s)", loc, strings.Join(extra, ", "))
+	}
+	return loc
+}
+
+// toMap returns the provenance in a form suitable for sanitized output
+func (p *Provenance) toMap() map[string]interface{} {
+	ret := map[string]interface{}{
+		"file": p.File,
+		"line": p.Line,
+	}
+	if p.EnvVar != "" {
+		ret["env_var"] = p.EnvVar
+	}
+	if p.ReferencedFile != "" {
+		ret["referenced_file"] = p.ReferencedFile
+	}
+	if p.Decrypted {
+		ret["decrypted"] = true
+	}
+	if p.MergedFrom != "" {
+		ret["merged_from"] = p.MergedFrom
+	}
+	return ret
+}
+
+// Provenance returns where the value for the given key came from, or nil if it
+// is not known. Keys follow the layout of the Sanitized output, e.g.
+// "cluster_name", "listeners[0]", "seals[1]" or "seals[1].config.region".
+func (c *SharedConfig) Provenance(key string) *Provenance {
+	if c == nil || c.provenance == nil {
+		return nil
+	}
+	p, ok := c.provenance[key]
+	if !ok {
+		return nil
+	}
+	ret := *p
+	return &ret
+}
+
+// ProvenanceKeys returns the sorted set of keys for which provenance was
+// recorded
+func (c *SharedConfig) ProvenanceKeys() []string {
+	if c == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(c.provenance))
+	for k := range c.provenance {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SanitizedWithProvenance returns the same values as Sanitized, with an
+// additional "provenance" key containing the recorded provenance of each value.
+// Provenance never contains the values themselves.
+func (c *SharedConfig) SanitizedWithProvenance() map[string]interface{} {
+	result := c.Sanitized()
+	if result == nil || len(c.provenance) == 0 {
+		return result
+	}
+
+	prov := make(map[string]interface{}, len(c.provenance))
+	for k, p := range c.provenance {
+		prov[k] = p.toMap()
+	}
+	result["provenance"] = prov
+	return result
+}
+
+// parsePathFields are the top-level values that are passed through
+// parseutil.ParsePath while parsing
+var parsePathFields = map[string]bool{
+	"cluster_name": true,
+}
+
+// recordProvenance walks the parsed HCL and records the provenance of each
+// top-level value and of each listener and kms block, with the same indexes
+// they have in the resulting SharedConfig. lines maps the parsed lines back to
+// the raw config if it held encrypted parameters.
+func (c *SharedConfig) recordProvenance(list *ast.ObjectList, sourceFile string, lines *configLines) {
+	c.sourceFile = sourceFile
+	c.provenance = make(map[string]*Provenance)
+
+	newProvenance := func(item *ast.ObjectItem) *Provenance {
+		return &Provenance{
+			File:      sourceFile,
+			Line:      lines.sourceLine(itemPos(item).Line),
+			Decrypted: item.Val != nil && lines.isDecrypted(item.Val.Pos().Line),
+		}
+	}
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			continue
+		}
+		key := item.Keys[0].Token.Value().(string)
+		switch key {
+		case "listener", "kms", "seal", "hsm":
+			// Handled below to keep ordering consistent with parsing
+			continue
+		}
+		p := newProvenance(item)
+		if parsePathFields[key] {
+			if lit, ok := item.Val.(*ast.LiteralType); ok && lit.Token.Type == token.STRING {
+				p.EnvVar, p.ReferencedFile = pathReference(lit.Token.Value().(string))
+			}
+		}
+		c.provenance[key] = p
+	}
+
+	for i, item := range list.Filter("listener").Items {
+		c.provenance[fmt.Sprintf("listeners[%d]", i)] = newProvenance(item)
+	}
+
+	// filterKMSes parses hsm, then seal, then kms blocks
+	var sealIdx int
+	for _, blockName := range []string{"hsm", "seal", "kms"} {
+		for _, item := range list.Filter(blockName).Items {
+			sealKey := fmt.Sprintf("seals[%d]", sealIdx)
+			c.provenance[sealKey] = newProvenance(item)
+			if obj, ok := item.Val.(*ast.ObjectType); ok {
+				for _, field := range obj.List.Items {
+					if len(field.Keys) == 0 {
+						continue
+					}
+					fieldKey := field.Keys[0].Token.Value().(string)
+					switch fieldKey {
+					case "purpose", "disabled", "priority", "plugin_path", "plugin_checksum", "plugin_hash_method",
+						"plugin_container_image", "plugin_container_tag", "plugin_container_sha256":
+						c.provenance[fmt.Sprintf("%s.%s", sealKey, fieldKey)] = newProvenance(field)
+					default:
+						c.provenance[fmt.Sprintf("%s.config.%s", sealKey, fieldKey)] = newProvenance(field)
+					}
+				}
+			}
+			sealIdx++
+		}
+	}
+}
+
+// itemPos returns the position of the first key of the item, or of its value
+// if it has no keys
+func itemPos(item *ast.ObjectItem) token.Pos {
+	if len(item.Keys) > 0 {
+		return item.Keys[0].Pos()
+	}
+	return item.Val.Pos()
+}
+
+// pathReference returns the env var or file referenced by a value that will be
+// passed through parseutil.ParsePath, if any
+func pathReference(raw string) (envVar, file string) {
+	trimmed := strings.TrimSpace(raw)
+	parsed, err := url.Parse(trimmed)
+	if err != nil {
+		return "", ""
+	}
+	switch parsed.Scheme {
+	case "env":
+		return strings.TrimPrefix(trimmed, "env://"), ""
+	case "file":
+		return "", strings.TrimPrefix(trimmed, "file://")
+	}
+	return "", ""
+}
+
+// mergeProvenance copies the provenance from src into dst, marking it as merged
+// and offsetting listener and seal indexes by the given amounts. Top-level keys
+// are skipped if fromSrc reports that the value was not taken from src.
+func mergeProvenance(dst map[string]*Provenance, src *SharedConfig, listenerOffset, sealOffset int, fromSrc map[string]bool) {
+	mergedFrom := src.sourceFile
+	if mergedFrom == "" {
+		mergedFrom = "<unknown>"
+	}
+	for k, p := range src.provenance {
+		if taken, ok := fromSrc[k]; ok && !taken {
+			continue
+		}
+		np := *p
+		if np.MergedFrom == "" {
+			np.MergedFrom = mergedFrom
+		}
+		dst[offsetProvenanceKey(k, listenerOffset, sealOffset)] = &np
+	}
+}
+
+// offsetProvenanceKey shifts the index of a "listeners[n]" or "seals[n]" key
+func offsetProvenanceKey(key string, listenerOffset, sealOffset int) string {
+	for prefix, offset := range map[string]int{"listeners[": listenerOffset, "seals[": sealOffset} {
+		if !strings.HasPrefix(key, prefix) || offset == 0 {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return key
+		}
+		var idx int
+		if _, err := fmt.Sscanf(rest[:end], "%d", &idx); err != nil {
+			return key
+		}
+		return fmt.Sprintf("%s%d%s", prefix, idx+offset, rest[end:])
+	}
+	return key
+}
+
+// configLines maps the lines of a config after its encrypted parameters are
+// decrypted back to the lines of the raw config, as decrypted values may span
+// several lines
+type configLines struct {
+	// source holds the raw line of each decrypted line, indexed from zero
+	source []int
+	// decrypted contains the decrypted lines that hold decrypted values
+	decrypted map[int]bool
+}
+
+// sourceLine returns the raw line of the given decrypted line. A nil
+// configLines is the identity.
+func (l *configLines) sourceLine(line int) int {
+	if l == nil || line < 1 || line > len(l.source) {
+		return line
+	}
+	return l.source[line-1]
+}
+
+// isDecrypted returns whether the given decrypted line holds a decrypted
+// value
+func (l *configLines) isDecrypted(line int) bool {
+	return l != nil && l.decrypted[line]
+}
+
+// decryptConfig decrypts the encrypted parameters in raw as EncryptDecrypt
+// does, also returning the mapping of the resulting lines to those of raw
+func decryptConfig(raw string, wrapper wrapping.Wrapper) (string, *configLines, error) {
+	lines := &configLines{
+		source:    []int{1},
+		decrypted: make(map[int]bool),
+	}
+	srcLine := 1
+
+	var out strings.Builder
+	var prev int
+	for _, loc := range decryptRegex.FindAllStringIndex(raw, -1) {
+		plain := raw[prev:loc[0]]
+		out.WriteString(plain)
+		for i := strings.Count(plain, "\n"); i > 0; i-- {
+			srcLine++
+			lines.source = append(lines.source, srcLine)
+		}
+
+		dec, err := EncryptDecrypt(raw[loc[0]:loc[1]], true, true, wrapper)
+		if err != nil {
+			return "", nil, err
+		}
+		out.WriteString(dec)
+		lines.decrypted[len(lines.source)] = true
+		for i := strings.Count(dec, "\n"); i > 0; i-- {
+			lines.source = append(lines.source, srcLine)
+			lines.decrypted[len(lines.source)] = true
+		}
+		prev = loc[1]
+	}
+	out.WriteString(raw[prev:])
+	for i := strings.Count(raw[prev:], "\n"); i > 0; i-- {
+		srcLine++
+		lines.source = append(lines.source, srcLine)
+	}
+	return out.String(), lines, nil
+}
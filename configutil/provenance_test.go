@@ -0,0 +1,167 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProvenance(t *testing.T) {
+	tmpDir := t.TempDir()
+	pidFile := filepath.Join(tmpDir, "pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte("/var/run/app.pid"), 0o600))
+	t.Setenv("PROVENANCE_CLUSTER_NAME", "from-env")
+
+	reverser := new(reversingWrapper)
+	encrypted, err := EncryptDecrypt(`log_level = "{{encrypt(warn)}}"`, false, false, reverser)
+	require.NoError(t, err)
+
+	configFile := filepath.Join(tmpDir, "config.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+cluster_name = "env://PROVENANCE_CLUSTER_NAME"
+`+encrypted+`
+
+listener "tcp" {
+	address = "127.0.0.1:8200"
+}
+
+kms "aead" {
+	purpose = "root"
+	aead_type = "aes-gcm"
+}
+`), 0o600))
+
+	t.Run("disabled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		conf, err := LoadConfigFile(configFile, WithDecryptionWrapper(reverser))
+		require.NoError(err)
+		assert.Empty(conf.ProvenanceKeys())
+		assert.Nil(conf.Provenance("cluster_name"))
+		assert.NotContains(conf.SanitizedWithProvenance(), "provenance")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		conf, err := LoadConfigFile(configFile, WithProvenance(true), WithDecryptionWrapper(reverser))
+		require.NoError(err)
+		assert.Equal("from-env", conf.ClusterName)
+		assert.Equal("warn", conf.LogLevel)
+
+		assert.Equal([]string{
+			"cluster_name",
+			"listeners[0]",
+			"log_level",
+			"seals[0]",
+			"seals[0].config.aead_type",
+			"seals[0].purpose",
+		}, conf.ProvenanceKeys())
+
+		assert.Equal(&Provenance{File: configFile, Line: 2, EnvVar: "PROVENANCE_CLUSTER_NAME"}, conf.Provenance("cluster_name"))
+		assert.Equal(&Provenance{File: configFile, Line: 3, Decrypted: true}, conf.Provenance("log_level"))
+		assert.Equal(&Provenance{File: configFile, Line: 5}, conf.Provenance("listeners[0]"))
+		assert.Equal(&Provenance{File: configFile, Line: 9}, conf.Provenance("seals[0]"))
+		assert.Equal(&Provenance{File: configFile, Line: 11}, conf.Provenance("seals[0].config.aead_type"))
+		assert.Equal(configFile+":2 (env://PROVENANCE_CLUSTER_NAME)", conf.Provenance("cluster_name").String())
+		assert.Equal(configFile+":3 (decrypted)", conf.Provenance("log_level").String())
+
+		// Returned values are copies
+		conf.Provenance("log_level").Line = 100
+		assert.Equal(3, conf.Provenance("log_level").Line)
+
+		sanitized := conf.SanitizedWithProvenance()
+		require.Contains(sanitized, "provenance")
+		prov := sanitized["provenance"].(map[string]interface{})
+		assert.Equal(map[string]interface{}{"file": configFile, "line": 3, "decrypted": true}, prov["log_level"])
+		assert.Equal(map[string]interface{}{"file": configFile, "line": 2, "env_var": "PROVENANCE_CLUSTER_NAME"}, prov["cluster_name"])
+	})
+
+	t.Run("referenced-file", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		conf, err := ParseConfig(`cluster_name = "file://`+pidFile+`"`, WithProvenance(true))
+		require.NoError(err)
+		assert.Equal(&Provenance{Line: 1, ReferencedFile: pidFile}, conf.Provenance("cluster_name"))
+		assert.Equal("<config>:1 (file://"+pidFile+")", conf.Provenance("cluster_name").String())
+	})
+
+	t.Run("container-seal", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		conf, err := ParseConfig(`
+kms "aead" {
+	purpose = "root"
+	plugin_container_image = "example/aead"
+	plugin_container_tag = "1.0"
+	plugin_container_sha256 = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	aead_type = "aes-gcm"
+}
+`, WithProvenance(true))
+		require.NoError(err)
+		assert.Equal([]string{
+			"seals[0]",
+			"seals[0].config.aead_type",
+			"seals[0].plugin_container_image",
+			"seals[0].plugin_container_sha256",
+			"seals[0].plugin_container_tag",
+			"seals[0].purpose",
+		}, conf.ProvenanceKeys())
+		assert.Equal(&Provenance{Line: 4}, conf.Provenance("seals[0].plugin_container_image"))
+		assert.Equal(&Provenance{Line: 5}, conf.Provenance("seals[0].plugin_container_tag"))
+		assert.Equal(&Provenance{Line: 6}, conf.Provenance("seals[0].plugin_container_sha256"))
+	})
+
+	t.Run("multi-line-decrypted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		blob, err := reverser.Encrypt(context.Background(), []byte("log_level = \"warn\"\nlog_format = \"json\""), nil)
+		require.NoError(err)
+		msg, err := proto.Marshal(blob)
+		require.NoError(err)
+
+		// Lines after a decrypted value spanning several lines keep their
+		// line in the raw config
+		conf, err := ParseConfig(`
+{{decrypt(`+base64.RawURLEncoding.EncodeToString(msg)+`)}}
+pid_file = "/var/run/app.pid"
+`, WithProvenance(true), WithDecryptionWrapper(reverser))
+		require.NoError(err)
+		assert.Equal("json", conf.LogFormat)
+		assert.Equal(&Provenance{Line: 2, Decrypted: true}, conf.Provenance("log_level"))
+		assert.Equal(&Provenance{Line: 2, Decrypted: true}, conf.Provenance("log_format"))
+		assert.Equal(&Provenance{Line: 3}, conf.Provenance("pid_file"))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		base, err := LoadConfigFile(configFile, WithProvenance(true), WithDecryptionWrapper(reverser))
+		require.NoError(err)
+		override, err := ParseConfig(`
+log_level = "trace"
+pid_file = "/tmp/pid"
+
+kms "aead" {
+	purpose = "worker-auth"
+}
+`, WithProvenance(true))
+		require.NoError(err)
+
+		merged := base.Merge(override)
+		require.Len(merged.Seals, 2)
+		assert.Equal("trace", merged.LogLevel)
+		assert.Equal(&Provenance{Line: 2, MergedFrom: "<unknown>"}, merged.Provenance("log_level"))
+		assert.Equal(&Provenance{Line: 3, MergedFrom: "<unknown>"}, merged.Provenance("pid_file"))
+		assert.Equal(&Provenance{File: configFile, Line: 2, EnvVar: "PROVENANCE_CLUSTER_NAME", MergedFrom: configFile}, merged.Provenance("cluster_name"))
+		assert.Equal(&Provenance{File: configFile, Line: 9, MergedFrom: configFile}, merged.Provenance("seals[0]"))
+		assert.Equal(&Provenance{Line: 5, MergedFrom: "<unknown>"}, merged.Provenance("seals[1]"))
+		assert.Equal(&Provenance{Line: 6, MergedFrom: "<unknown>"}, merged.Provenance("seals[1].purpose"))
+
+		// Merging configs without provenance doesn't create any
+		assert.Empty(new(SharedConfig).Merge(new(SharedConfig)).ProvenanceKeys())
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// RedactionAction specifies how a value is treated in sanitized output
+type RedactionAction int
+
+const (
+	// RedactionUnspecified defers to the default for the enclosing block
+	RedactionUnspecified RedactionAction = iota
+	// RedactionRemove omits the value entirely
+	RedactionRemove
+	// RedactionHash replaces the value with a hash of it, allowing values to be
+	// compared without being shown
+	RedactionHash
+	// RedactionShow includes the value as-is
+	RedactionShow
+)
+
+func (a RedactionAction) String() string {
+	switch a {
+	case RedactionRemove:
+		return "remove"
+	case RedactionHash:
+		return "hash"
+	case RedactionShow:
+		return "show"
+	default:
+		return "unspecified"
+	}
+}
+
+// RedactionPolicy controls which values from KMS and listener blocks are
+// included in sanitized output. The zero value matches the behavior of
+// Sanitized: all KMS config values are removed and all listener config values
+// are shown.
+type RedactionPolicy struct {
+	// Kms maps a KMS type to the actions for keys within its Config
+	Kms map[string]map[string]RedactionAction
+	// KmsDefault is the action for KMS config keys not found in Kms. If
+	// unspecified, such keys are removed.
+	KmsDefault RedactionAction
+
+	// Listeners maps a listener type to the actions for keys within its raw
+	// config
+	Listeners map[string]map[string]RedactionAction
+	// ListenerDefault is the action for listener config keys not found in
+	// Listeners. If unspecified, such keys are shown.
+	ListenerDefault RedactionAction
+
+	// HashKey, if set, is used to compute an HMAC-SHA256 of hashed values
+	// rather than a plain SHA-256, to prevent guessing low-entropy values
+	HashKey []byte
+}
+
+// DefaultRedactionPolicy returns a policy that, for each known KMS type, shows
+// the same non-sensitive config values that are reported as info when the
+// wrapper is configured (for instance region and key ID) and removes all
+// others. Listener config is shown.
+func DefaultRedactionPolicy() *RedactionPolicy {
+	p := &RedactionPolicy{
+		Kms: make(map[string]map[string]RedactionAction),
+	}
+	for _, kmsType := range knownKmsTypes {
+		fields := kmsInfoFields(kmsType)
+		if len(fields) == 0 {
+			continue
+		}
+		actions := make(map[string]RedactionAction, len(fields))
+		for _, field := range fields {
+			actions[field.key] = RedactionShow
+		}
+		p.Kms[kmsType] = actions
+	}
+	return p
+}
+
+// SanitizedWithPolicy returns the same values as Sanitized, but with KMS and
+// listener config values included or redacted according to the given policy.
+// A nil policy is equivalent to calling Sanitized.
+func (c *SharedConfig) SanitizedWithPolicy(policy *RedactionPolicy) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	if policy == nil {
+		policy = new(RedactionPolicy)
+	}
+
+	result := map[string]interface{}{
+		"disable_mlock": c.DisableMlock,
+
+		"default_max_request_duration": c.DefaultMaxRequestDuration,
+
+		"log_level":  c.LogLevel,
+		"log_format": c.LogFormat,
+
+		"pid_file": c.PidFile,
+
+		"cluster_name": c.ClusterName,
+	}
+
+	// Sanitize listeners
+	if len(c.Listeners) != 0 {
+		var sanitizedListeners []interface{}
+		for _, ln := range c.Listeners {
+			cleanLn := map[string]interface{}{
+				"type":   ln.Type,
+				"config": policy.redact(ln.RawConfig, policy.Listeners[ln.Type], policy.ListenerDefault, RedactionShow),
+			}
+			sanitizedListeners = append(sanitizedListeners, cleanLn)
+		}
+		result["listeners"] = sanitizedListeners
+	}
+
+	// Sanitize seals stanza
+	if len(c.Seals) != 0 {
+		var sanitizedSeals []interface{}
+		for _, s := range c.Seals {
+			cleanSeal := map[string]interface{}{
+				"type":     s.Type,
+				"disabled": s.Disabled,
+			}
+			raw := make(map[string]interface{}, len(s.Config))
+			for k, v := range s.Config {
+				raw[k] = v
+			}
+			if config := policy.redact(raw, policy.Kms[s.Type], policy.KmsDefault, RedactionRemove); len(config) > 0 {
+				cleanSeal["config"] = config
+			}
+			sanitizedSeals = append(sanitizedSeals, cleanSeal)
+		}
+		result["seals"] = sanitizedSeals
+	}
+
+	// Sanitize telemetry stanza
+	if c.Telemetry != nil {
+		result["telemetry"] = SanitizeTelemetry(c.Telemetry)
+	}
+
+	return result
+}
+
+// redact applies the given actions to a copy of the config
+func (p *RedactionPolicy) redact(
+	config map[string]interface{},
+	actions map[string]RedactionAction,
+	blockDefault RedactionAction,
+	libDefault RedactionAction,
+) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+	if blockDefault == RedactionUnspecified {
+		blockDefault = libDefault
+	}
+
+	ret := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		action := actions[k]
+		if action == RedactionUnspecified {
+			action = blockDefault
+		}
+		switch action {
+		case RedactionShow:
+			ret[k] = v
+		case RedactionHash:
+			ret[k] = p.hash(v)
+		}
+	}
+	return ret
+}
+
+// hash returns a hex-encoded hash of the value, prefixed with the algorithm
+func (p *RedactionPolicy) hash(v interface{}) string {
+	var h hash.Hash
+	prefix := "sha256"
+	switch {
+	case len(p.HashKey) > 0:
+		h = hmac.New(sha256.New, p.HashKey)
+		prefix = "hmac-sha256"
+	default:
+		h = sha256.New()
+	}
+	switch val := v.(type) {
+	case string:
+		h.Write([]byte(val))
+	default:
+		fmt.Fprintf(h, "%v", val)
+	}
+	return fmt.Sprintf("%s:%s", prefix, hex.EncodeToString(h.Sum(nil)))
+}
@@ -0,0 +1,140 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizedWithPolicy(t *testing.T) {
+	conf, err := ParseConfig(`
+cluster_name = "test-cluster"
+
+listener "tcp" {
+	address = "127.0.0.1:8200"
+	tls_key_file = "/etc/tls/key.pem"
+}
+
+kms "awskms" {
+	purpose = "root"
+	region = "us-east-1"
+	kms_key_id = "alias/root"
+	access_key = "AKIAEXAMPLE"
+	secret_key = "supersecret"
+}
+
+kms "aead" {
+	purpose = "worker-auth"
+	aead_type = "aes-gcm"
+	key = "c2VjcmV0"
+}
+`)
+	require.NoError(t, err)
+
+	sha := func(v string) string {
+		sum := sha256.Sum256([]byte(v))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	t.Run("nil-policy", func(t *testing.T) {
+		assert := assert.New(t)
+		sanitized := conf.SanitizedWithPolicy(nil)
+		assert.Equal(conf.Sanitized(), sanitized)
+		assert.Equal([]interface{}{
+			map[string]interface{}{"type": "awskms", "disabled": false},
+			map[string]interface{}{"type": "aead", "disabled": false},
+		}, sanitized["seals"])
+		assert.Equal([]interface{}{
+			map[string]interface{}{"type": "tcp", "config": map[string]interface{}{
+				"address":      "127.0.0.1:8200",
+				"tls_key_file": "/etc/tls/key.pem",
+			}},
+		}, sanitized["listeners"])
+	})
+
+	t.Run("default-policy", func(t *testing.T) {
+		assert := assert.New(t)
+		sanitized := conf.SanitizedWithPolicy(DefaultRedactionPolicy())
+		assert.Equal([]interface{}{
+			map[string]interface{}{"type": "awskms", "disabled": false, "config": map[string]interface{}{
+				"region":     "us-east-1",
+				"kms_key_id": "alias/root",
+			}},
+			map[string]interface{}{"type": "aead", "disabled": false, "config": map[string]interface{}{
+				"aead_type": "aes-gcm",
+			}},
+		}, sanitized["seals"])
+		assert.Equal(conf.Sanitized()["listeners"], sanitized["listeners"])
+	})
+
+	t.Run("custom-policy", func(t *testing.T) {
+		assert := assert.New(t)
+		policy := DefaultRedactionPolicy()
+		policy.Kms["awskms"]["access_key"] = RedactionHash
+		policy.Kms["awskms"]["region"] = RedactionRemove
+		policy.Listeners = map[string]map[string]RedactionAction{
+			"tcp": {"address": RedactionShow},
+		}
+		policy.ListenerDefault = RedactionHash
+		sanitized := conf.SanitizedWithPolicy(policy)
+		assert.Equal([]interface{}{
+			map[string]interface{}{"type": "awskms", "disabled": false, "config": map[string]interface{}{
+				"kms_key_id": "alias/root",
+				"access_key": sha("AKIAEXAMPLE"),
+			}},
+			map[string]interface{}{"type": "aead", "disabled": false, "config": map[string]interface{}{
+				"aead_type": "aes-gcm",
+			}},
+		}, sanitized["seals"])
+		assert.Equal([]interface{}{
+			map[string]interface{}{"type": "tcp", "config": map[string]interface{}{
+				"address":      "127.0.0.1:8200",
+				"tls_key_file": sha("/etc/tls/key.pem"),
+			}},
+		}, sanitized["listeners"])
+
+		// The underlying config is not modified
+		assert.Equal("/etc/tls/key.pem", conf.Listeners[0].RawConfig["tls_key_file"])
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		assert := assert.New(t)
+		policy := &RedactionPolicy{
+			KmsDefault: RedactionHash,
+			HashKey:    []byte("hash-key"),
+		}
+		mac := hmac.New(sha256.New, []byte("hash-key"))
+		mac.Write([]byte("supersecret"))
+		sanitized := conf.SanitizedWithPolicy(policy)
+		seals := sanitized["seals"].([]interface{})
+		awsConfig := seals[0].(map[string]interface{})["config"].(map[string]interface{})
+		assert.Equal("hmac-sha256:"+hex.EncodeToString(mac.Sum(nil)), awsConfig["secret_key"])
+		assert.Len(awsConfig, 4)
+	})
+}
+
+func TestPopulateInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	var infoKeys []string
+	info := make(map[string]string)
+	populateInfo(&KMS{Type: "awskms"}, &infoKeys, &info, map[string]string{
+		"region":     "us-east-1",
+		"kms_key_id": "alias/root",
+	})
+	assert.ElementsMatch([]string{"AWS KMS Region", "AWS KMS KeyID"}, infoKeys)
+	assert.Equal("alias/root", info["AWS KMS KeyID"])
+
+	infoKeys, info = nil, make(map[string]string)
+	populateInfo(&KMS{Type: "aead", Purpose: []string{"root"}}, &infoKeys, &info, map[string]string{
+		"aead_type": "aes-gcm",
+	})
+	assert.Equal(map[string]string{"[root] AEAD Type": "aes-gcm"}, info)
+}
@@ -0,0 +1,443 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// DefaultWatchDebounce is the time a ConfigWatcher waits after the last
+	// change before reloading, if WithWatchDebounce is not provided
+	DefaultWatchDebounce = 500 * time.Millisecond
+	// DefaultWatchPollInterval is the interval at which a ConfigWatcher polls
+	// files when filesystem notifications are unavailable, if
+	// WithWatchPollInterval is not provided
+	DefaultWatchPollInterval = 5 * time.Second
+)
+
+// fileRefRegex matches file:// references in a raw config, which are resolved
+// via parseutil.ParsePath when parsing
+var fileRefRegex = regexp.MustCompile(`"\s*file://([^"]+)"`)
+
+// ConfigReloadFunc is called by a ConfigWatcher after each reload. On success
+// it receives the new config and a nil error; on failure it receives a nil
+// config and the error, and the previous config remains current.
+type ConfigReloadFunc func(*SharedConfig, error)
+
+// ConfigValidateFunc can be provided via WithConfigValidator to perform
+// application-specific validation of a reloaded config before it is accepted
+type ConfigValidateFunc func(*SharedConfig) error
+
+// fileState is used to detect changes when polling
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// ConfigWatcher watches a config file, any additional files given via
+// WithWatchFiles, and any files referenced via file:// paths within the config.
+// When they change, it waits for changes to settle, re-parses the config with
+// LoadConfigFile and reports the result to a callback. A config that fails to
+// parse or validate is never made current.
+//
+// Filesystem notifications are used where available, with polling as a
+// fallback. Reloads, whether triggered by changes or by Reload, are
+// serialized.
+type ConfigWatcher struct {
+	path         string
+	parseOpts    []Option
+	callback     ConfigReloadFunc
+	validator    ConfigValidateFunc
+	extraFiles   []string
+	debounce     time.Duration
+	pollInterval time.Duration
+	forcePolling bool
+	logger       hclog.Logger
+
+	l         sync.RWMutex
+	current   *SharedConfig
+	files     []string
+	pollState map[string]fileState
+	cancel    context.CancelFunc
+	doneCh    chan struct{}
+
+	// reloadCh passes manual reloads to the run goroutine while the watcher
+	// is running; reloadLock serializes them while it is not
+	reloadCh   chan chan struct{}
+	reloadLock sync.Mutex
+}
+
+// NewConfigWatcher loads the config at the given path and returns a watcher
+// for it. An error is returned if the initial load fails. The given options
+// are also used when re-parsing the config.
+//
+// Supported options (in addition to those of LoadConfigFile):
+//   - WithLogger
+//   - WithConfigValidator
+//   - WithWatchFiles
+//   - WithWatchDebounce
+//   - WithWatchPollInterval
+//   - WithWatchPolling
+func NewConfigWatcher(path string, callback ConfigReloadFunc, opt ...Option) (*ConfigWatcher, error) {
+	if path == "" {
+		return nil, errors.New("config path is empty")
+	}
+	if callback == nil {
+		return nil, errors.New("nil reload callback passed in")
+	}
+	opts, err := getOpts(opt...)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config options: %w", err)
+	}
+
+	w := &ConfigWatcher{
+		path:         path,
+		parseOpts:    opt,
+		callback:     callback,
+		validator:    opts.withConfigValidator,
+		extraFiles:   opts.withWatchFiles,
+		debounce:     opts.withWatchDebounce,
+		pollInterval: opts.withWatchPollInterval,
+		forcePolling: opts.withWatchPolling,
+		logger:       opts.withLogger,
+	}
+	if w.debounce <= 0 {
+		w.debounce = DefaultWatchDebounce
+	}
+	if w.pollInterval <= 0 {
+		w.pollInterval = DefaultWatchPollInterval
+	}
+	if w.logger == nil {
+		w.logger = hclog.NewNullLogger()
+	}
+
+	conf, files, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current = conf
+	w.files = files
+	w.pollState = statFiles(files)
+
+	return w, nil
+}
+
+// Config returns the current config
+func (w *ConfigWatcher) Config() *SharedConfig {
+	w.l.RLock()
+	defer w.l.RUnlock()
+	return w.current
+}
+
+// WatchedFiles returns the sorted set of files currently being watched
+func (w *ConfigWatcher) WatchedFiles() []string {
+	w.l.RLock()
+	defer w.l.RUnlock()
+	ret := make([]string, len(w.files))
+	copy(ret, w.files)
+	return ret
+}
+
+// Reload re-parses the config immediately, making it current and calling the
+// callback as a change would. It returns once the reload has completed.
+func (w *ConfigWatcher) Reload() {
+	w.l.RLock()
+	reloadCh, doneCh := w.reloadCh, w.doneCh
+	w.l.RUnlock()
+
+	if reloadCh != nil {
+		// Hand the reload to the run goroutine, unless it stops first
+		reloaded := make(chan struct{})
+		select {
+		case reloadCh <- reloaded:
+			select {
+			case <-reloaded:
+			case <-doneCh:
+			}
+			return
+		case <-doneCh:
+		}
+	}
+
+	w.reloadLock.Lock()
+	defer w.reloadLock.Unlock()
+	w.reload(nil)
+}
+
+// Start begins watching in the background until Stop is called or the context
+// is canceled. It returns an error if the watcher is already running. If the
+// watched files cannot be watched for notifications, for instance as their
+// directory does not exist yet, they are polled instead.
+func (w *ConfigWatcher) Start(ctx context.Context) error {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.cancel != nil {
+		return errors.New("config watcher is already running")
+	}
+
+	var fsw *fsnotify.Watcher
+	if !w.forcePolling {
+		var err error
+		fsw, err = fsnotify.NewWatcher()
+		if err != nil {
+			w.logger.Warn("filesystem notifications unavailable, falling back to polling", "error", err)
+			fsw = nil
+		}
+	}
+	if fsw != nil {
+		if err := watchDirs(fsw, w.files); err != nil {
+			w.logger.Warn("error watching config files, falling back to polling", "error", err)
+			_ = fsw.Close()
+			fsw = nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	doneCh := make(chan struct{})
+	reloadCh := make(chan chan struct{})
+	w.cancel = cancel
+	w.doneCh = doneCh
+	w.reloadCh = reloadCh
+
+	go w.run(ctx, fsw, reloadCh, doneCh)
+
+	return nil
+}
+
+// Stop stops watching and waits for any in-progress reload to finish. It is
+// safe to call if the watcher is not running.
+func (w *ConfigWatcher) Stop() {
+	w.l.Lock()
+	cancel, doneCh := w.cancel, w.doneCh
+	w.cancel, w.doneCh, w.reloadCh = nil, nil, nil
+	w.l.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-doneCh
+}
+
+func (w *ConfigWatcher) run(ctx context.Context, fsw *fsnotify.Watcher, reloadCh chan chan struct{}, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	var events chan fsnotify.Event
+	var fsErrors chan error
+	var pollCh <-chan time.Time
+	var ticker *time.Ticker
+	startPolling := func() {
+		ticker = time.NewTicker(w.pollInterval)
+		pollCh = ticker.C
+	}
+	defer func() {
+		if fsw != nil {
+			_ = fsw.Close()
+		}
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	switch {
+	case fsw != nil:
+		events, fsErrors = fsw.Events, fsw.Errors
+	default:
+		startPolling()
+	}
+
+	// reload reloads the config, switching to polling if the files it
+	// references can no longer be watched
+	reload := func() {
+		if err := w.reload(fsw); err != nil {
+			w.logger.Warn("error watching config files, falling back to polling", "error", err)
+			_ = fsw.Close()
+			fsw, events, fsErrors = nil, nil, nil
+			startPolling()
+		}
+	}
+
+	var debounceCh <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case reloaded := <-reloadCh:
+			debounceCh = nil
+			reload()
+			close(reloaded)
+
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if w.isWatched(ev.Name) {
+				debounceCh = time.After(w.debounce)
+			}
+
+		case err, ok := <-fsErrors:
+			if !ok {
+				fsErrors = nil
+				continue
+			}
+			w.logger.Warn("error watching config files", "error", err)
+
+		case <-pollCh:
+			if w.pollChanged() {
+				debounceCh = time.After(w.debounce)
+			}
+
+		case <-debounceCh:
+			debounceCh = nil
+			reload()
+		}
+	}
+}
+
+// reload re-parses the config and, if it is valid, makes it current and
+// updates the set of watched files. If a watcher is given, the directories of
+// newly referenced files are added to it; an error doing so is returned.
+func (w *ConfigWatcher) reload(fsw *fsnotify.Watcher) error {
+	conf, files, err := w.load()
+	if err != nil {
+		w.logger.Error("error reloading config, keeping previous config", "path", w.path, "error", err)
+		w.callback(nil, err)
+		return nil
+	}
+
+	w.l.Lock()
+	w.current = conf
+	w.files = files
+	w.pollState = statFiles(files)
+	w.l.Unlock()
+
+	var watchErr error
+	if fsw != nil {
+		watchErr = watchDirs(fsw, files)
+	}
+
+	w.logger.Info("config reloaded", "path", w.path)
+	w.callback(conf, nil)
+	return watchErr
+}
+
+// load parses and validates the config and returns it along with the files
+// that should be watched. The config file is read once, so that the files
+// found to watch are those of the config that was parsed.
+func (w *ConfigWatcher) load() (*SharedConfig, []string, error) {
+	raw, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := append(append([]Option(nil), w.parseOpts...), withSourceFile(w.path))
+	conf, err := ParseConfig(string(raw), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if w.validator != nil {
+		if err := w.validator(conf); err != nil {
+			return nil, nil, fmt.Errorf("error validating config: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	add(w.path)
+	for _, path := range w.extraFiles {
+		add(path)
+	}
+	for _, match := range fileRefRegex.FindAllStringSubmatch(string(raw), -1) {
+		add(match[1])
+	}
+	sort.Strings(files)
+
+	return conf, files, nil
+}
+
+// isWatched returns whether the path is one of the watched files
+func (w *ConfigWatcher) isWatched(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	w.l.RLock()
+	defer w.l.RUnlock()
+	for _, f := range w.files {
+		if f == path {
+			return true
+		}
+	}
+	return false
+}
+
+// pollChanged stats the watched files and returns whether any have changed
+// since the last poll
+func (w *ConfigWatcher) pollChanged() bool {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	state := statFiles(w.files)
+	var changed bool
+	for path, s := range state {
+		if w.pollState[path] != s {
+			changed = true
+			break
+		}
+	}
+	w.pollState = state
+	return changed
+}
+
+// statFiles returns the current state of each file
+func statFiles(files []string) map[string]fileState {
+	ret := make(map[string]fileState, len(files))
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			ret[path] = fileState{}
+			continue
+		}
+		ret[path] = fileState{
+			exists:  true,
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+	}
+	return ret
+}
+
+// watchDirs adds the parent directory of each file to the watcher. Directories
+// rather than files are watched so that files replaced via rename, as many
+// editors and config management tools do, continue to be watched.
+func watchDirs(fsw *fsnotify.Watcher, files []string) error {
+	for _, path := range files {
+		if err := fsw.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("error watching directory of %q: %w", path, err)
+		}
+	}
+	return nil
+}
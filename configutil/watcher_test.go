@@ -0,0 +1,266 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package configutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadRecorder collects the results passed to a ConfigReloadFunc
+type reloadRecorder struct {
+	l       sync.Mutex
+	configs []*SharedConfig
+	errs    []error
+}
+
+func (r *reloadRecorder) callback(conf *SharedConfig, err error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.configs = append(r.configs, conf)
+	r.errs = append(r.errs, err)
+}
+
+func (r *reloadRecorder) count() int {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return len(r.configs)
+}
+
+func (r *reloadRecorder) last() (*SharedConfig, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if len(r.configs) == 0 {
+		return nil, nil
+	}
+	return r.configs[len(r.configs)-1], r.errs[len(r.errs)-1]
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+}
+
+func TestNewConfigWatcher(t *testing.T) {
+	dir := t.TempDir()
+	nameFile := filepath.Join(dir, "name")
+	writeFile(t, nameFile, "from-file")
+	certFile := filepath.Join(dir, "cert.pem")
+	configFile := filepath.Join(dir, "config.hcl")
+	writeFile(t, configFile, fmt.Sprintf(`cluster_name = "file://%s"`, nameFile))
+
+	t.Run("errors", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		rec := new(reloadRecorder)
+
+		_, err := NewConfigWatcher("", rec.callback)
+		require.Error(err)
+		assert.Contains(err.Error(), "config path is empty")
+
+		_, err = NewConfigWatcher(configFile, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "nil reload callback")
+
+		_, err = NewConfigWatcher(filepath.Join(dir, "missing.hcl"), rec.callback)
+		require.Error(err)
+		assert.ErrorIs(err, os.ErrNotExist)
+
+		_, err = NewConfigWatcher(configFile, rec.callback, WithConfigValidator(func(*SharedConfig) error {
+			return errors.New("invalid")
+		}))
+		require.Error(err)
+		assert.Contains(err.Error(), "error validating config")
+	})
+
+	t.Run("initial-load", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		rec := new(reloadRecorder)
+		w, err := NewConfigWatcher(configFile, rec.callback, WithWatchFiles(certFile))
+		require.NoError(err)
+		assert.Equal("from-file", w.Config().ClusterName)
+		assert.Equal([]string{certFile, configFile, nameFile}, w.WatchedFiles())
+		assert.Zero(rec.count())
+	})
+}
+
+func TestConfigWatcher(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		t.Run(fmt.Sprintf("polling-%t", polling), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			dir := t.TempDir()
+			nameFile := filepath.Join(dir, "name")
+			writeFile(t, nameFile, "first")
+			configFile := filepath.Join(dir, "config.hcl")
+			writeFile(t, configFile, fmt.Sprintf(`cluster_name = "file://%s"`, nameFile))
+
+			invalid := new(atomic.Bool)
+			rec := new(reloadRecorder)
+			w, err := NewConfigWatcher(configFile, rec.callback,
+				WithWatchPolling(polling),
+				WithWatchPollInterval(10*time.Millisecond),
+				WithWatchDebounce(50*time.Millisecond),
+				WithConfigValidator(func(*SharedConfig) error {
+					if invalid.Load() {
+						return errors.New("invalid")
+					}
+					return nil
+				}),
+			)
+			require.NoError(err)
+			require.NoError(w.Start(context.Background()))
+			t.Cleanup(w.Stop)
+			require.Error(w.Start(context.Background()))
+
+			// A change to a referenced file is picked up
+			writeFile(t, nameFile, "second")
+			require.Eventually(func() bool { return rec.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+			conf, err := rec.last()
+			require.NoError(err)
+			assert.Equal("second", conf.ClusterName)
+			assert.Equal("second", w.Config().ClusterName)
+
+			// A config that fails to parse is reported but not made current
+			writeFile(t, configFile, `cluster_name = "unterminated`)
+			require.Eventually(func() bool { return rec.count() == 2 }, 5*time.Second, 10*time.Millisecond)
+			conf, err = rec.last()
+			require.Error(err)
+			assert.Nil(conf)
+			assert.Equal("second", w.Config().ClusterName)
+
+			// As is one that fails validation
+			invalid.Store(true)
+			writeFile(t, configFile, `cluster_name = "invalid"`)
+			require.Eventually(func() bool { return rec.count() == 3 }, 5*time.Second, 10*time.Millisecond)
+			_, err = rec.last()
+			require.Error(err)
+			assert.Contains(err.Error(), "error validating config")
+			assert.Equal("second", w.Config().ClusterName)
+
+			// A valid config is made current and the watched files are updated
+			invalid.Store(false)
+			writeFile(t, configFile, `cluster_name = "third"`)
+			require.Eventually(func() bool { return rec.count() == 4 }, 5*time.Second, 10*time.Millisecond)
+			conf, err = rec.last()
+			require.NoError(err)
+			assert.Equal("third", conf.ClusterName)
+			assert.Equal([]string{configFile}, w.WatchedFiles())
+
+			w.Stop()
+			writeFile(t, configFile, `cluster_name = "fourth"`)
+			time.Sleep(200 * time.Millisecond)
+			assert.Equal(4, rec.count())
+			assert.Equal("third", w.Config().ClusterName)
+		})
+	}
+}
+
+func TestConfigWatcherDebounce(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	writeFile(t, configFile, `cluster_name = "0"`)
+
+	rec := new(reloadRecorder)
+	w, err := NewConfigWatcher(configFile, rec.callback, WithWatchDebounce(300*time.Millisecond))
+	require.NoError(err)
+	require.NoError(w.Start(context.Background()))
+	t.Cleanup(w.Stop)
+
+	// Rapid successive writes result in a single reload of the final contents
+	for i := 1; i <= 5; i++ {
+		writeFile(t, configFile, fmt.Sprintf(`cluster_name = "%d"`, i))
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.Eventually(func() bool { return rec.count() >= 1 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(1, rec.count())
+	assert.Equal("5", w.Config().ClusterName)
+}
+
+func TestConfigWatcherReload(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	writeFile(t, configFile, `cluster_name = "first"`)
+
+	rec := new(reloadRecorder)
+	w, err := NewConfigWatcher(configFile, rec.callback, WithWatchDebounce(50*time.Millisecond))
+	require.NoError(err)
+
+	// Reloading when not running is synchronous
+	w.Reload()
+	assert.Equal(1, rec.count())
+
+	// Reference a file in a directory that is not yet watched, without the
+	// running watcher seeing the change
+	subDir := filepath.Join(dir, "sub")
+	require.NoError(os.Mkdir(subDir, 0o700))
+	nameFile := filepath.Join(subDir, "name")
+	writeFile(t, nameFile, "second")
+	writeFile(t, configFile, fmt.Sprintf(`cluster_name = "file://%s"`, nameFile))
+
+	require.NoError(w.Start(context.Background()))
+	t.Cleanup(w.Stop)
+
+	// Concurrent manual reloads are serialized through the watcher
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Reload()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(6, rec.count())
+	assert.Equal("second", w.Config().ClusterName)
+	assert.Contains(w.WatchedFiles(), nameFile)
+
+	// The newly referenced file is watched by the running watcher
+	writeFile(t, nameFile, "third")
+	require.Eventually(func() bool { return w.Config().ClusterName == "third" }, 5*time.Second, 10*time.Millisecond)
+
+	// Once stopped, reloading is synchronous again
+	w.Stop()
+	writeFile(t, nameFile, "fourth")
+	w.Reload()
+	assert.Equal("fourth", w.Config().ClusterName)
+}
+
+func TestConfigWatcherMissingDirectory(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	writeFile(t, configFile, `cluster_name = "first"`)
+	missingDir := filepath.Join(dir, "missing")
+	extraFile := filepath.Join(missingDir, "extra")
+
+	// The directory of a watched file not existing yet falls back to polling
+	rec := new(reloadRecorder)
+	w, err := NewConfigWatcher(configFile, rec.callback,
+		WithWatchFiles(extraFile),
+		WithWatchPollInterval(10*time.Millisecond),
+		WithWatchDebounce(50*time.Millisecond),
+	)
+	require.NoError(err)
+	require.NoError(w.Start(context.Background()))
+	t.Cleanup(w.Stop)
+
+	require.NoError(os.Mkdir(missingDir, 0o700))
+	writeFile(t, extraFile, "created")
+	require.Eventually(func() bool { return rec.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	writeFile(t, configFile, `cluster_name = "second"`)
+	require.Eventually(func() bool { return w.Config().ClusterName == "second" }, 5*time.Second, 10*time.Millisecond)
+}
@@ -5,6 +5,7 @@ package nonceutil
 
 import (
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -249,3 +250,44 @@ func benchParallelTidy(b *testing.B, s NonceService) {
 	b.StartTimer()
 	s.Tidy()
 }
+
+func BenchmarkEncryptedNonceServiceParallelRedeem(b *testing.B) {
+	s := newEncryptedNonceService(benchValidity)
+	benchWrapper(benchParallelRedeem, b, s)
+}
+
+func BenchmarkSyncMapNonceServiceParallelRedeem(b *testing.B) {
+	s := newSyncMapNonceService(benchValidity)
+	benchWrapper(benchParallelRedeem, b, s)
+}
+
+func BenchmarkCrossNodeNonceServiceParallelRedeem(b *testing.B) {
+	s := NewCrossNodeNonceService(benchValidity, NewInMemoryNonceStore())
+	benchWrapper(benchParallelRedeem, b, s)
+}
+
+func BenchmarkTemporalNonceServiceParallelRedeem(b *testing.B) {
+	s := NewTemporalNonceService(benchValidity, &TemporalNonceConfig{ReplayFilter: true, ExpectedRedemptions: 10_000_000})
+	benchWrapper(benchParallelRedeem, b, s)
+}
+
+// benchParallelRedeem issues nonces up front and then redeems them from
+// many goroutines at once, and so largely out of order.
+func benchParallelRedeem(b *testing.B, s NonceService) {
+	tokens := make([]string, b.N)
+	for i := range tokens {
+		token, _, err := s.Get()
+		require.NoError(b, err)
+		tokens[i] = token
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ok := s.Redeem(tokens[next.Add(1)-1])
+			require.True(b, ok)
+		}
+	})
+}
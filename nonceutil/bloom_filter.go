@@ -0,0 +1,147 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// A rotating Bloom filter remembers the nonces redeemed over the last one
+// to two validity periods in fixed memory. Entries are added to the current
+// generation and looked up in both; once the current generation is one
+// validity period old, the previous generation is dropped and the current
+// one takes its place. Any nonce redeemed in the previous generation has
+// expired by the time it is dropped, so no replay within the validity
+// period is missed.
+
+package nonceutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReplayFilterFalsePositiveRate is the default rate at which a
+	// temporal nonce service's replay filter rejects fresh nonces.
+	DefaultReplayFilterFalsePositiveRate = 0.001
+
+	// DefaultReplayFilterRedemptions is the default number of redemptions
+	// per validity period a replay filter is sized for.
+	DefaultReplayFilterRedemptions = 100_000
+)
+
+type rotatingBloomFilter struct {
+	validity time.Duration
+
+	// Number of bits per generation and number of bits set per entry.
+	bits   uint64
+	hashes uint64
+
+	l        sync.Mutex
+	current  []uint64
+	previous []uint64
+	rotated  time.Time
+	added    uint64
+}
+
+func newRotatingBloomFilter(validity time.Duration, expected uint64, rate float64) *rotatingBloomFilter {
+	if expected == 0 {
+		expected = DefaultReplayFilterRedemptions
+	}
+	if rate <= 0 || rate >= 1 {
+		rate = DefaultReplayFilterFalsePositiveRate
+	}
+
+	// The optimal number of bits is -n*ln(p)/ln(2)^2 and the optimal number
+	// of hashes is (bits/n)*ln(2). Since lookups consult both generations,
+	// halve the rate of each.
+	bits := uint64(math.Ceil(-float64(expected) * math.Log(rate/2) / (math.Ln2 * math.Ln2)))
+	bits = (bits + 63) / 64 * 64
+	hashes := uint64(math.Round(float64(bits) / float64(expected) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	return &rotatingBloomFilter{
+		validity: validity,
+		bits:     bits,
+		hashes:   hashes,
+		current:  make([]uint64, bits/64),
+		previous: make([]uint64, bits/64),
+		rotated:  time.Now(),
+	}
+}
+
+// rotateHoldingLock starts a new generation if the current one is due.
+func (f *rotatingBloomFilter) rotateHoldingLock(now time.Time) {
+	if now.Sub(f.rotated) < f.validity {
+		return
+	}
+
+	// If more than one validity period passed, both generations are stale.
+	previous := f.current
+	if now.Sub(f.rotated) >= 2*f.validity {
+		for i := range previous {
+			previous[i] = 0
+		}
+	}
+
+	current := f.previous
+	for i := range current {
+		current[i] = 0
+	}
+
+	f.current, f.previous = current, previous
+	f.rotated = now
+	f.added = 0
+}
+
+func (f *rotatingBloomFilter) rotate(now time.Time) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.rotateHoldingLock(now)
+}
+
+// testAndAdd adds the entry with the given (uniformly distributed, at least
+// 16 byte) hash to the filter, returning false if it was already present.
+func (f *rotatingBloomFilter) testAndAdd(now time.Time, hash []byte) bool {
+	// Double hashing: the i'th bit is h1 + i*h2, with h2 odd.
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.rotateHoldingLock(now)
+
+	inCurrent, inPrevious := true, true
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.bits
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.current[word]&mask == 0 {
+			inCurrent = false
+			f.current[word] |= mask
+		}
+		if f.previous[word]&mask == 0 {
+			inPrevious = false
+		}
+	}
+	if inCurrent || inPrevious {
+		return false
+	}
+
+	f.added += 1
+	return true
+}
+
+func (f *rotatingBloomFilter) String() string {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	var message string
+	message += fmt.Sprintf("replay filter bits per generation: %v\n", f.bits)
+	message += fmt.Sprintf("replay filter hashes: %v\n", f.hashes)
+	message += fmt.Sprintf("replay filter entries in current generation: %v\n", f.added)
+	message += fmt.Sprintf("replay filter generation started: %v\n", f.rotated.Format(time.RFC3339))
+	return message
+}
@@ -0,0 +1,48 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextBoundNonces(t *testing.T) {
+	t.Parallel()
+
+	services := map[string]ContextBoundNonceService{
+		"encrypted":  newEncryptedNonceService(time.Minute),
+		"cross-node": NewCrossNodeNonceService(time.Minute, NewInMemoryNonceStore()).(ContextBoundNonceService),
+	}
+	for name, s := range services {
+		name, s := name, s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, s.Initialize())
+
+			alice, bob := []byte("account/alice"), []byte("account/bob")
+
+			// A bound nonce is rejected with any other binding, including
+			// none, without being consumed.
+			nonce, _, err := s.GetBound(alice)
+			require.NoError(t, err)
+			require.False(t, s.RedeemBound(nonce, bob))
+			require.False(t, s.Redeem(nonce))
+			require.True(t, s.RedeemBound(nonce, alice))
+			require.False(t, s.RedeemBound(nonce, alice))
+
+			// Unbound nonces are bound to empty context.
+			nonce, _, err = s.Get()
+			require.NoError(t, err)
+			require.False(t, s.RedeemBound(nonce, alice))
+			require.True(t, s.RedeemBound(nonce, nil))
+
+			nonce, _, err = s.GetBound(nil)
+			require.NoError(t, err)
+			require.True(t, s.Redeem(nonce))
+		})
+	}
+}
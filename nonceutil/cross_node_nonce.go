@@ -0,0 +1,240 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// The cross-node nonce service mints the same encrypted (counter, expiry)
+// tokens as encryptedNonceService, but shares its key, counter and
+// redemption state between nodes through a NonceStore, so that a nonce
+// issued by one node can be redeemed exactly once on any node.
+//
+// To keep storage traffic bounded, each node reserves a window of counter
+// values from the store at a time and issues nonces from it locally; only
+// redemptions and exhausting a window touch the store. A window is only
+// issued from for one validity period, which bounds the expiry of its
+// nonces and lets the store's low-water mark advance past it once that
+// passes. As with the encrypted nonce service, counters redeemed in
+// sequence only move the low-water mark, and the remaining redemption
+// records are grouped by expiry timestamp and dropped wholesale once it
+// passes. Every redemption is still a write to the store.
+
+package nonceutil
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCounterWindow is the number of counter values a cross-node nonce
+// service reserves from its store at a time.
+const DefaultCounterWindow = 1024
+
+// The identifier of the key shared by all nodes in their nonces.
+const crossNodeKeyID = 0
+
+type crossNodeNonceService struct {
+	validity time.Duration
+	window   uint64
+	store    NonceStore
+
+	crypt cipher.AEAD
+
+	// The current window of reserved counter values: nextCounter is the
+	// next value to issue, windowEnd is one past the last and
+	// windowDeadline is when the window may no longer be issued from.
+	windowLock     sync.Mutex
+	nextCounter    uint64
+	windowEnd      uint64
+	windowDeadline time.Time
+
+	issued    *atomic.Uint64
+	redeemed  *atomic.Uint64
+	remaining *atomic.Uint64
+
+	metrics NonceMetrics
+}
+
+var (
+	_ ContextBoundNonceService = &crossNodeNonceService{}
+	_ InstrumentedNonceService = &crossNodeNonceService{}
+)
+
+// NewCrossNodeNonceService creates a strict nonce service whose key and
+// redemption state are shared with every other service using the same
+// store, using the DefaultCounterWindow.
+func NewCrossNodeNonceService(validity time.Duration, store NonceStore) NonceService {
+	return NewCrossNodeNonceServiceWithWindow(validity, store, DefaultCounterWindow)
+}
+
+// NewCrossNodeNonceServiceWithWindow is like NewCrossNodeNonceService, but
+// reserves window counter values from the store at a time. Larger windows
+// mean less storage traffic but more counter values lost when a node
+// restarts.
+func NewCrossNodeNonceServiceWithWindow(validity time.Duration, store NonceStore, window uint64) NonceService {
+	if window == 0 {
+		window = DefaultCounterWindow
+	}
+	return &crossNodeNonceService{
+		validity:  validity,
+		window:    window,
+		store:     store,
+		issued:    new(atomic.Uint64),
+		redeemed:  new(atomic.Uint64),
+		remaining: new(atomic.Uint64),
+		metrics:   noopNonceMetrics{},
+	}
+}
+
+func (cns *crossNodeNonceService) Initialize() error {
+	if cns.store == nil {
+		return fmt.Errorf("no nonce store provided")
+	}
+
+	// Offer a fresh key; if another node got there first, we use its key
+	// instead so that its nonces validate here and vice versa.
+	candidate, err := generateNonceKey()
+	if err != nil {
+		return err
+	}
+
+	key, err := cns.store.LoadOrStoreKey(candidate)
+	if err != nil {
+		return fmt.Errorf("failed to load shared nonce key: %w", err)
+	}
+
+	aead, err := newNonceAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	cns.crypt = aead
+	return nil
+}
+
+// lookupKey returns the cipher for the given key identifier. Every node
+// shares a single key, which is not rotated.
+func (cns *crossNodeNonceService) lookupKey(id uint32) cipher.AEAD {
+	if id != crossNodeKeyID {
+		return nil
+	}
+	return cns.crypt
+}
+
+func (cns *crossNodeNonceService) IsStrict() bool    { return true }
+func (cns *crossNodeNonceService) IsCrossNode() bool { return true }
+
+func (cns *crossNodeNonceService) SetMetrics(metrics NonceMetrics) {
+	cns.metrics = metricsOrNoop(metrics)
+}
+
+// reserveCounter returns the next counter value from this node's window,
+// reserving a new window from the store if the current one is exhausted or
+// past its deadline. Nonces issued from a window therefore expire no later
+// than two validity periods after it was reserved, which is the expiry the
+// store is told about.
+func (cns *crossNodeNonceService) reserveCounter(now time.Time) (uint64, error) {
+	cns.windowLock.Lock()
+	defer cns.windowLock.Unlock()
+
+	if cns.nextCounter == cns.windowEnd || !now.Before(cns.windowDeadline) {
+		first, err := cns.store.ReserveCounters(cns.window, now.Add(2*cns.validity).Unix())
+		if err != nil {
+			return 0, fmt.Errorf("failed to reserve nonce counters: %w", err)
+		}
+		cns.nextCounter = first
+		cns.windowEnd = first + cns.window
+		cns.windowDeadline = now.Add(cns.validity)
+	}
+
+	counter := cns.nextCounter
+	cns.nextCounter += 1
+	return counter, nil
+}
+
+func (cns *crossNodeNonceService) Get() (string, time.Time, error) {
+	return cns.GetBound(nil)
+}
+
+func (cns *crossNodeNonceService) GetBound(binding []byte) (string, time.Time, error) {
+	now := time.Now()
+	counter, err := cns.reserveCounter(now)
+	if err != nil {
+		return "", now, err
+	}
+
+	then := now.Add(cns.validity)
+	token, err := encryptNonce(cns.crypt, crossNodeKeyID, counter, then, binding)
+	if err != nil {
+		return "", now, err
+	}
+
+	cns.issued.Add(1)
+	cns.metrics.NonceIssued()
+	return token, then, nil
+}
+
+func (cns *crossNodeNonceService) Redeem(token string) bool {
+	return cns.RedeemBound(token, nil)
+}
+
+func (cns *crossNodeNonceService) RedeemBound(token string, binding []byte) bool {
+	counter, expiry, ok := decryptNonce(cns.lookupKey, token, binding)
+	if !ok {
+		cns.metrics.NonceRejected(NonceRejectedMalformed)
+		return false
+	}
+
+	if expiry.Before(time.Now()) {
+		cns.metrics.NonceRejected(NonceRejectedExpired)
+		return false
+	}
+
+	// Fail closed: if the store cannot be reached, we cannot tell whether
+	// another node already accepted this nonce.
+	marked, err := cns.store.MarkRedeemed(expiry.Unix(), counter)
+	if err != nil {
+		cns.metrics.NonceRejected(NonceRejectedUnavailable)
+		return false
+	}
+	if !marked {
+		cns.metrics.NonceRejected(NonceRejectedReplayed)
+		return false
+	}
+
+	cns.redeemed.Add(1)
+	cns.metrics.NonceRedeemed()
+	return true
+}
+
+func (cns *crossNodeNonceService) Tidy() *NonceStatus {
+	start := time.Now()
+	defer func() { cns.metrics.NonceTidied(time.Since(start)) }()
+
+	status := &NonceStatus{
+		Issued: cns.issued.Load(),
+	}
+
+	remaining, err := cns.store.DeleteExpired(time.Now().Unix())
+	if err != nil {
+		remaining = cns.remaining.Load()
+		status.Message = fmt.Sprintf("failed to tidy nonce store: %v\n", err)
+	} else {
+		cns.remaining.Store(remaining)
+	}
+
+	cns.windowLock.Lock()
+	unused := cns.windowEnd - cns.nextCounter
+	cns.windowLock.Unlock()
+
+	status.Message += fmt.Sprintf("redeemed on this node: %v\n", cns.redeemed.Load())
+	status.Message += fmt.Sprintf("unexpired redemption records in store: %v\n", remaining)
+	status.Message += fmt.Sprintf("unused counters in window: %v\n", unused)
+
+	// Outstanding is local to this node: nonces issued here that have not
+	// been redeemed here. Nonces may be redeemed on other nodes instead.
+	if redeemed := cns.redeemed.Load(); redeemed < status.Issued {
+		status.Outstanding = status.Issued - redeemed
+	}
+	return status
+}
@@ -0,0 +1,276 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testNonceStores(t *testing.T) map[string]func() NonceStore {
+	path := filepath.Join(t.TempDir(), "nonces.json")
+	return map[string]func() NonceStore{
+		"memory": NewInMemoryNonceStore,
+		"file":   func() NonceStore { return NewFileNonceStore(path) },
+	}
+}
+
+func TestCrossNodeNonceService(t *testing.T) {
+	t.Parallel()
+
+	for name, newStore := range testNonceStores(t) {
+		name, newStore := name, newStore
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Both nodes share the storage of a single store for the
+			// in-memory case; for the file case each node has its own
+			// store of the same file.
+			storeA := newStore()
+			storeB := storeA
+			if name == "file" {
+				storeB = newStore()
+			}
+
+			a := NewCrossNodeNonceServiceWithWindow(time.Minute, storeA, 4)
+			b := NewCrossNodeNonceServiceWithWindow(time.Minute, storeB, 4)
+			require.NoError(t, a.Initialize())
+			require.NoError(t, b.Initialize())
+			require.True(t, a.IsStrict())
+			require.True(t, a.IsCrossNode())
+
+			// Nonces issued by one node are redeemable exactly once on
+			// any node.
+			nonce, _, err := a.Get()
+			require.NoError(t, err)
+			require.True(t, b.Redeem(nonce))
+			require.False(t, a.Redeem(nonce))
+			require.False(t, b.Redeem(nonce))
+
+			// Nodes never issue the same counter value, across several
+			// windows.
+			var nonces []string
+			for i := 0; i < 10; i++ {
+				for _, s := range []NonceService{a, b} {
+					nonce, _, err := s.Get()
+					require.NoError(t, err)
+					nonces = append(nonces, nonce)
+				}
+			}
+			for i := len(nonces) - 1; i >= 0; i-- {
+				node := a
+				if i%3 == 0 {
+					node = b
+				}
+				require.True(t, node.Redeem(nonces[i]))
+			}
+			for _, nonce := range nonces {
+				require.False(t, a.Redeem(nonce))
+				require.False(t, b.Redeem(nonce))
+			}
+
+			require.False(t, a.Redeem("not a nonce"))
+
+			// Only the counters above a's unused one need records; the
+			// rest are covered by the low-water mark.
+			status := a.Tidy()
+			require.NotNil(t, status)
+			require.Equal(t, uint64(11), status.Issued)
+			require.Contains(t, status.Message, "unused counters in window: 1")
+			require.Contains(t, status.Message, "unexpired redemption records in store: 2")
+		})
+	}
+}
+
+func TestCrossNodeNonceServiceRestart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nonces.json")
+	s := NewCrossNodeNonceService(time.Minute, NewFileNonceStore(path))
+	require.NoError(t, s.Initialize())
+
+	redeemed, _, err := s.Get()
+	require.NoError(t, err)
+	require.True(t, s.Redeem(redeemed))
+	outstanding, _, err := s.Get()
+	require.NoError(t, err)
+
+	// A restarted node shares the stored key and redemption state.
+	s = NewCrossNodeNonceService(time.Minute, NewFileNonceStore(path))
+	require.NoError(t, s.Initialize())
+	require.False(t, s.Redeem(redeemed))
+	require.True(t, s.Redeem(outstanding))
+
+	// It does not reuse counter values from the previous window.
+	nonce, _, err := s.Get()
+	require.NoError(t, err)
+	require.True(t, s.Redeem(nonce))
+}
+
+func TestCrossNodeNonceServiceExpiry(t *testing.T) {
+	t.Parallel()
+
+	store := NewInMemoryNonceStore()
+	s := NewCrossNodeNonceService(time.Second, store)
+	require.NoError(t, s.Initialize())
+
+	expired, _, err := s.Get()
+	require.NoError(t, err)
+	redeemed, _, err := s.Get()
+	require.NoError(t, err)
+	require.True(t, s.Redeem(redeemed))
+
+	remaining, err := store.DeleteExpired(time.Now().Unix())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), remaining)
+
+	time.Sleep(2 * time.Second)
+	require.False(t, s.Redeem(expired))
+
+	status := s.Tidy()
+	require.Contains(t, status.Message, "unexpired redemption records in store: 0")
+	require.False(t, s.Redeem(redeemed))
+}
+
+func TestNonceStoreLowWaterMark(t *testing.T) {
+	t.Parallel()
+
+	for name, newStore := range testNonceStores(t) {
+		name, newStore := name, newStore
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := newStore()
+			now := time.Now().Unix()
+			expiry := now + 60
+
+			first, err := store.ReserveCounters(8, expiry+60)
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), first)
+
+			// Sequential redemptions only move the low-water mark.
+			for counter := uint64(1); counter <= 3; counter++ {
+				marked, err := store.MarkRedeemed(expiry, counter)
+				require.NoError(t, err)
+				require.True(t, marked)
+			}
+			remaining, err := store.DeleteExpired(now)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), remaining)
+
+			// Counters at or below it are replays.
+			marked, err := store.MarkRedeemed(expiry, 2)
+			require.NoError(t, err)
+			require.False(t, marked)
+
+			// Out-of-order redemptions are recorded until the gap fills.
+			for _, counter := range []uint64{6, 5} {
+				marked, err := store.MarkRedeemed(expiry, counter)
+				require.NoError(t, err)
+				require.True(t, marked)
+			}
+			marked, err = store.MarkRedeemed(expiry, 6)
+			require.NoError(t, err)
+			require.False(t, marked)
+			remaining, err = store.DeleteExpired(now)
+			require.NoError(t, err)
+			require.Equal(t, uint64(2), remaining)
+
+			marked, err = store.MarkRedeemed(expiry, 4)
+			require.NoError(t, err)
+			require.True(t, marked)
+			remaining, err = store.DeleteExpired(now)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), remaining)
+			marked, err = store.MarkRedeemed(expiry, 5)
+			require.NoError(t, err)
+			require.False(t, marked)
+
+			// Once the window expires, the mark moves past its unredeemed
+			// counters.
+			marked, err = store.MarkRedeemed(expiry, 8)
+			require.NoError(t, err)
+			require.True(t, marked)
+			remaining, err = store.DeleteExpired(expiry + 61)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), remaining)
+			marked, err = store.MarkRedeemed(expiry+120, 7)
+			require.NoError(t, err)
+			require.False(t, marked)
+
+			first, err = store.ReserveCounters(8, expiry+120)
+			require.NoError(t, err)
+			require.Equal(t, uint64(9), first)
+			marked, err = store.MarkRedeemed(expiry+120, 9)
+			require.NoError(t, err)
+			require.True(t, marked)
+		})
+	}
+}
+
+// failingNonceStore is a NonceStore whose operations fail once broken.
+type failingNonceStore struct {
+	NonceStore
+
+	l      sync.Mutex
+	broken bool
+}
+
+var errBrokenStore = errors.New("store unavailable")
+
+func (s *failingNonceStore) err() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.broken {
+		return errBrokenStore
+	}
+	return nil
+}
+
+func (s *failingNonceStore) ReserveCounters(count uint64, expiry int64) (uint64, error) {
+	if err := s.err(); err != nil {
+		return 0, err
+	}
+	return s.NonceStore.ReserveCounters(count, expiry)
+}
+
+func (s *failingNonceStore) MarkRedeemed(expiry int64, counter uint64) (bool, error) {
+	if err := s.err(); err != nil {
+		return false, err
+	}
+	return s.NonceStore.MarkRedeemed(expiry, counter)
+}
+
+func TestCrossNodeNonceServiceStoreErrors(t *testing.T) {
+	t.Parallel()
+
+	require.Error(t, NewCrossNodeNonceService(time.Minute, nil).Initialize())
+
+	store := &failingNonceStore{NonceStore: NewInMemoryNonceStore()}
+	s := NewCrossNodeNonceServiceWithWindow(time.Minute, store, 1)
+	require.NoError(t, s.Initialize())
+
+	nonce, _, err := s.Get()
+	require.NoError(t, err)
+
+	store.l.Lock()
+	store.broken = true
+	store.l.Unlock()
+
+	// Redemption fails closed and issuing fails once the window is
+	// exhausted.
+	require.False(t, s.Redeem(nonce))
+	_, _, err = s.Get()
+	require.ErrorIs(t, err, errBrokenStore)
+
+	store.l.Lock()
+	store.broken = false
+	store.l.Unlock()
+	require.True(t, s.Redeem(nonce))
+}
@@ -17,6 +17,10 @@
 // Redeeming a nonce thus only stores the used counter value (8 bytes)
 // and other checks for delayed or reused nonces remain as fast as parsing
 // and decrypting the token value.
+//
+// Each token names the key it was minted under, so that the key can be
+// rotated: retired keys are kept only until the last of their tokens
+// expires, at most one validity period after rotation.
 
 package nonceutil
 
@@ -29,7 +33,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -37,15 +40,20 @@ import (
 
 const (
 	// Internal, versioned sentinel to make sure our base64 data is truly
-	// a nonce-like value.
-	nonceSentinel = "vault0"
+	// a nonce-like value. Version 1 added the key identifier.
+	nonceSentinel = "vault1"
 
-	// Wire length of the nonce, excluding raw url base64 encoding:
+	// Length of the unencrypted (but authenticated) header of the nonce:
 	//  - 6 byte sentinel (above),
+	//  - 4 byte identifier of the key the nonce was minted under.
+	nonceHeaderLength = len(nonceSentinel) + 4
+
+	// Wire length of the nonce, excluding raw url base64 encoding:
+	//  - 10 byte header (above),
 	//  - 8 byte AES-GCM IV
 	//  - 16 byte encrypted (timestamp, counter) tuple (1 AES block)
 	//  - 16 byte AES-GCM tag.
-	nonceLength = len(nonceSentinel) + 8 + 16 + 16
+	nonceLength = nonceHeaderLength + 8 + 16 + 16
 
 	// Length of the decrypted plaintext underlying the nonce:
 	// - 8 byte expiry timestamp, unix seconds
@@ -63,36 +71,71 @@ type encryptedNonceService struct {
 	// usage (retention of redeemed nonces).
 	validity time.Duration
 
-	// Underlying cipher for minting tokens.
-	crypt cipher.AEAD
+	// The key currently used for minting tokens, and the keys it replaced
+	// that may still have unexpired tokens outstanding, locked by keyLock.
+	// When rotationInterval is non-zero, Get rotates the key once it is
+	// that old.
+	keyLock          *sync.RWMutex
+	key              *nonceKey
+	retiredKeys      []*nonceKey
+	rotationInterval time.Duration
+	rotations        *atomic.Uint64
 
 	// The next counter value to use for issuing, _after_ calling Add(1)
 	// on it.
 	nextCounter *atomic.Uint64
 
-	// The remaining fields are locked by this read-only mutex. During
-	// issuing a nonce, we update maxIssued; during redeeming we update
-	// minCounter (an atomic) and redeemedTokens, and during tidy, we
-	// potentially update update all fields.
+	// During issuing a nonce, we update maxIssued under issueLock; during
+	// redeeming we update minCounter (an atomic) and redeemedTokens under
+	// the lock of the counter's shard, and during tidy, we potentially
+	// update all fields, holding issueLock and then every shard's lock.
 	//
 	// By storing maxIssued, we can (from our tidy run) update the
 	// minCounter value when nonces were not redeemed recently, to make
 	// any later redemptions fast (within a time period).
 	//
-	// The outer map in redeemedTokens and maxIssued map are of fixed size,
+	// The outer maps in redeemedTokens and maxIssued map are of fixed size,
 	// around the size of validity (in seconds). However, the internal
-	// redeemedTokens[timestamp] maps may grow unbounded (assuming a
-	// sufficiently fast system that can mint tokens infinitely fast).
-	// However, once this timestamp expires, we can fully delete all
-	// references to that map, and thus free up a potentially significant
-	// chunk of memory.
+	// per-timestamp maps may grow unbounded (assuming a sufficiently fast
+	// system that can mint tokens infinitely fast). However, once this
+	// timestamp expires, we can fully delete all references to that map,
+	// and thus free up a potentially significant chunk of memory.
+	//
+	// minCounter is only ever raised, either by compare-and-swap when
+	// redeeming the next nonce in sequence (holding that nonce's shard
+	// lock) or by storing while holding every shard's lock.
+	//
+	// oldestIssued is the earliest timestamp in maxIssued (zero if empty),
+	// updated under issueLock; redemption reads it to tidy once it has
+	// passed, so that minCounter moves past expired nonces without waiting
+	// for Tidy.
 	issueLock      *sync.Mutex
 	maxIssued      map[ensTimestamp]ensCounter
+	oldestIssued   *atomic.Uint64
 	minCounter     *atomic.Uint64
-	redeemedTokens map[ensTimestamp]map[ensCounter]struct{}
+	redeemedTokens *redeemedShards
+
+	// Optional caps on the state above; when set, issuing takes issueLock
+	// so that the caps are checked and the counter is incremented
+	// atomically.
+	limits  NonceLimits
+	limited *atomic.Uint64
+	evicted *atomic.Uint64
+
+	metrics NonceMetrics
 }
 
+var (
+	_ KeyRotatingNonceService  = &encryptedNonceService{}
+	_ ContextBoundNonceService = &encryptedNonceService{}
+	_ InstrumentedNonceService = &encryptedNonceService{}
+)
+
 func newEncryptedNonceService(validity time.Duration) *encryptedNonceService {
+	return newEncryptedNonceServiceWithLimits(validity, NonceLimits{})
+}
+
+func newEncryptedNonceServiceWithLimits(validity time.Duration, limits NonceLimits) *encryptedNonceService {
 	return &encryptedNonceService{
 		validity: validity,
 
@@ -103,9 +146,50 @@ func newEncryptedNonceService(validity time.Duration) *encryptedNonceService {
 
 		issueLock:      new(sync.Mutex),
 		maxIssued:      make(map[ensTimestamp]ensCounter, validity/time.Second),
+		oldestIssued:   new(atomic.Uint64),
 		minCounter:     new(atomic.Uint64),
-		redeemedTokens: make(map[ensTimestamp]map[ensCounter]struct{}, validity/time.Second),
+		redeemedTokens: newRedeemedShards(),
+
+		keyLock:   new(sync.RWMutex),
+		rotations: new(atomic.Uint64),
+
+		limits:  limits,
+		limited: new(atomic.Uint64),
+		evicted: new(atomic.Uint64),
+
+		metrics: noopNonceMetrics{},
+	}
+}
+
+func newEncryptedNonceServiceWithKeyRotation(validity time.Duration, interval time.Duration) *encryptedNonceService {
+	ens := newEncryptedNonceService(validity)
+	ens.rotationInterval = interval
+	return ens
+}
+
+// nonceKey is a key that nonces are minted under.
+type nonceKey struct {
+	id      uint32
+	crypt   cipher.AEAD
+	created time.Time
+
+	// Once retired, the time at which the last nonce minted under this key
+	// expires.
+	retiredUntil time.Time
+}
+
+func newNonceKey(id uint32, now time.Time) (*nonceKey, error) {
+	key, err := generateNonceKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newNonceAEAD(key)
+	if err != nil {
+		return nil, err
 	}
+
+	return &nonceKey{id: id, crypt: aead, created: now}, nil
 }
 
 func (ens *encryptedNonceService) Initialize() error {
@@ -113,23 +197,120 @@ func (ens *encryptedNonceService) Initialize() error {
 	// with the number of encryptions we can do under this service.
 	//
 	// Note that the nonce service will panic if this is not created.
+	key, err := newNonceKey(1, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ens.keyLock.Lock()
+	defer ens.keyLock.Unlock()
+
+	ens.key = key
+	ens.retiredKeys = nil
+	return nil
+}
+
+// RotateKey replaces the key used for minting nonces. The previous key is
+// retained until every nonce minted under it has expired, so outstanding
+// nonces remain redeemable.
+func (ens *encryptedNonceService) RotateKey() error {
+	ens.keyLock.Lock()
+	defer ens.keyLock.Unlock()
+
+	return ens.rotateKeyHoldingLock(time.Now())
+}
+
+func (ens *encryptedNonceService) rotateKeyHoldingLock(now time.Time) error {
+	key, err := newNonceKey(ens.key.id+1, now)
+	if err != nil {
+		return err
+	}
+
+	// Nonces are never issued with more than the configured validity, even
+	// under limits.
+	previous := ens.key
+	previous.retiredUntil = now.Add(ens.validity)
+
+	ens.retiredKeys = append(ens.pruneRetiredKeysHoldingLock(now), previous)
+	ens.key = key
+	ens.rotations.Add(1)
+	return nil
+}
+
+// pruneRetiredKeysHoldingLock returns the retired keys which may still have
+// unexpired nonces outstanding.
+func (ens *encryptedNonceService) pruneRetiredKeysHoldingLock(now time.Time) []*nonceKey {
+	var retained []*nonceKey
+	for _, key := range ens.retiredKeys {
+		if !key.retiredUntil.Before(now) {
+			retained = append(retained, key)
+		}
+	}
+	return retained
+}
+
+// currentKey returns the key to mint nonces under, rotating it first if it
+// is due.
+func (ens *encryptedNonceService) currentKey(now time.Time) (*nonceKey, error) {
+	ens.keyLock.RLock()
+	key := ens.key
+	ens.keyLock.RUnlock()
+
+	if ens.rotationInterval <= 0 || now.Sub(key.created) < ens.rotationInterval {
+		return key, nil
+	}
+
+	ens.keyLock.Lock()
+	defer ens.keyLock.Unlock()
+
+	// Someone else may have rotated the key while we waited for the lock.
+	if now.Sub(ens.key.created) >= ens.rotationInterval {
+		if err := ens.rotateKeyHoldingLock(now); err != nil {
+			return nil, err
+		}
+	}
+	return ens.key, nil
+}
+
+// lookupKey returns the cipher of the current or a retired key with the
+// given identifier, or nil if there is no such key.
+func (ens *encryptedNonceService) lookupKey(id uint32) cipher.AEAD {
+	ens.keyLock.RLock()
+	defer ens.keyLock.RUnlock()
+
+	if ens.key.id == id {
+		return ens.key.crypt
+	}
+	for _, key := range ens.retiredKeys {
+		if key.id == id {
+			return key.crypt
+		}
+	}
+	return nil
+}
+
+// generateNonceKey creates a new random AES-256 key for minting nonces.
+func generateNonceKey() ([]byte, error) {
 	key := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, key); err != nil {
-		return fmt.Errorf("failed to initialize AES key: %w", err)
+		return nil, fmt.Errorf("failed to initialize AES key: %w", err)
 	}
+	return key, nil
+}
 
+// newNonceAEAD creates the AES-GCM cipher used to mint nonces from the
+// given key.
+func newNonceAEAD(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return fmt.Errorf("failed to initialize AES cipher: %w", err)
+		return nil, fmt.Errorf("failed to initialize AES cipher: %w", err)
 	}
 
 	aead, err := cipher.NewGCM(block)
 	if err != nil {
-		return fmt.Errorf("failed to initialize AES-GCM: %w", err)
+		return nil, fmt.Errorf("failed to initialize AES-GCM: %w", err)
 	}
-
-	ens.crypt = aead
-	return nil
+	return aead, nil
 }
 
 // This nonce service is strict (prohibits reuse of nonces even within
@@ -142,7 +323,22 @@ func (ens *encryptedNonceService) Initialize() error {
 func (ens *encryptedNonceService) IsStrict() bool    { return true }
 func (ens *encryptedNonceService) IsCrossNode() bool { return false }
 
-func (ens *encryptedNonceService) encryptNonce(counter uint64, expiry time.Time) (token string, err error) {
+func (ens *encryptedNonceService) SetMetrics(metrics NonceMetrics) {
+	ens.metrics = metricsOrNoop(metrics)
+}
+
+func (ens *encryptedNonceService) encryptNonce(counter uint64, expiry time.Time, binding []byte) (token string, err error) {
+	key, err := ens.currentKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return encryptNonce(key.crypt, key.id, counter, expiry, binding)
+}
+
+// encryptNonce mints the wire format of a nonce for the (counter, expiry)
+// tuple under the given cipher, whose key has the given identifier. The
+// nonce only decrypts with the same binding (which may be empty).
+func encryptNonce(crypt cipher.AEAD, keyID uint32, counter uint64, expiry time.Time, binding []byte) (token string, err error) {
 	// counter is an 8-byte value and expiry (as a unix timestamp) is
 	// likewise, so we have exactly one block of data.
 	//
@@ -166,12 +362,18 @@ func (ens *encryptedNonceService) encryptNonce(counter uint64, expiry time.Time)
 	plaintext := make([]byte, noncePlaintextLength)
 	binary.BigEndian.PutUint64(plaintext[0:], counter)
 	binary.BigEndian.PutUint64(plaintext[8:], uint64(expiry.Unix()))
-	ciphertext := ens.crypt.Seal(nil, nonce, plaintext, nil)
 
-	// Now, generate the wire format of the nonce. Use a prefix, the nonce,
-	// and then the ciphertext.
+	// The header is authenticated as additional data, so that the key
+	// identifier cannot be altered.
+	header := make([]byte, 0, nonceHeaderLength)
+	header = append(header, []byte(nonceSentinel)...)
+	header = binary.BigEndian.AppendUint32(header, keyID)
+	ciphertext := crypt.Seal(nil, nonce, plaintext, nonceAdditionalData(header, binding))
+
+	// Now, generate the wire format of the nonce. Use the header, the
+	// nonce, and then the ciphertext.
 	var wire []byte
-	wire = append(wire, []byte(nonceSentinel)...)
+	wire = append(wire, header...)
 	wire = append(wire, nonce[4:]...)
 	wire = append(wire, ciphertext...)
 
@@ -198,23 +400,142 @@ func (ens *encryptedNonceService) recordCounterForTime(counter uint64, expiry ti
 	if !ok || lastValue < value {
 		ens.maxIssued[timestamp] = value
 	}
+	if oldest := ens.oldestIssued.Load(); oldest == 0 || uint64(timestamp) < oldest {
+		ens.oldestIssued.Store(uint64(timestamp))
+	}
+}
+
+// nonceAdditionalData returns the AEAD additional data of a nonce: its
+// header followed by the binding. As the header is of fixed length, this
+// is unambiguous.
+func nonceAdditionalData(header []byte, binding []byte) []byte {
+	if len(binding) == 0 {
+		return header
+	}
+	ad := make([]byte, 0, len(header)+len(binding))
+	ad = append(ad, header...)
+	return append(ad, binding...)
 }
 
 func (ens *encryptedNonceService) Get() (token string, expiry time.Time, err error) {
-	counter := ens.nextCounter.Add(1)
+	return ens.GetBound(nil)
+}
+
+// GetBound issues a nonce which only redeems via RedeemBound with the same
+// binding; the binding is authenticated as AEAD additional data but not
+// stored in the nonce.
+func (ens *encryptedNonceService) GetBound(binding []byte) (token string, expiry time.Time, err error) {
+	counter, validity, err := ens.nextCounterWithinLimits()
 	now := time.Now()
-	then := now.Add(ens.validity)
+	if err != nil {
+		return "", now, err
+	}
+	then := now.Add(validity)
 
-	token, err = ens.encryptNonce(counter, then)
+	token, err = ens.encryptNonce(counter, then, binding)
 	if err != nil {
 		return "", now, err
 	}
 
 	ens.recordCounterForTime(counter, then)
+	ens.metrics.NonceIssued()
 	return token, then, nil
 }
 
-func (ens *encryptedNonceService) decryptNonce(token string) (counter uint64, expiry time.Time, ok bool) {
+// nextCounterWithinLimits returns the counter value and validity of the next
+// nonce to issue, applying the policy of the service's limits if they have
+// been reached.
+func (ens *encryptedNonceService) nextCounterWithinLimits() (uint64, time.Duration, error) {
+	if !ens.limits.enabled() {
+		return ens.nextCounter.Add(1), ens.validity, nil
+	}
+
+	ens.issueLock.Lock()
+	defer ens.issueLock.Unlock()
+
+	validity := ens.validity
+	if !ens.atLimit() {
+		return ens.nextCounter.Add(1), validity, nil
+	}
+
+	ens.redeemedTokens.lockAll()
+	defer ens.redeemedTokens.unlockAll()
+
+	// Before applying the policy, see whether expired or sequentially
+	// redeemed nonces free up enough room.
+	now := time.Now()
+	minCounter := ens.minCounter.Load()
+	minCounter = ens.tidyMemoryHoldingLock(now, minCounter)
+	minCounter = ens.tidySequentialNonces(now, minCounter)
+	ens.minCounter.Store(minCounter)
+
+	if ens.atLimit() {
+		ens.limited.Add(1)
+		switch ens.limits.Policy {
+		case ShortenValidityOnLimit:
+			validity = ens.limits.shortenedValidity(ens.validity)
+		case EvictOldestOnLimit:
+			ens.evictHoldingLock(1)
+		default:
+			return 0, 0, ErrNonceLimitReached
+		}
+	}
+
+	return ens.nextCounter.Add(1), validity, nil
+}
+
+func (ens *encryptedNonceService) atLimit() bool {
+	outstanding := ens.nextCounter.Load() - ens.minCounter.Load()
+	return ens.limits.reached(outstanding, ens.redeemedTokens.count.Load())
+}
+
+// evictHoldingLock invalidates the oldest outstanding nonces until there is
+// room for the given number of additional nonces and redemption records. It
+// requires holding issueLock and every shard's lock.
+//
+// Eviction never forgets a redemption, which would allow a nonce to be
+// replayed; instead it raises minCounter, rejecting every nonce at or below
+// it, and then drops the redemption records it makes redundant.
+func (ens *encryptedNonceService) evictHoldingLock(room uint64) {
+	// Records at or below minCounter may linger after tidying; drop them
+	// first so that they are not counted below.
+	previous := ens.minCounter.Load()
+	minCounter := previous
+	ens.redeemedTokens.dropAtOrBelow(previous)
+
+	if max := ens.limits.MaxOutstanding; max > 0 {
+		next := ens.nextCounter.Load()
+		if next-minCounter+room > max {
+			minCounter = next + room - max
+		}
+	}
+	dropped := ens.redeemedTokens.dropAtOrBelow(minCounter)
+
+	if max := ens.limits.MaxRedeemed; max > 0 {
+		// Forgetting a record means rejecting every nonce at or below it,
+		// so forget the lowest first: it evicts the fewest (and oldest)
+		// outstanding nonces.
+		for count := ens.redeemedTokens.count.Load(); count > 0 && count+room > max; count = ens.redeemedTokens.count.Load() {
+			minCounter = uint64(ens.redeemedTokens.lowest())
+			dropped += ens.redeemedTokens.dropAtOrBelow(minCounter)
+		}
+	}
+
+	if minCounter > previous {
+		// Nonces that had already been redeemed are not counted as evicted.
+		ens.evicted.Add(minCounter - previous - dropped)
+		ens.minCounter.Store(minCounter)
+	}
+}
+
+func (ens *encryptedNonceService) decryptNonce(token string, binding []byte) (counter uint64, expiry time.Time, ok bool) {
+	return decryptNonce(ens.lookupKey, token, binding)
+}
+
+// decryptNonce parses and decrypts a nonce minted by encryptNonce with the
+// given binding, using keys to find the cipher for the key identifier in
+// the nonce (or nil if the key is unknown).
+func decryptNonce(keys func(id uint32) cipher.AEAD, token string, binding []byte) (counter uint64, expiry time.Time, ok bool) {
 	zero := time.Time{}
 
 	wire, err := base64.RawURLEncoding.DecodeString(token)
@@ -234,6 +555,12 @@ func (ens *encryptedNonceService) decryptNonce(token string) (counter uint64, ex
 		return 0, zero, false
 	}
 
+	crypt := keys(binary.BigEndian.Uint32(data[0:4]))
+	if crypt == nil {
+		return 0, zero, false
+	}
+	data = data[4:]
+
 	nonce := make([]byte, 12)
 	for i := 0; i < 4; i++ {
 		nonce[i] = 0
@@ -243,7 +570,7 @@ func (ens *encryptedNonceService) decryptNonce(token string) (counter uint64, ex
 
 	ciphertext := data[:]
 
-	plaintext, err := ens.crypt.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := crypt.Open(nil, nonce, ciphertext, nonceAdditionalData(wire[:nonceHeaderLength], binding))
 	if err != nil {
 		return 0, zero, false
 	}
@@ -260,17 +587,27 @@ func (ens *encryptedNonceService) decryptNonce(token string) (counter uint64, ex
 }
 
 func (ens *encryptedNonceService) Redeem(token string) bool {
+	return ens.RedeemBound(token, nil)
+}
+
+// RedeemBound redeems a nonce issued by GetBound with the same binding. A
+// nonce presented with a different binding is rejected without being
+// redeemed, so it remains redeemable with the right one.
+func (ens *encryptedNonceService) RedeemBound(token string, binding []byte) bool {
 	now := time.Now()
-	counter, expiry, ok := ens.decryptNonce(token)
+	counter, expiry, ok := ens.decryptNonce(token, binding)
 	if !ok {
+		ens.metrics.NonceRejected(NonceRejectedMalformed)
 		return false
 	}
 
 	if expiry.Before(now) {
+		ens.metrics.NonceRejected(NonceRejectedExpired)
 		return false
 	}
 
 	if counter <= ens.minCounter.Load() {
+		ens.metrics.NonceRejected(NonceRejectedReplayed)
 		return false
 	}
 
@@ -279,53 +616,70 @@ func (ens *encryptedNonceService) Redeem(token string) bool {
 
 	// From here on out, we're doing the expensive checks. This _looks_
 	// like a valid token, but now we want to verify the used-exactly-once
-	// nature.
-	ens.issueLock.Lock()
-	defer ens.issueLock.Unlock()
+	// nature. Only this counter's shard needs locking.
+	shard := ens.redeemedTokens.shard(counterValue)
+	shard.lock.Lock()
 
-	minCounter := ens.minCounter.Load()
-	if counter <= minCounter {
+	if counter <= ens.minCounter.Load() || shard.contains(timestamp, counterValue) {
 		// Someone else redeemed this token or time has rolled over before we
 		// grabbed this lock. Reject this token.
-		return false
-	}
-
-	// Check if this has already been redeemed.
-	timestampMap, present := ens.redeemedTokens[timestamp]
-	if !present {
-		// No tokens have been redeemed from this token. Provision the
-		// timestamp-specific map, but wait to see if we need to add into
-		// it.
-		timestampMap = make(map[ensCounter]struct{})
-		ens.redeemedTokens[timestamp] = timestampMap
-	}
-
-	_, present = timestampMap[counterValue]
-	if present {
-		// Token was already redeemed. Reject this request.
+		shard.lock.Unlock()
+		ens.metrics.NonceRejected(NonceRejectedReplayed)
 		return false
 	}
 
 	// From here on out, the token is valid. Let's start by seeing if we can
-	// free any memory usage.
-	minCounter = ens.tidyMemoryHoldingLock(now, minCounter)
+	// free any memory usage in this shard.
+	ens.redeemedTokens.dropExpired(shard, ensTimestamp(now.Unix()))
 
 	// Before we add to the map, we should see if we can save memory by just
 	// incrementing the minimum accepted by one, instead of adding to the
-	// timestamp for out of order redemption.
-	if minCounter+1 == counter {
-		minCounter = counter
-	} else {
+	// timestamp for out of order redemption. Other redemptions only ever
+	// move minCounter past values in their own shards, so if this fails,
+	// the counter is still unredeemed.
+	if !ens.minCounter.CompareAndSwap(counter-1, counter) {
 		// Otherwise, we've got to flag this counter as valid.
-		timestampMap[counterValue] = struct{}{}
+		ens.redeemedTokens.add(shard, timestamp, counterValue)
+	}
+	shard.lock.Unlock()
+	ens.metrics.NonceRedeemed()
+
+	// Once the oldest issued nonces have expired, tidy so that minCounter
+	// moves past any of them left unredeemed; otherwise every later
+	// redemption would miss the fast path above.
+	if ens.tidyDue(now) {
+		ens.issueLock.Lock()
+		if ens.tidyDue(now) {
+			ens.redeemedTokens.lockAll()
+			minCounter := ens.tidyMemoryHoldingLock(now, ens.minCounter.Load())
+			ens.minCounter.Store(ens.tidySequentialNonces(now, minCounter))
+			ens.redeemedTokens.unlockAll()
+		}
+		ens.issueLock.Unlock()
 	}
 
-	// Finally, update our value of minCounter because we held the lock.
-	ens.minCounter.Store(minCounter)
+	// Under EvictOldestOnLimit, redemption records are capped here as well
+	// as on issuing, as out-of-order redemptions add them without issuing.
+	if ens.limits.Policy == EvictOldestOnLimit && ens.limits.MaxRedeemed > 0 && ens.redeemedTokens.count.Load() > ens.limits.MaxRedeemed {
+		ens.issueLock.Lock()
+		ens.redeemedTokens.lockAll()
+		if ens.redeemedTokens.count.Load() > ens.limits.MaxRedeemed {
+			ens.evictHoldingLock(0)
+		}
+		ens.redeemedTokens.unlockAll()
+		ens.issueLock.Unlock()
+	}
 
 	return true
 }
 
+// tidyDue returns whether nonces recorded in maxIssued have expired.
+func (ens *encryptedNonceService) tidyDue(now time.Time) bool {
+	oldest := ens.oldestIssued.Load()
+	return oldest != 0 && oldest < uint64(now.Unix())
+}
+
+// tidyMemoryHoldingLock requires holding issueLock and every shard's lock.
 func (ens *encryptedNonceService) tidyMemoryHoldingLock(now time.Time, minCounter uint64) uint64 {
 	// Quick and dirty tidy: any expired timestamps should be deleted, which
 	// should free the most memory (relatively speaking, given a uniform
@@ -333,20 +687,12 @@ func (ens *encryptedNonceService) tidyMemoryHoldingLock(now time.Time, minCounte
 	// redeemed counter values.
 	//
 	// First tidy the redeemed tokens, as that is the largest value.
-	var deleteCandidates []ensTimestamp
-	for candidate := range ens.redeemedTokens {
-		if candidate < ensTimestamp(now.Unix()) {
-			deleteCandidates = append(deleteCandidates, candidate)
-		}
-	}
-	for _, candidate := range deleteCandidates {
-		delete(ens.redeemedTokens, candidate)
-	}
+	ens.redeemedTokens.dropExpiredAll(ensTimestamp(now.Unix()))
 
 	// Then tidy the last used timestamp values. Here, any removed timestamps
 	// have an expiry time before now, which means they cannot be used. This
 	// means our minCounterValue, if it is
-	deleteCandidates = nil
+	var deleteCandidates []ensTimestamp
 	for candidate, lastIssuedInTimestamp := range ens.maxIssued {
 		if candidate < ensTimestamp(now.Unix()) {
 			deleteCandidates = append(deleteCandidates, candidate)
@@ -358,9 +704,18 @@ func (ens *encryptedNonceService) tidyMemoryHoldingLock(now time.Time, minCounte
 	for _, candidate := range deleteCandidates {
 		delete(ens.maxIssued, candidate)
 	}
+
+	var oldest ensTimestamp
+	for timestamp := range ens.maxIssued {
+		if oldest == 0 || timestamp < oldest {
+			oldest = timestamp
+		}
+	}
+	ens.oldestIssued.Store(uint64(oldest))
 	return minCounter
 }
 
+// tidySequentialNonces requires holding every shard's lock.
 func (ens *encryptedNonceService) tidySequentialNonces(now time.Time, minCounter uint64) uint64 {
 	// This potentially slow sequential tidy allows us to free up an
 	// incremental amount of memory when out-of-order (common) redemption
@@ -371,31 +726,8 @@ func (ens *encryptedNonceService) tidySequentialNonces(now time.Time, minCounter
 	// This is made possible by updating the minCounter based on the
 	// earlier maxIssued map and tries to maintain the fast-case invariant
 	// described in newEncryptedNonceService(...).
-	var timestamps []ensTimestamp
-	for timestamp := range ens.redeemedTokens {
-		timestamps = append(timestamps, timestamp)
-	}
-
-	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
-	var deleteCandidates []ensTimestamp
-	for _, timestamp := range timestamps {
-		counters := ens.redeemedTokens[timestamp]
-		for len(counters) > 0 {
-			_, present := counters[ensCounter(minCounter+1)]
-			if !present {
-				return minCounter
-			}
-
-			minCounter += 1
-			delete(counters, ensCounter(minCounter))
-		}
-
-		if len(counters) == 0 {
-			deleteCandidates = append(deleteCandidates, timestamp)
-		}
-	}
-	for _, candidate := range deleteCandidates {
-		delete(ens.redeemedTokens, candidate)
+	for ens.redeemedTokens.remove(ensCounter(minCounter + 1)) {
+		minCounter += 1
 	}
 
 	return minCounter
@@ -405,16 +737,20 @@ func (ens *encryptedNonceService) getMessage(lock time.Duration, memory time.Dur
 	now := time.Now()
 	var message string
 	message += fmt.Sprintf("len(ens.maxIssued): %v\n", len(ens.maxIssued))
-	message += fmt.Sprintf("len(ens.redeemedTokens): %v\n", len(ens.redeemedTokens))
+	timestamps := ens.redeemedTokens.timestamps()
+	message += fmt.Sprintf("len(ens.redeemedTokens): %v\n", len(timestamps))
 
 	var total int
-	for timestamp, counters := range ens.redeemedTokens {
-		message += fmt.Sprintf("    ens.redeemedTokens[%v]: %v\n", timestamp, len(counters))
-		total += len(counters)
+	for timestamp, counters := range timestamps {
+		message += fmt.Sprintf("    ens.redeemedTokens[%v]: %v\n", timestamp, counters)
+		total += counters
 	}
 	build := time.Now()
 
 	message += fmt.Sprintf("total redeemed tokens: %v\n", total)
+	if ens.limits.enabled() {
+		message += fmt.Sprintf("limits: max outstanding %v, max redeemed %v, policy %v\n", ens.limits.MaxOutstanding, ens.limits.MaxRedeemed, ens.limits.Policy)
+	}
 	message += fmt.Sprintf("time to grab lock: %v\n", lock)
 	message += fmt.Sprintf("time to tidy memory: %v\n", memory)
 	message += fmt.Sprintf("time to tidy sequential: %v\n", sequential)
@@ -426,6 +762,8 @@ func (ens *encryptedNonceService) Tidy() *NonceStatus {
 	lockStart := time.Now()
 	ens.issueLock.Lock()
 	defer ens.issueLock.Unlock()
+	ens.redeemedTokens.lockAll()
+	defer ens.redeemedTokens.unlockAll()
 	lockEnd := time.Now()
 
 	minCounter := ens.minCounter.Load()
@@ -437,10 +775,24 @@ func (ens *encryptedNonceService) Tidy() *NonceStatus {
 	sequential := time.Now()
 	ens.minCounter.Store(minCounter)
 
+	ens.keyLock.Lock()
+	ens.retiredKeys = ens.pruneRetiredKeysHoldingLock(now)
+	keyID := ens.key.id
+	retiredKeys := len(ens.retiredKeys)
+	ens.keyLock.Unlock()
+
 	issued := ens.nextCounter.Load()
+	defer func() { ens.metrics.NonceTidied(time.Since(lockStart)) }()
 	return &NonceStatus{
 		Issued:      issued,
 		Outstanding: issued - minCounter,
 		Message:     ens.getMessage(lockEnd.Sub(lockStart), memory.Sub(now), sequential.Sub(memory)),
+		Redeemed:    ens.redeemedTokens.count.Load(),
+		AtLimit:     ens.limits.enabled() && ens.atLimit(),
+		Limited:     ens.limited.Load(),
+		Evicted:     ens.evicted.Load(),
+		KeyID:       keyID,
+		RetiredKeys: retiredKeys,
+		Rotations:   ens.rotations.Load(),
 	}
 }
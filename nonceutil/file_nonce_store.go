@@ -0,0 +1,215 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// The file-backed NonceStore keeps its state in a single JSON file, which
+// is rewritten on every change, including every redemption. The low-water
+// mark keeps the file small when nonces are redeemed roughly in order, but
+// each redemption still costs a locked read and rewrite of the whole file.
+// Access is serialized across processes via an adjacent lock file. This is
+// simple rather than fast and is intended for tests and small deployments
+// sharing a filesystem.
+
+package nonceutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// How long to wait to acquire the lock file before giving up.
+	fileNonceStoreLockTimeout = 10 * time.Second
+
+	// How long to wait between attempts to acquire the lock file.
+	fileNonceStoreLockInterval = 5 * time.Millisecond
+)
+
+type fileNonceStore struct {
+	path string
+
+	// Serializes access within this process; the lock file serializes
+	// access across processes.
+	l sync.Mutex
+}
+
+// fileNonceStoreState is the on-disk format of a fileNonceStore.
+type fileNonceStoreState struct {
+	Key         []byte             `json:"key,omitempty"`
+	NextCounter uint64             `json:"next_counter"`
+	MinCounter  uint64             `json:"min_counter"`
+	MaxReserved map[int64]uint64   `json:"max_reserved,omitempty"`
+	Redeemed    map[int64][]uint64 `json:"redeemed,omitempty"`
+}
+
+// redemptions returns the redemption state held in the on-disk format.
+func (f *fileNonceStoreState) redemptions() *nonceStoreState {
+	state := newNonceStoreState()
+	state.minCounter = f.MinCounter
+	for expiry, last := range f.MaxReserved {
+		state.maxReserved[expiry] = last
+	}
+	for expiry, counters := range f.Redeemed {
+		set := make(map[uint64]struct{}, len(counters))
+		for _, counter := range counters {
+			set[counter] = struct{}{}
+		}
+		state.redeemed[expiry] = set
+	}
+	return state
+}
+
+// setRedemptions replaces the redemption state held in the on-disk format.
+func (f *fileNonceStoreState) setRedemptions(state *nonceStoreState) {
+	f.MinCounter = state.minCounter
+	f.MaxReserved = state.maxReserved
+	f.Redeemed = make(map[int64][]uint64, len(state.redeemed))
+	for expiry, set := range state.redeemed {
+		counters := make([]uint64, 0, len(set))
+		for counter := range set {
+			counters = append(counters, counter)
+		}
+		sort.Slice(counters, func(i, j int) bool { return counters[i] < counters[j] })
+		f.Redeemed[expiry] = counters
+	}
+}
+
+var _ NonceStore = &fileNonceStore{}
+
+// NewFileNonceStore returns a NonceStore that keeps its state in the JSON
+// file at the given path, creating it if necessary. Nonce services in
+// different processes sharing the file behave as nodes of a cluster.
+//
+// A lock file with the same path plus ".lock" is held while the state is
+// read and written. If a process dies while holding it, it must be removed
+// manually.
+func NewFileNonceStore(path string) NonceStore {
+	return &fileNonceStore{path: path}
+}
+
+// update applies fn to the stored state while holding the lock, writing the
+// state back if fn returns true.
+func (s *fileNonceStore) update(fn func(state *fileNonceStoreState) bool) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var state fileNonceStoreState
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read nonce store: %w", err)
+	default:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("failed to parse nonce store: %w", err)
+		}
+	}
+	if !fn(&state) {
+		return nil
+	}
+
+	data, err = json.Marshal(&state)
+	if err != nil {
+		return fmt.Errorf("failed to encode nonce store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	return nil
+}
+
+// lock acquires the lock file, returning a function to release it.
+func (s *fileNonceStore) lock() (func(), error) {
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(fileNonceStoreLockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock nonce store: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for nonce store lock %v", lockPath)
+		}
+		time.Sleep(fileNonceStoreLockInterval)
+	}
+}
+
+func (s *fileNonceStore) LoadOrStoreKey(key []byte) ([]byte, error) {
+	var ret []byte
+	err := s.update(func(state *fileNonceStoreState) bool {
+		if state.Key != nil {
+			ret = state.Key
+			return false
+		}
+		state.Key = key
+		ret = key
+		return true
+	})
+	return ret, err
+}
+
+func (s *fileNonceStore) ReserveCounters(count uint64, expiry int64) (uint64, error) {
+	var first uint64
+	err := s.update(func(state *fileNonceStoreState) bool {
+		first = state.NextCounter + 1
+		state.NextCounter += count
+		redemptions := state.redemptions()
+		redemptions.reserved(expiry, state.NextCounter)
+		state.setRedemptions(redemptions)
+		return true
+	})
+	return first, err
+}
+
+func (s *fileNonceStore) MarkRedeemed(expiry int64, counter uint64) (bool, error) {
+	var marked bool
+	err := s.update(func(state *fileNonceStoreState) bool {
+		redemptions := state.redemptions()
+		if !redemptions.markRedeemed(expiry, counter) {
+			return false
+		}
+		state.setRedemptions(redemptions)
+		marked = true
+		return true
+	})
+	return marked, err
+}
+
+func (s *fileNonceStore) DeleteExpired(before int64) (uint64, error) {
+	var remaining uint64
+	err := s.update(func(state *fileNonceStoreState) bool {
+		redemptions := state.redemptions()
+		remaining = redemptions.deleteExpired(before)
+		state.setRedemptions(redemptions)
+		return true
+	})
+	return remaining, err
+}
@@ -0,0 +1,83 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithKeyRotation(2*time.Second, 0)
+	require.NoError(t, s.Initialize())
+
+	before := getNonces(t, s, 2)
+	require.NoError(t, s.RotateKey())
+	after := getNonces(t, s, 2)
+
+	status := s.Tidy()
+	require.Equal(t, uint32(2), status.KeyID)
+	require.Equal(t, uint64(1), status.Rotations)
+	require.Equal(t, 1, status.RetiredKeys)
+
+	// Nonces minted under either key are redeemable exactly once.
+	for _, nonce := range append(before, after...) {
+		require.True(t, s.Redeem(nonce))
+		require.False(t, s.Redeem(nonce))
+	}
+
+	// Once every nonce minted under the previous key has expired, it is
+	// no longer retained.
+	time.Sleep(3 * time.Second)
+	status = s.Tidy()
+	require.Equal(t, 0, status.RetiredKeys)
+}
+
+func TestNonceKeyRotationSchedule(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithKeyRotation(time.Minute, time.Second)
+	require.NoError(t, s.Initialize())
+
+	first := getNonces(t, s, 1)[0]
+	time.Sleep(1100 * time.Millisecond)
+	second := getNonces(t, s, 1)[0]
+
+	keyID := func(nonce string) uint32 {
+		wire, err := base64.RawURLEncoding.DecodeString(nonce)
+		require.NoError(t, err)
+		return binary.BigEndian.Uint32(wire[len(nonceSentinel):nonceHeaderLength])
+	}
+	require.Equal(t, uint32(1), keyID(first))
+	require.Equal(t, uint32(2), keyID(second))
+
+	require.True(t, s.Redeem(first))
+	require.True(t, s.Redeem(second))
+	require.Equal(t, uint64(1), s.Tidy().Rotations)
+}
+
+func TestNonceKeyIDAuthenticated(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithKeyRotation(time.Minute, 0)
+	require.NoError(t, s.Initialize())
+	nonce := getNonces(t, s, 1)[0]
+	require.NoError(t, s.RotateKey())
+
+	// Pointing the nonce at the other key, or at an unknown one, fails.
+	wire, err := base64.RawURLEncoding.DecodeString(nonce)
+	require.NoError(t, err)
+	for _, id := range []uint32{2, 3} {
+		tampered := append([]byte(nil), wire...)
+		binary.BigEndian.PutUint32(tampered[len(nonceSentinel):], id)
+		require.False(t, s.Redeem(base64.RawURLEncoding.EncodeToString(tampered)))
+	}
+	require.True(t, s.Redeem(nonce))
+}
@@ -22,7 +22,9 @@ import (
 // see IETF RFC 8555 Automatic Certificate Management Environment (ACME).
 //
 // Notably, nonces are not guaranteed to be stored or persisted; nonces
-// from one startup will not necessarily be valid from another.
+// from one startup will not necessarily be valid from another. Use
+// NewCrossNodeNonceService with a shared NonceStore when nonces must be
+// redeemable across nodes or restarts.
 type NonceService interface {
 	// Before using a nonce service, it must be initialized. Failure to
 	// initialize might result in panics or other unexpected results.
@@ -68,6 +70,45 @@ func NewNonceServiceWithValidity(validity time.Duration) NonceService {
 	return newEncryptedNonceService(validity)
 }
 
+// NewNonceServiceWithLimits is like NewNonceServiceWithValidity, but bounds
+// the state held by the service as described by limits.
+func NewNonceServiceWithLimits(validity time.Duration, limits NonceLimits) NonceService {
+	return newEncryptedNonceServiceWithLimits(validity, limits)
+}
+
+// KeyRotatingNonceService is a NonceService whose key for minting nonces
+// can be rotated on demand. Nonces minted under the previous key remain
+// redeemable until they expire.
+type KeyRotatingNonceService interface {
+	NonceService
+
+	RotateKey() error
+}
+
+// ContextBoundNonceService is a NonceService whose nonces can be bound to
+// caller-supplied context, such as an account identifier or a TLS exporter
+// value, so that a nonce obtained by one client cannot be redeemed by
+// another. A nonce obtained via Get is bound to empty context, so Redeem
+// and RedeemBound with an empty binding are interchangeable.
+type ContextBoundNonceService interface {
+	NonceService
+
+	// GetBound is like Get, but the nonce is bound to the given context.
+	GetBound(binding []byte) (string, time.Time, error)
+
+	// RedeemBound is like Redeem, but rejects nonces bound to any context
+	// other than the given one.
+	RedeemBound(token string, binding []byte) bool
+}
+
+// NewNonceServiceWithKeyRotation is like NewNonceServiceWithValidity, but
+// additionally rotates the key for minting nonces once it has been in use
+// for the given interval. The key may also be rotated on demand via
+// RotateKey.
+func NewNonceServiceWithKeyRotation(validity time.Duration, interval time.Duration) KeyRotatingNonceService {
+	return newEncryptedNonceServiceWithKeyRotation(validity, interval)
+}
+
 // Status information about the number of nonces in this service, perhaps
 // local to this node. Presumably, the delta roughly correlates to present
 // memory usage.
@@ -75,4 +116,25 @@ type NonceStatus struct {
 	Issued      uint64
 	Outstanding uint64
 	Message     string
+
+	// Redeemed is the number of redemption records retained by the service
+	// to reject reuse of nonces, where it keeps any.
+	Redeemed uint64
+
+	// AtLimit is whether the service is at its NonceLimits, if any.
+	AtLimit bool
+
+	// Limited is the number of Gets to which the NonceLimits policy was
+	// applied, and Evicted the number of outstanding nonces invalidated by
+	// EvictOldestOnLimit.
+	Limited uint64
+	Evicted uint64
+
+	// KeyID identifies the key nonces are currently minted under, and
+	// Rotations counts how often it has been rotated. RetiredKeys is the
+	// number of previous keys retained because nonces minted under them
+	// have not yet expired.
+	KeyID       uint32
+	Rotations   uint64
+	RetiredKeys int
 }
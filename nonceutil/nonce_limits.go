@@ -0,0 +1,103 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Nonce limits bound the state a nonce service holds while under load. A
+// client requesting nonces as fast as it can, or redeeming them in an
+// adversarial order, otherwise grows the service's memory usage with the
+// rate of requests rather than just the validity period.
+
+package nonceutil
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNonceLimitReached is returned by Get when the service has reached its
+// NonceLimits and its policy is RejectOnLimit.
+var ErrNonceLimitReached = errors.New("nonce limit reached; try again later")
+
+// NonceLimitPolicy is what a nonce service does when issuing another nonce
+// would exceed its NonceLimits.
+type NonceLimitPolicy int
+
+const (
+	// RejectOnLimit fails Get with ErrNonceLimitReached until enough
+	// nonces have been redeemed or have expired.
+	RejectOnLimit NonceLimitPolicy = iota
+
+	// ShortenValidityOnLimit keeps issuing nonces, but with the shortened
+	// validity of the limits, so that the state they hold expires sooner.
+	ShortenValidityOnLimit
+
+	// EvictOldestOnLimit invalidates the oldest outstanding nonces to make
+	// room for new ones. Clients holding evicted nonces have them rejected
+	// on redemption and must fetch new ones.
+	EvictOldestOnLimit
+)
+
+func (p NonceLimitPolicy) String() string {
+	switch p {
+	case RejectOnLimit:
+		return "reject"
+	case ShortenValidityOnLimit:
+		return "shorten-validity"
+	case EvictOldestOnLimit:
+		return "evict-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// NonceLimits caps the state held by a nonce service. A zero value for
+// either cap means that state is unbounded.
+type NonceLimits struct {
+	// MaxOutstanding is the maximum number of issued nonces that have
+	// neither been redeemed nor been tidied after expiring.
+	MaxOutstanding uint64
+
+	// MaxRedeemed is the maximum number of redemption records retained to
+	// reject reuse of nonces that were redeemed out of order. Services that
+	// do not keep such records ignore it.
+	MaxRedeemed uint64
+
+	// Policy is applied when either cap is reached.
+	Policy NonceLimitPolicy
+
+	// ShortenedValidity is the validity of nonces issued under
+	// ShortenValidityOnLimit. When zero, a tenth of the service's validity
+	// is used, but no less than a second.
+	ShortenedValidity time.Duration
+}
+
+func (l NonceLimits) enabled() bool {
+	return l.MaxOutstanding > 0 || l.MaxRedeemed > 0
+}
+
+// reached returns whether issuing another nonce would exceed the limits,
+// given the current amount of outstanding nonces and redemption records.
+func (l NonceLimits) reached(outstanding uint64, redeemed uint64) bool {
+	if l.MaxOutstanding > 0 && outstanding >= l.MaxOutstanding {
+		return true
+	}
+	if l.MaxRedeemed > 0 && redeemed >= l.MaxRedeemed {
+		return true
+	}
+	return false
+}
+
+// shortenedValidity returns the validity of nonces issued while at the
+// limits under ShortenValidityOnLimit.
+func (l NonceLimits) shortenedValidity(validity time.Duration) time.Duration {
+	shortened := l.ShortenedValidity
+	if shortened <= 0 {
+		shortened = validity / 10
+		if shortened < time.Second {
+			shortened = time.Second
+		}
+	}
+	if shortened > validity {
+		shortened = validity
+	}
+	return shortened
+}
@@ -0,0 +1,185 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getNonces(t *testing.T, s NonceService, count int) []string {
+	t.Helper()
+
+	var nonces []string
+	for i := 0; i < count; i++ {
+		nonce, _, err := s.Get()
+		require.NoError(t, err)
+		nonces = append(nonces, nonce)
+	}
+	return nonces
+}
+
+func TestNonceLimitsReject(t *testing.T) {
+	t.Parallel()
+
+	services := map[string]NonceService{
+		"encrypted": NewNonceServiceWithLimits(time.Minute, NonceLimits{MaxOutstanding: 3}),
+		"sync-map":  newSyncMapNonceServiceWithLimits(time.Minute, NonceLimits{MaxOutstanding: 3}),
+	}
+	for name, s := range services {
+		name, s := name, s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, s.Initialize())
+
+			nonces := getNonces(t, s, 3)
+			_, _, err := s.Get()
+			require.ErrorIs(t, err, ErrNonceLimitReached)
+
+			status := s.Tidy()
+			require.True(t, status.AtLimit)
+			require.Equal(t, uint64(1), status.Limited)
+			require.Equal(t, uint64(3), status.Outstanding)
+
+			// Redeeming frees up room for exactly one more nonce.
+			require.True(t, s.Redeem(nonces[0]))
+			getNonces(t, s, 1)
+			_, _, err = s.Get()
+			require.ErrorIs(t, err, ErrNonceLimitReached)
+
+			// Nonces issued before reaching the limit remain valid.
+			require.True(t, s.Redeem(nonces[2]))
+			require.True(t, s.Redeem(nonces[1]))
+			require.False(t, s.Tidy().AtLimit)
+		})
+	}
+}
+
+func TestNonceLimitsRejectRedeemed(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithLimits(time.Minute, NonceLimits{MaxRedeemed: 2})
+	require.NoError(t, s.Initialize())
+
+	// Redeeming out of order retains records until the oldest nonce is
+	// redeemed too.
+	nonces := getNonces(t, s, 4)
+	require.True(t, s.Redeem(nonces[3]))
+	require.True(t, s.Redeem(nonces[2]))
+	_, _, err := s.Get()
+	require.ErrorIs(t, err, ErrNonceLimitReached)
+
+	status := s.Tidy()
+	require.Equal(t, uint64(2), status.Redeemed)
+	require.True(t, status.AtLimit)
+
+	require.True(t, s.Redeem(nonces[0]))
+	require.True(t, s.Redeem(nonces[1]))
+	getNonces(t, s, 1)
+
+	status = s.Tidy()
+	require.Equal(t, uint64(0), status.Redeemed)
+	require.False(t, status.AtLimit)
+}
+
+func TestNonceLimitsShortenValidity(t *testing.T) {
+	t.Parallel()
+
+	limits := NonceLimits{
+		MaxOutstanding:    2,
+		Policy:            ShortenValidityOnLimit,
+		ShortenedValidity: 5 * time.Second,
+	}
+	services := map[string]NonceService{
+		"encrypted": NewNonceServiceWithLimits(time.Hour, limits),
+		"sync-map":  newSyncMapNonceServiceWithLimits(time.Hour, limits),
+	}
+	for name, s := range services {
+		name, s := name, s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, s.Initialize())
+
+			_, expiry, err := s.Get()
+			require.NoError(t, err)
+			require.True(t, expiry.After(time.Now().Add(time.Minute)))
+			getNonces(t, s, 1)
+
+			nonce, expiry, err := s.Get()
+			require.NoError(t, err)
+			require.True(t, expiry.Before(time.Now().Add(10*time.Second)))
+			require.True(t, s.Redeem(nonce))
+
+			status := s.Tidy()
+			require.Equal(t, uint64(1), status.Limited)
+			require.Equal(t, uint64(0), status.Evicted)
+		})
+	}
+
+	require.Equal(t, 9*time.Second, NonceLimits{}.shortenedValidity(90*time.Second))
+	require.Equal(t, time.Second, NonceLimits{}.shortenedValidity(5*time.Second))
+	require.Equal(t, time.Second, NonceLimits{ShortenedValidity: time.Minute}.shortenedValidity(time.Second))
+}
+
+func TestNonceLimitsEvictOldest(t *testing.T) {
+	t.Parallel()
+
+	limits := NonceLimits{MaxOutstanding: 3, Policy: EvictOldestOnLimit}
+	services := map[string]NonceService{
+		"encrypted": NewNonceServiceWithLimits(time.Minute, limits),
+		"sync-map":  newSyncMapNonceServiceWithLimits(time.Minute, limits),
+	}
+	for name, s := range services {
+		name, s := name, s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, s.Initialize())
+
+			nonces := getNonces(t, s, 3)
+			require.True(t, s.Redeem(nonces[1]))
+
+			// Issuing two more evicts the oldest outstanding nonce.
+			nonces = append(nonces, getNonces(t, s, 2)...)
+			require.False(t, s.Redeem(nonces[0]))
+			require.False(t, s.Redeem(nonces[1]))
+			for _, nonce := range nonces[2:] {
+				require.True(t, s.Redeem(nonce))
+			}
+
+			status := s.Tidy()
+			require.Equal(t, uint64(1), status.Evicted)
+			require.Equal(t, uint64(1), status.Limited)
+			require.Equal(t, uint64(0), status.Outstanding)
+			require.False(t, status.AtLimit)
+		})
+	}
+}
+
+func TestNonceLimitsEvictOldestRedeemed(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithLimits(time.Minute, NonceLimits{MaxRedeemed: 2, Policy: EvictOldestOnLimit})
+	require.NoError(t, s.Initialize())
+
+	// Redeeming in reverse order would otherwise retain a record for every
+	// nonce but the first. Forgetting the lowest record evicts every older
+	// outstanding nonce.
+	nonces := getNonces(t, s, 10)
+	for i := len(nonces) - 1; i >= 7; i-- {
+		require.True(t, s.Redeem(nonces[i]))
+		require.LessOrEqual(t, s.Tidy().Redeemed, uint64(2))
+	}
+
+	// Redeemed nonces are still rejected, as are the evicted ones.
+	for _, nonce := range nonces {
+		require.False(t, s.Redeem(nonce))
+	}
+
+	status := s.Tidy()
+	require.Equal(t, uint64(7), status.Evicted)
+	require.Equal(t, uint64(0), status.Outstanding)
+	require.Equal(t, uint64(0), status.Redeemed)
+}
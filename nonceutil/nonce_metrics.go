@@ -0,0 +1,77 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Nonce metrics let callers feed nonce service activity into their own
+// telemetry without this package depending on any metrics library.
+
+package nonceutil
+
+import (
+	"time"
+)
+
+// NonceRejectReason is why a nonce service rejected a nonce on redemption.
+type NonceRejectReason string
+
+const (
+	// NonceRejectedMalformed is for nonces which were not issued by the
+	// service (or were bound to other context, or minted under a key that
+	// is no longer retained).
+	NonceRejectedMalformed NonceRejectReason = "malformed"
+
+	// NonceRejectedExpired is for nonces whose validity period has passed.
+	NonceRejectedExpired NonceRejectReason = "expired"
+
+	// NonceRejectedReplayed is for nonces which were already redeemed, or
+	// which can no longer be told apart from redeemed ones (for example,
+	// after eviction).
+	NonceRejectedReplayed NonceRejectReason = "replayed"
+
+	// NonceRejectedUnavailable is for nonces whose redemption could not be
+	// checked, such as when a cross-node service's store fails.
+	NonceRejectedUnavailable NonceRejectReason = "unavailable"
+)
+
+// NonceMetrics receives events from a nonce service. Implementations are
+// called synchronously from Get, Redeem and Tidy, possibly concurrently,
+// and so must be safe for concurrent use and fast.
+type NonceMetrics interface {
+	// NonceIssued is called for every nonce issued.
+	NonceIssued()
+
+	// NonceRedeemed is called for every nonce accepted on redemption.
+	NonceRedeemed()
+
+	// NonceRejected is called for every nonce rejected on redemption.
+	NonceRejected(reason NonceRejectReason)
+
+	// NonceTidied is called after every tidy, with how long it took.
+	NonceTidied(duration time.Duration)
+}
+
+// InstrumentedNonceService is a NonceService that reports to NonceMetrics.
+type InstrumentedNonceService interface {
+	NonceService
+
+	// SetMetrics sets where the service reports to. It must be called
+	// before the service is used; a nil value stops reporting.
+	SetMetrics(metrics NonceMetrics)
+}
+
+// noopNonceMetrics discards all events; it is the default for services
+// without metrics.
+type noopNonceMetrics struct{}
+
+func (noopNonceMetrics) NonceIssued()                    {}
+func (noopNonceMetrics) NonceRedeemed()                  {}
+func (noopNonceMetrics) NonceRejected(NonceRejectReason) {}
+func (noopNonceMetrics) NonceTidied(time.Duration)       {}
+
+// metricsOrNoop returns metrics, or a NonceMetrics discarding all events if
+// it is nil.
+func metricsOrNoop(metrics NonceMetrics) NonceMetrics {
+	if metrics == nil {
+		return noopNonceMetrics{}
+	}
+	return metrics
+}
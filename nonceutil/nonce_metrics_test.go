@@ -0,0 +1,204 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingMetrics is a NonceMetrics counting every event.
+type countingMetrics struct {
+	l        sync.Mutex
+	issued   int
+	redeemed int
+	rejected map[NonceRejectReason]int
+	tidied   int
+}
+
+var _ NonceMetrics = &countingMetrics{}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{rejected: make(map[NonceRejectReason]int)}
+}
+
+func (m *countingMetrics) NonceIssued() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.issued++
+}
+
+func (m *countingMetrics) NonceRedeemed() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.redeemed++
+}
+
+func (m *countingMetrics) NonceRejected(reason NonceRejectReason) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.rejected[reason]++
+}
+
+func (m *countingMetrics) NonceTidied(duration time.Duration) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.tidied++
+}
+
+func TestNonceMetrics(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	services := map[string]InstrumentedNonceService{
+		"encrypted":  newEncryptedNonceService(time.Second),
+		"cross-node": NewCrossNodeNonceService(time.Second, NewInMemoryNonceStore()).(InstrumentedNonceService),
+		"temporal":   NewTemporalNonceService(time.Second, &TemporalNonceConfig{Key: key, ReplayFilter: true}).(InstrumentedNonceService),
+	}
+	for name, s := range services {
+		name, s := name, s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := newCountingMetrics()
+			s.SetMetrics(m)
+			require.NoError(t, s.Initialize())
+
+			nonces := getNonces(t, s, 3)
+			require.True(t, s.Redeem(nonces[0]))
+			require.False(t, s.Redeem(nonces[0]))
+			require.False(t, s.Redeem("not a nonce"))
+			time.Sleep(2 * time.Second)
+			require.False(t, s.Redeem(nonces[1]))
+			s.Tidy()
+
+			m.l.Lock()
+			defer m.l.Unlock()
+			require.Equal(t, 3, m.issued)
+			require.Equal(t, 1, m.redeemed)
+			require.Equal(t, map[NonceRejectReason]int{
+				NonceRejectedReplayed:  1,
+				NonceRejectedMalformed: 1,
+				NonceRejectedExpired:   1,
+			}, m.rejected)
+			require.Equal(t, 1, m.tidied)
+
+			// Metrics can be turned off again.
+			s.SetMetrics(nil)
+			getNonces(t, s, 1)
+			require.Equal(t, 3, m.issued)
+		})
+	}
+}
+
+func TestNonceMetricsUnavailable(t *testing.T) {
+	t.Parallel()
+
+	store := &failingNonceStore{NonceStore: NewInMemoryNonceStore()}
+	s := NewCrossNodeNonceService(time.Minute, store).(InstrumentedNonceService)
+	m := newCountingMetrics()
+	s.SetMetrics(m)
+	require.NoError(t, s.Initialize())
+
+	nonce := getNonces(t, s, 1)[0]
+	store.l.Lock()
+	store.broken = true
+	store.l.Unlock()
+	require.False(t, s.Redeem(nonce))
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	require.Equal(t, 1, m.rejected[NonceRejectedUnavailable])
+}
+
+func TestEncryptedNonceServiceConcurrentRedeem(t *testing.T) {
+	t.Parallel()
+
+	s := newEncryptedNonceService(time.Minute)
+	require.NoError(t, s.Initialize())
+
+	// Every nonce is redeemed concurrently by several goroutines, in
+	// different orders; exactly one redemption of each must succeed.
+	const numNonces, numWorkers = 2000, 8
+	nonces := getNonces(t, s, numNonces)
+
+	accepted := make([]int, numNonces)
+	var l sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < numNonces; i++ {
+				index := i
+				if w%2 == 1 {
+					index = numNonces - 1 - i
+				}
+				if s.Redeem(nonces[index]) {
+					l.Lock()
+					accepted[index]++
+					l.Unlock()
+				}
+			}
+		}()
+	}
+
+	// Tidy concurrently too, as it takes every shard's lock.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			s.Tidy()
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	for i, count := range accepted {
+		require.Equal(t, 1, count, "nonce %v", i)
+	}
+
+	status := s.Tidy()
+	require.Equal(t, uint64(0), status.Outstanding)
+	require.Equal(t, uint64(0), status.Redeemed)
+}
+
+// TestEncryptedNonceServiceRedeemTidiesExpired checks that redemption alone,
+// without Tidy, moves minCounter past expired unredeemed nonces and drops
+// their issuance records.
+func TestEncryptedNonceServiceRedeemTidiesExpired(t *testing.T) {
+	t.Parallel()
+
+	s := newEncryptedNonceService(time.Second)
+	require.NoError(t, s.Initialize())
+
+	// Leave two nonces unredeemed until they expire.
+	getNonces(t, s, 2)
+	s.issueLock.Lock()
+	expired := len(s.maxIssued)
+	s.issueLock.Unlock()
+	require.NotZero(t, expired)
+	time.Sleep(2100 * time.Millisecond)
+
+	nonces := getNonces(t, s, 2)
+	require.True(t, s.Redeem(nonces[0]))
+	require.True(t, s.Redeem(nonces[1]))
+
+	// The expired nonces are counted as done with, and both fresh nonces
+	// were folded into minCounter rather than recorded.
+	require.Equal(t, uint64(4), s.minCounter.Load())
+	require.Equal(t, uint64(0), s.redeemedTokens.count.Load())
+
+	now := ensTimestamp(time.Now().Unix())
+	s.issueLock.Lock()
+	for timestamp := range s.maxIssued {
+		require.GreaterOrEqual(t, timestamp, now)
+	}
+	s.issueLock.Unlock()
+}
@@ -0,0 +1,212 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// NonceStore is the storage shared by the nodes of a cluster using the
+// cross-node nonce service. The in-memory implementation here is only
+// shared between services in the same process and is intended for tests.
+
+package nonceutil
+
+import (
+	"sync"
+)
+
+// NonceStore is the pluggable storage backing a cross-node nonce service
+// (see NewCrossNodeNonceService). Every node of a cluster must use a store
+// backed by the same underlying storage, and every method must be atomic
+// with respect to all nodes.
+//
+// Storage traffic is bounded: nodes reserve counter values in windows rather
+// than one at a time. As with the encrypted nonce service, the store keeps a
+// shared low-water mark below which every counter value is known to be
+// redeemed or expired; it advances as counters are redeemed in sequence and
+// as reserved windows expire, so only counters redeemed out of order need a
+// record of their own. Those records are kept per expiry timestamp so that
+// they can be dropped wholesale once the timestamp passes.
+//
+// Every redemption still updates the store, as the low-water mark or a
+// record changes each time.
+type NonceStore interface {
+	// LoadOrStoreKey returns the key shared by all nodes for minting nonces.
+	// If no key has been stored yet, the given key is stored and returned.
+	LoadOrStoreKey(key []byte) ([]byte, error)
+
+	// ReserveCounters reserves the next count counter values, returning the
+	// first of them. Counter values start at one and are never reserved
+	// twice. The caller must not issue nonces from them that expire after
+	// expiry (unix seconds); once it passes, the low-water mark advances
+	// past them whether or not they were redeemed.
+	ReserveCounters(count uint64, expiry int64) (uint64, error)
+
+	// MarkRedeemed records the nonce with the given expiry (unix seconds) and
+	// counter value as redeemed, returning false if it already was or if the
+	// counter is at or below the low-water mark.
+	MarkRedeemed(expiry int64, counter uint64) (bool, error)
+
+	// DeleteExpired advances the low-water mark past reserved counters and
+	// removes the redemption records of nonces that expired before the given
+	// time (unix seconds), returning the number of records that remain.
+	DeleteExpired(before int64) (uint64, error)
+}
+
+// nonceStoreState is the redemption state shared by the NonceStore
+// implementations. It mirrors the bookkeeping of encryptedNonceService:
+// minCounter is the low-water mark, maxReserved maps the latest expiry of a
+// reserved window to its highest counter value, and redeemed holds the
+// out-of-order redemptions above minCounter by expiry.
+type nonceStoreState struct {
+	minCounter  uint64
+	maxReserved map[int64]uint64
+	redeemed    map[int64]map[uint64]struct{}
+}
+
+func newNonceStoreState() *nonceStoreState {
+	return &nonceStoreState{
+		maxReserved: make(map[int64]uint64),
+		redeemed:    make(map[int64]map[uint64]struct{}),
+	}
+}
+
+// reserved records that counter values up to last were reserved for nonces
+// expiring no later than expiry.
+func (s *nonceStoreState) reserved(expiry int64, last uint64) {
+	if last > s.maxReserved[expiry] {
+		s.maxReserved[expiry] = last
+	}
+}
+
+// markRedeemed records counter as redeemed, returning false if it already
+// was. Redeeming the counter right above minCounter advances it instead of
+// adding a record.
+func (s *nonceStoreState) markRedeemed(expiry int64, counter uint64) bool {
+	if counter <= s.minCounter {
+		return false
+	}
+	counters := s.redeemed[expiry]
+	if _, present := counters[counter]; present {
+		return false
+	}
+
+	if counter == s.minCounter+1 {
+		s.minCounter = counter
+		s.compact()
+		return true
+	}
+
+	if counters == nil {
+		counters = make(map[uint64]struct{})
+		s.redeemed[expiry] = counters
+	}
+	counters[counter] = struct{}{}
+	return true
+}
+
+// remove deletes the record of counter, returning whether there was one.
+func (s *nonceStoreState) remove(counter uint64) bool {
+	for expiry, counters := range s.redeemed {
+		if _, present := counters[counter]; present {
+			delete(counters, counter)
+			if len(counters) == 0 {
+				delete(s.redeemed, expiry)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compact advances minCounter past records that continue the sequence,
+// like tidySequentialNonces.
+func (s *nonceStoreState) compact() {
+	for s.remove(s.minCounter + 1) {
+		s.minCounter += 1
+	}
+}
+
+// deleteExpired advances minCounter past every window that expired before
+// the given time and drops the records of nonces that did, returning the
+// number of records that remain.
+func (s *nonceStoreState) deleteExpired(before int64) uint64 {
+	for expiry, last := range s.maxReserved {
+		if expiry < before {
+			if last > s.minCounter {
+				s.minCounter = last
+			}
+			delete(s.maxReserved, expiry)
+		}
+	}
+
+	for expiry, counters := range s.redeemed {
+		if expiry < before {
+			delete(s.redeemed, expiry)
+			continue
+		}
+		for counter := range counters {
+			if counter <= s.minCounter {
+				delete(counters, counter)
+			}
+		}
+		if len(counters) == 0 {
+			delete(s.redeemed, expiry)
+		}
+	}
+	s.compact()
+
+	var remaining uint64
+	for _, counters := range s.redeemed {
+		remaining += uint64(len(counters))
+	}
+	return remaining
+}
+
+type inMemoryNonceStore struct {
+	l           sync.Mutex
+	key         []byte
+	nextCounter uint64
+	state       *nonceStoreState
+}
+
+var _ NonceStore = &inMemoryNonceStore{}
+
+// NewInMemoryNonceStore returns a NonceStore that keeps its state in memory.
+// Nonce services sharing it behave as nodes of a cluster, but only within a
+// single process, so this is mostly useful for tests.
+func NewInMemoryNonceStore() NonceStore {
+	return &inMemoryNonceStore{
+		state: newNonceStoreState(),
+	}
+}
+
+func (s *inMemoryNonceStore) LoadOrStoreKey(key []byte) ([]byte, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.key == nil {
+		s.key = append([]byte(nil), key...)
+	}
+	return append([]byte(nil), s.key...), nil
+}
+
+func (s *inMemoryNonceStore) ReserveCounters(count uint64, expiry int64) (uint64, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	first := s.nextCounter + 1
+	s.nextCounter += count
+	s.state.reserved(expiry, s.nextCounter)
+	return first, nil
+}
+
+func (s *inMemoryNonceStore) MarkRedeemed(expiry int64, counter uint64) (bool, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.state.markRedeemed(expiry, counter), nil
+}
+
+func (s *inMemoryNonceStore) DeleteExpired(before int64) (uint64, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.state.deleteExpired(before), nil
+}
@@ -93,3 +93,31 @@ func TestNonceExpiry(t *testing.T) {
 	// Original nonce should fail on second use.
 	require.False(t, s.Redeem(original))
 }
+
+func TestSyncMapNonceTidy(t *testing.T) {
+	t.Parallel()
+
+	s := newSyncMapNonceService(time.Second)
+	require.NoError(t, s.Initialize())
+
+	// Tidying removes every expired nonce, not just the first visited.
+	for i := 0; i < 5; i++ {
+		_, _, err := s.Get()
+		require.NoError(t, err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	current, _, err := s.Get()
+	require.NoError(t, err)
+
+	status := s.Tidy()
+	require.Equal(t, uint64(6), status.Issued)
+	require.Equal(t, uint64(1), status.Outstanding)
+
+	var remaining int
+	s.nonces.Range(func(key, value any) bool {
+		remaining += 1
+		return true
+	})
+	require.Equal(t, 1, remaining)
+	require.True(t, s.Redeem(current))
+}
@@ -0,0 +1,175 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// Redemption records of the encrypted nonce service are sharded by counter
+// value, each shard with its own lock, so that concurrent redemptions of
+// different nonces rarely contend. A given counter value always maps to the
+// same shard, so checking and recording its redemption only needs that
+// shard's lock; operations spanning all records (tidying and eviction) take
+// every shard's lock, in order.
+
+package nonceutil
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Number of shards of redemption records; a power of two.
+const redeemedShardCount = 32
+
+type redeemedShard struct {
+	lock *sync.Mutex
+
+	// As in encryptedNonceService, redemption records are grouped by
+	// expiry timestamp, so that whole groups can be dropped once expired.
+	tokens map[ensTimestamp]map[ensCounter]struct{}
+}
+
+type redeemedShards struct {
+	shards [redeemedShardCount]redeemedShard
+
+	// The number of records across all shards, for checking limits and
+	// reporting status without taking every lock.
+	count *atomic.Uint64
+}
+
+func newRedeemedShards() *redeemedShards {
+	rs := &redeemedShards{count: new(atomic.Uint64)}
+	for i := range rs.shards {
+		rs.shards[i] = redeemedShard{
+			lock:   new(sync.Mutex),
+			tokens: make(map[ensTimestamp]map[ensCounter]struct{}),
+		}
+	}
+	return rs
+}
+
+// shard returns the shard holding the record of the given counter value.
+func (rs *redeemedShards) shard(counter ensCounter) *redeemedShard {
+	return &rs.shards[counter%redeemedShardCount]
+}
+
+func (rs *redeemedShards) lockAll() {
+	for i := range rs.shards {
+		rs.shards[i].lock.Lock()
+	}
+}
+
+func (rs *redeemedShards) unlockAll() {
+	for i := len(rs.shards) - 1; i >= 0; i-- {
+		rs.shards[i].lock.Unlock()
+	}
+}
+
+// subtract decrements the number of records by n.
+func (rs *redeemedShards) subtract(n uint64) {
+	if n > 0 {
+		rs.count.Add(^(n - 1))
+	}
+}
+
+// The following methods require holding the lock of the shard they operate
+// on.
+
+func (s *redeemedShard) contains(timestamp ensTimestamp, counter ensCounter) bool {
+	_, present := s.tokens[timestamp][counter]
+	return present
+}
+
+func (rs *redeemedShards) add(s *redeemedShard, timestamp ensTimestamp, counter ensCounter) {
+	counters, present := s.tokens[timestamp]
+	if !present {
+		counters = make(map[ensCounter]struct{})
+		s.tokens[timestamp] = counters
+	}
+	counters[counter] = struct{}{}
+	rs.count.Add(1)
+}
+
+// dropExpired removes the records of nonces which expired before now.
+func (rs *redeemedShards) dropExpired(s *redeemedShard, now ensTimestamp) {
+	for timestamp, counters := range s.tokens {
+		if timestamp < now {
+			rs.subtract(uint64(len(counters)))
+			delete(s.tokens, timestamp)
+		}
+	}
+}
+
+// The following methods of redeemedShards require holding every shard's
+// lock.
+
+// dropExpiredAll removes the records of nonces which expired before now,
+// from all shards.
+func (rs *redeemedShards) dropExpiredAll(now ensTimestamp) {
+	for i := range rs.shards {
+		rs.dropExpired(&rs.shards[i], now)
+	}
+}
+
+// remove removes the record of the given counter value, whatever its
+// expiry, returning whether there was one.
+func (rs *redeemedShards) remove(counter ensCounter) bool {
+	s := rs.shard(counter)
+	for timestamp, counters := range s.tokens {
+		if _, present := counters[counter]; present {
+			delete(counters, counter)
+			if len(counters) == 0 {
+				delete(s.tokens, timestamp)
+			}
+			rs.subtract(1)
+			return true
+		}
+	}
+	return false
+}
+
+// dropAtOrBelow removes the records at or below minCounter, returning how
+// many were removed.
+func (rs *redeemedShards) dropAtOrBelow(minCounter uint64) uint64 {
+	var dropped uint64
+	for i := range rs.shards {
+		s := &rs.shards[i]
+		for timestamp, counters := range s.tokens {
+			for counter := range counters {
+				if uint64(counter) <= minCounter {
+					delete(counters, counter)
+					dropped += 1
+				}
+			}
+			if len(counters) == 0 {
+				delete(s.tokens, timestamp)
+			}
+		}
+	}
+	rs.subtract(dropped)
+	return dropped
+}
+
+// lowest returns the lowest recorded counter value, or zero if there are
+// no records.
+func (rs *redeemedShards) lowest() ensCounter {
+	var lowest ensCounter
+	for i := range rs.shards {
+		for _, counters := range rs.shards[i].tokens {
+			for counter := range counters {
+				if lowest == 0 || counter < lowest {
+					lowest = counter
+				}
+			}
+		}
+	}
+	return lowest
+}
+
+// timestamps returns the number of records per expiry timestamp.
+func (rs *redeemedShards) timestamps() map[ensTimestamp]int {
+	ret := make(map[ensTimestamp]int)
+	for i := range rs.shards {
+		for timestamp, counters := range rs.shards[i].tokens {
+			ret[timestamp] += len(counters)
+		}
+	}
+	return ret
+}
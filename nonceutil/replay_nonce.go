@@ -0,0 +1,291 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// The Replay-Nonce middleware wires a NonceService into an HTTP API in the
+// style of IETF RFC 8555 (ACME): every response carries a fresh nonce in
+// the Replay-Nonce header, a new-nonce endpoint hands out nonces on their
+// own, and requests that must be fresh are rejected with a badNonce problem
+// document unless they carry a nonce that redeems successfully. Requests
+// whose nonce cannot be read at all are rejected as malformed instead.
+
+package nonceutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ReplayNonceHeader is the response header carrying a fresh nonce.
+	ReplayNonceHeader = "Replay-Nonce"
+
+	// BadNonceProblemType is the problem document type of responses to
+	// requests without a valid nonce.
+	BadNonceProblemType = "urn:ietf:params:acme:error:badNonce"
+
+	// MalformedProblemType is the problem document type of responses to
+	// requests whose nonce could not be extracted, e.g. because the JWS
+	// could not be parsed.
+	MalformedProblemType = "urn:ietf:params:acme:error:malformed"
+
+	// ServerInternalProblemType is the problem document type of responses
+	// from the new-nonce endpoint when a nonce could not be issued.
+	ServerInternalProblemType = "urn:ietf:params:acme:error:serverInternal"
+
+	// DefaultNewNoncePath is the path of the new-nonce endpoint, unless
+	// configured otherwise.
+	DefaultNewNoncePath = "/new-nonce"
+
+	// DefaultMaxJWSBytes is the largest request body JWSNonceExtractor
+	// will read.
+	DefaultMaxJWSBytes = 1024 * 1024
+)
+
+// ErrMissingNonce is returned by a NonceExtractor when the request does not
+// carry a nonce.
+var ErrMissingNonce = errors.New("request does not carry a nonce")
+
+// NonceExtractor returns the nonce carried by a request. It must leave the
+// request readable by the wrapped handler, e.g. by replacing a consumed
+// body.
+type NonceExtractor func(r *http.Request) (string, error)
+
+// ReplayNonceConfig configures NewReplayNonceHandler. The zero value serves
+// the new-nonce endpoint at DefaultNewNoncePath and requires a nonce in the
+// JWS protected header of every POST request.
+type ReplayNonceConfig struct {
+	// NewNoncePath is the path of the new-nonce endpoint.
+	NewNoncePath string
+
+	// Extractor returns the nonce carried by a request; JWSNonceExtractor
+	// if unset.
+	Extractor NonceExtractor
+
+	// RequireNonce returns whether a request must carry a valid nonce; by
+	// default, POST requests must.
+	RequireNonce func(r *http.Request) bool
+
+	// ErrorLog receives the errors of requests rejected because their nonce
+	// could not be extracted, which are not sent to the client. If nil,
+	// the log package's standard logger is used.
+	ErrorLog *log.Logger
+}
+
+type replayNonceHandler struct {
+	service      NonceService
+	next         http.Handler
+	newNoncePath string
+	extract      NonceExtractor
+	requireNonce func(r *http.Request) bool
+	errorLog     *log.Logger
+}
+
+// NewReplayNonceHandler wraps next so that every response carries a fresh
+// nonce from service in the Replay-Nonce header, HEAD and GET requests to
+// the new-nonce endpoint are answered with just a nonce, and requests which
+// must carry a nonce are only passed on to next once it has been redeemed.
+// Otherwise they are answered with a badNonce problem document (RFC 8555
+// Section 6.7), or a malformed one if the nonce could not be extracted,
+// which also carries a fresh nonce for the client to retry with.
+func NewReplayNonceHandler(service NonceService, next http.Handler, config *ReplayNonceConfig) http.Handler {
+	h := &replayNonceHandler{
+		service:      service,
+		next:         next,
+		newNoncePath: DefaultNewNoncePath,
+		extract:      JWSNonceExtractor,
+		requireNonce: func(r *http.Request) bool { return r.Method == http.MethodPost },
+	}
+	if config != nil {
+		if config.NewNoncePath != "" {
+			h.newNoncePath = config.NewNoncePath
+		}
+		if config.Extractor != nil {
+			h.extract = config.Extractor
+		}
+		if config.RequireNonce != nil {
+			h.requireNonce = config.RequireNonce
+		}
+		h.errorLog = config.ErrorLog
+	}
+	return h
+}
+
+func (h *replayNonceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == h.newNoncePath {
+		h.serveNewNonce(w, r)
+		return
+	}
+
+	if h.requireNonce(r) {
+		// The extractor's error may echo the request, so only a fixed
+		// detail is sent back.
+		nonce, err := h.extract(r)
+		switch {
+		case errors.Is(err, ErrMissingNonce):
+			h.setReplayNonce(w)
+			writeProblem(w, http.StatusBadRequest, BadNonceProblemType, "request does not carry a nonce")
+			return
+		case err != nil:
+			h.logf("nonceutil: rejecting %v %v: %v", r.Method, r.URL.Path, err)
+			h.setReplayNonce(w)
+			writeProblem(w, http.StatusBadRequest, MalformedProblemType, "failed to read nonce from request")
+			return
+		}
+		if !h.service.Redeem(nonce) {
+			h.setReplayNonce(w)
+			writeProblem(w, http.StatusBadRequest, BadNonceProblemType, "nonce is invalid, expired or has already been used")
+			return
+		}
+	}
+
+	h.setReplayNonce(w)
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *replayNonceHandler) logf(format string, args ...interface{}) {
+	if h.errorLog != nil {
+		h.errorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// serveNewNonce answers requests to the new-nonce endpoint, as described in
+// RFC 8555 Section 7.2.
+func (h *replayNonceHandler) serveNewNonce(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+	default:
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.setReplayNonce(w); err != nil {
+		writeProblem(w, http.StatusInternalServerError, ServerInternalProblemType, fmt.Sprintf("failed to issue nonce: %v", err))
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setReplayNonce sets the Replay-Nonce header of the response to a fresh
+// nonce. If none could be issued, the header is left unset; a client will
+// find out once it needs one.
+func (h *replayNonceHandler) setReplayNonce(w http.ResponseWriter) error {
+	nonce, _, err := h.service.Get()
+	if err != nil {
+		return err
+	}
+	w.Header().Set(ReplayNonceHeader, nonce)
+	return nil
+}
+
+// problem is an RFC 7807 problem document.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, problemType string, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&problem{
+		Type:   problemType,
+		Detail: detail,
+		Status: status,
+	})
+}
+
+// JWSNonceExtractor returns the "nonce" parameter of the protected header of
+// a JWS in the request body, in either the flattened JSON or the compact
+// serialization. The signature is not verified; that is left to the wrapped
+// handler, which can read the body as usual.
+func JWSNonceExtractor(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", ErrMissingNonce
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, DefaultMaxJWSBytes+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(body) > DefaultMaxJWSBytes {
+		return "", fmt.Errorf("request body exceeds %v bytes", DefaultMaxJWSBytes)
+	}
+
+	protected, err := jwsProtectedHeader(body)
+	if err != nil {
+		return "", err
+	}
+
+	var header struct {
+		Nonce string `json:"nonce"`
+	}
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return "", fmt.Errorf("failed to parse JWS protected header: %w", err)
+	}
+	if header.Nonce == "" {
+		return "", ErrMissingNonce
+	}
+	return header.Nonce, nil
+}
+
+// jwsProtectedHeader returns the decoded protected header of a JWS.
+func jwsProtectedHeader(body []byte) ([]byte, error) {
+	var encoded string
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var jws struct {
+			Protected string `json:"protected"`
+		}
+		if err := json.Unmarshal(trimmed, &jws); err != nil {
+			return nil, fmt.Errorf("failed to parse JWS: %w", err)
+		}
+		encoded = jws.Protected
+	} else {
+		parts := strings.Split(string(trimmed), ".")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("request body is not a JWS")
+		}
+		encoded = parts[0]
+	}
+
+	if encoded == "" {
+		return nil, fmt.Errorf("JWS has no protected header")
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWS protected header: %w", err)
+	}
+	return protected, nil
+}
+
+// HeaderNonceExtractor returns a NonceExtractor for protocols which carry
+// the nonce in the given request header.
+func HeaderNonceExtractor(name string) NonceExtractor {
+	return func(r *http.Request) (string, error) {
+		nonce := r.Header.Get(name)
+		if nonce == "" {
+			return "", ErrMissingNonce
+		}
+		return nonce, nil
+	}
+}
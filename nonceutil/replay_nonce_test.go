@@ -0,0 +1,154 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testJWS(t *testing.T, nonce string, compact bool) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "nonce": nonce})
+	require.NoError(t, err)
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	if compact {
+		return protected + "." + payload + ".c2ln"
+	}
+
+	jws, err := json.Marshal(map[string]string{"protected": protected, "payload": payload, "signature": "c2ln"})
+	require.NoError(t, err)
+	return string(jws)
+}
+
+func TestReplayNonceHandler(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithValidity(time.Minute)
+	require.NoError(t, s.Initialize())
+
+	var bodies []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusCreated)
+	})
+	var logs bytes.Buffer
+	h := NewReplayNonceHandler(s, next, &ReplayNonceConfig{ErrorLog: log.New(&logs, "", 0)})
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	requireProblem := func(w *httptest.ResponseRecorder, problemType string) problem {
+		t.Helper()
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		require.NotEmpty(t, w.Header().Get(ReplayNonceHeader))
+
+		var p problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		require.Equal(t, problemType, p.Type)
+		require.Equal(t, http.StatusBadRequest, p.Status)
+		require.NotEmpty(t, p.Detail)
+		return p
+	}
+	requireBadNonce := func(w *httptest.ResponseRecorder) {
+		t.Helper()
+		requireProblem(w, BadNonceProblemType)
+	}
+
+	// The new-nonce endpoint.
+	w := do(http.MethodHead, DefaultNewNoncePath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	nonce := w.Header().Get(ReplayNonceHeader)
+	require.NotEmpty(t, nonce)
+
+	w = do(http.MethodGet, DefaultNewNoncePath, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.NotEmpty(t, w.Header().Get(ReplayNonceHeader))
+
+	w = do(http.MethodPost, DefaultNewNoncePath, "")
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// A JWS with a fresh nonce is passed on, with its body intact, and
+	// the response carries the next nonce.
+	body := testJWS(t, nonce, false)
+	w = do(http.MethodPost, "/new-order", body)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, []string{body}, bodies)
+	nonce = w.Header().Get(ReplayNonceHeader)
+	require.NotEmpty(t, nonce)
+
+	w = do(http.MethodPost, "/new-order", testJWS(t, nonce, true))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Replayed, forged and missing nonces are rejected.
+	requireBadNonce(do(http.MethodPost, "/new-order", body))
+	requireBadNonce(do(http.MethodPost, "/new-order", testJWS(t, "forged", false)))
+	requireBadNonce(do(http.MethodPost, "/new-order", testJWS(t, "", false)))
+	require.Len(t, bodies, 2)
+
+	// Requests whose JWS cannot be parsed are malformed, and the parse
+	// error is logged rather than echoed.
+	for _, body := range []string{"not a jws", `{"protected": "<script>"}`, "e30.e30.c2ln.extra"} {
+		p := requireProblem(do(http.MethodPost, "/new-order", body), MalformedProblemType)
+		require.Equal(t, "failed to read nonce from request", p.Detail)
+	}
+	require.Contains(t, logs.String(), "failed to decode JWS protected header")
+	require.Len(t, bodies, 2)
+
+	// Other requests need no nonce but still get one.
+	w = do(http.MethodGet, "/directory", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotEmpty(t, w.Header().Get(ReplayNonceHeader))
+}
+
+func TestReplayNonceHandlerConfig(t *testing.T) {
+	t.Parallel()
+
+	s := NewNonceServiceWithValidity(time.Minute)
+	require.NoError(t, s.Initialize())
+
+	h := NewReplayNonceHandler(s, http.NotFoundHandler(), &ReplayNonceConfig{
+		NewNoncePath: "/nonce",
+		Extractor:    HeaderNonceExtractor("X-Nonce"),
+		RequireNonce: func(r *http.Request) bool { return r.Method != http.MethodGet },
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nonce", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	nonce := w.Header().Get(ReplayNonceHeader)
+
+	r := httptest.NewRequest(http.MethodDelete, "/thing", nil)
+	r.Header.Set("X-Nonce", nonce)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/thing", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), ErrMissingNonce.Error())
+}
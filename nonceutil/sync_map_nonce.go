@@ -21,20 +21,40 @@ import (
 )
 
 type syncMapNonceService struct {
-	validity   time.Duration
-	issued     *atomic.Uint64
-	nextExpiry *atomic.Int64
-	nonces     *sync.Map // map[string]time.Time
+	validity    time.Duration
+	issued      *atomic.Uint64
+	outstanding *atomic.Int64
+	nextExpiry  *atomic.Int64
+	nonces      *sync.Map // map[string]time.Time
+
+	// Optional caps on the number of stored nonces. Only MaxOutstanding
+	// applies, as no redemption records are kept. Under
+	// EvictOldestOnLimit, issued nonces are also queued in order so that
+	// the oldest can be found; the queue may hold nonces since redeemed,
+	// which are skipped and periodically compacted away.
+	limits    NonceLimits
+	limitLock sync.Mutex
+	order     []string
+	limited   *atomic.Uint64
+	evicted   *atomic.Uint64
 }
 
 var _ NonceService = &syncMapNonceService{}
 
 func newSyncMapNonceService(validity time.Duration) *syncMapNonceService {
+	return newSyncMapNonceServiceWithLimits(validity, NonceLimits{})
+}
+
+func newSyncMapNonceServiceWithLimits(validity time.Duration, limits NonceLimits) *syncMapNonceService {
 	return &syncMapNonceService{
-		validity:   validity,
-		issued:     new(atomic.Uint64),
-		nextExpiry: new(atomic.Int64),
-		nonces:     new(sync.Map),
+		validity:    validity,
+		issued:      new(atomic.Uint64),
+		outstanding: new(atomic.Int64),
+		nextExpiry:  new(atomic.Int64),
+		nonces:      new(sync.Map),
+		limits:      limits,
+		limited:     new(atomic.Uint64),
+		evicted:     new(atomic.Uint64),
 	}
 }
 
@@ -62,8 +82,33 @@ func (a *syncMapNonceService) Get() (string, time.Time, error) {
 		return "", now, err
 	}
 
-	then := now.Add(a.validity)
+	validity := a.validity
+	if a.limits.MaxOutstanding > 0 {
+		a.limitLock.Lock()
+		defer a.limitLock.Unlock()
+
+		if a.atLimit() {
+			a.tidyExpired(now)
+		}
+		if a.atLimit() {
+			a.limited.Add(1)
+			switch a.limits.Policy {
+			case ShortenValidityOnLimit:
+				validity = a.limits.shortenedValidity(a.validity)
+			case EvictOldestOnLimit:
+				a.evictOldestHoldingLock()
+			default:
+				return "", now, ErrNonceLimitReached
+			}
+		}
+		if a.limits.Policy == EvictOldestOnLimit {
+			a.order = append(a.order, nonce)
+		}
+	}
+
+	then := now.Add(validity)
 	a.nonces.Store(nonce, then)
+	a.outstanding.Add(1)
 
 	nextExpiry := a.nextExpiry.Load()
 	next := time.Unix(nextExpiry, 0)
@@ -81,6 +126,7 @@ func (a *syncMapNonceService) Redeem(nonce string) bool {
 	if !present {
 		return false
 	}
+	a.outstanding.Add(-1)
 
 	timeout := rawTimeout.(time.Time)
 	if time.Now().After(timeout) {
@@ -90,29 +136,79 @@ func (a *syncMapNonceService) Redeem(nonce string) bool {
 	return true
 }
 
-func (a *syncMapNonceService) Tidy() *NonceStatus {
-	now := time.Now()
+func (a *syncMapNonceService) atLimit() bool {
+	return a.limits.reached(uint64(a.outstanding.Load()), 0)
+}
+
+// evictOldestHoldingLock deletes the oldest stored nonces until there is
+// room for another, and compacts the queue of issued nonces.
+func (a *syncMapNonceService) evictOldestHoldingLock() {
+	for len(a.order) > 0 && a.atLimit() {
+		nonce := a.order[0]
+		a.order = a.order[1:]
+		if _, present := a.nonces.LoadAndDelete(nonce); present {
+			a.outstanding.Add(-1)
+			a.evicted.Add(1)
+		}
+	}
+
+	// Redeemed nonces are never removed from the queue by Redeem, so drop
+	// them once they make up most of it.
+	if uint64(len(a.order)) > 2*a.limits.MaxOutstanding {
+		a.compactOrderHoldingLock()
+	}
+}
+
+func (a *syncMapNonceService) compactOrderHoldingLock() {
+	order := make([]string, 0, a.outstanding.Load())
+	for _, nonce := range a.order {
+		if _, present := a.nonces.Load(nonce); present {
+			order = append(order, nonce)
+		}
+	}
+	a.order = order
+}
+
+// tidyExpired deletes expired nonces, returning the earliest expiry of
+// those remaining (or now plus the validity, if there are none).
+func (a *syncMapNonceService) tidyExpired(now time.Time) time.Time {
 	nextRun := now.Add(a.validity)
-	var outstanding uint64
 	a.nonces.Range(func(key, value any) bool {
 		timeout := value.(time.Time)
 		if now.After(timeout) {
-			a.nonces.Delete(key)
-		} else {
-			outstanding += 1
-		}
-
-		if timeout.Before(nextRun) {
+			if _, present := a.nonces.LoadAndDelete(key); present {
+				a.outstanding.Add(-1)
+			}
+		} else if timeout.Before(nextRun) {
 			nextRun = timeout
 		}
 
-		return false /* don't quit looping */
+		return true /* don't quit looping */
 	})
+	return nextRun
+}
 
-	a.nextExpiry.Store(nextRun.Unix())
+func (a *syncMapNonceService) Tidy() *NonceStatus {
+	now := time.Now()
+
+	var atLimit bool
+	if a.limits.MaxOutstanding > 0 {
+		a.limitLock.Lock()
+		a.nextExpiry.Store(a.tidyExpired(now).Unix())
+		if a.limits.Policy == EvictOldestOnLimit {
+			a.compactOrderHoldingLock()
+		}
+		atLimit = a.atLimit()
+		a.limitLock.Unlock()
+	} else {
+		a.nextExpiry.Store(a.tidyExpired(now).Unix())
+	}
 
 	return &NonceStatus{
 		Issued:      a.issued.Load(),
-		Outstanding: outstanding,
+		Outstanding: uint64(a.outstanding.Load()),
+		AtLimit:     atLimit,
+		Limited:     a.limited.Load(),
+		Evicted:     a.evicted.Load(),
 	}
 }
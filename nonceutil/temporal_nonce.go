@@ -0,0 +1,207 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+// The temporal nonce service is a loose nonce service: a nonce is an
+// expiry timestamp and some random bytes, authenticated with HMAC-SHA256,
+// and redemption only checks the MAC and the expiry. It keeps no state per
+// nonce, so any node sharing the key can redeem any other node's nonces,
+// but a nonce can be replayed until it expires.
+//
+// Optionally, each node can keep a rotating Bloom filter of redeemed
+// nonces, which rejects replays to the same node in bounded memory at the
+// cost of occasionally rejecting a fresh nonce.
+
+package nonceutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Sentinel distinguishing temporal nonces from encrypted ones.
+	temporalNonceSentinel = "vaultt"
+
+	// Wire length of a temporal nonce, excluding raw url base64 encoding:
+	//  - 6 byte sentinel (above),
+	//  - 8 byte expiry timestamp, unix seconds,
+	//  - 16 random bytes,
+	//  - 32 byte HMAC-SHA256 of the above.
+	temporalNonceLength = len(temporalNonceSentinel) + 8 + 16 + sha256.Size
+
+	// Minimum length of a configured temporal nonce key.
+	minTemporalNonceKeyLength = 32
+)
+
+// TemporalNonceConfig configures NewTemporalNonceService.
+type TemporalNonceConfig struct {
+	// Key is the HMAC key shared by every node, of at least 32 bytes. If
+	// empty, a random key is generated on initialization and the service
+	// is not cross-node.
+	Key []byte
+
+	// ReplayFilter enables a per-node filter of redeemed nonces, rejecting
+	// replays to the same node.
+	ReplayFilter bool
+
+	// FalsePositiveRate is the rate at which the replay filter rejects
+	// fresh nonces as replays, assuming ExpectedRedemptions. Defaults to
+	// DefaultReplayFilterFalsePositiveRate.
+	FalsePositiveRate float64
+
+	// ExpectedRedemptions is the number of redemptions per validity period
+	// the replay filter is sized for; beyond it, the false positive rate
+	// rises. Defaults to DefaultReplayFilterRedemptions.
+	ExpectedRedemptions uint64
+}
+
+type temporalNonceService struct {
+	validity time.Duration
+	key      []byte
+	shared   bool
+
+	filter *rotatingBloomFilter
+
+	issued   *atomic.Uint64
+	redeemed *atomic.Uint64
+	replayed *atomic.Uint64
+
+	metrics NonceMetrics
+}
+
+var _ InstrumentedNonceService = &temporalNonceService{}
+
+// NewTemporalNonceService creates a loose nonce service, which accepts a
+// nonce any number of times (on any node sharing the configured key) until
+// it expires, unless the replay filter rejects it. A nil config generates
+// a key on initialization and disables the replay filter.
+func NewTemporalNonceService(validity time.Duration, config *TemporalNonceConfig) NonceService {
+	tns := &temporalNonceService{
+		validity: validity,
+		issued:   new(atomic.Uint64),
+		redeemed: new(atomic.Uint64),
+		replayed: new(atomic.Uint64),
+		metrics:  noopNonceMetrics{},
+	}
+	if config != nil {
+		tns.key = append([]byte(nil), config.Key...)
+		tns.shared = len(config.Key) > 0
+		if config.ReplayFilter {
+			tns.filter = newRotatingBloomFilter(validity, config.ExpectedRedemptions, config.FalsePositiveRate)
+		}
+	}
+	return tns
+}
+
+func (tns *temporalNonceService) Initialize() error {
+	if tns.shared {
+		if len(tns.key) < minTemporalNonceKeyLength {
+			return fmt.Errorf("temporal nonce key must be at least %v bytes", minTemporalNonceKeyLength)
+		}
+		return nil
+	}
+
+	key, err := generateNonceKey()
+	if err != nil {
+		return err
+	}
+	tns.key = key
+	return nil
+}
+
+func (tns *temporalNonceService) IsStrict() bool    { return false }
+func (tns *temporalNonceService) IsCrossNode() bool { return tns.shared }
+
+func (tns *temporalNonceService) SetMetrics(metrics NonceMetrics) {
+	tns.metrics = metricsOrNoop(metrics)
+}
+
+func (tns *temporalNonceService) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, tns.key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (tns *temporalNonceService) Get() (string, time.Time, error) {
+	now := time.Now()
+	then := now.Add(tns.validity)
+
+	wire := make([]byte, 0, temporalNonceLength)
+	wire = append(wire, []byte(temporalNonceSentinel)...)
+	wire = binary.BigEndian.AppendUint64(wire, uint64(then.Unix()))
+	random := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return "", now, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	wire = append(wire, random...)
+	wire = append(wire, tns.mac(wire)...)
+
+	tns.issued.Add(1)
+	tns.metrics.NonceIssued()
+	return base64.RawURLEncoding.EncodeToString(wire), then, nil
+}
+
+func (tns *temporalNonceService) Redeem(token string) bool {
+	now := time.Now()
+
+	wire, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(wire) != temporalNonceLength {
+		tns.metrics.NonceRejected(NonceRejectedMalformed)
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(temporalNonceSentinel), wire[:len(temporalNonceSentinel)]) != 1 {
+		tns.metrics.NonceRejected(NonceRejectedMalformed)
+		return false
+	}
+
+	signed, mac := wire[:temporalNonceLength-sha256.Size], wire[temporalNonceLength-sha256.Size:]
+	if !hmac.Equal(mac, tns.mac(signed)) {
+		tns.metrics.NonceRejected(NonceRejectedMalformed)
+		return false
+	}
+
+	unix := binary.BigEndian.Uint64(wire[len(temporalNonceSentinel):])
+	if time.Unix(int64(unix), 0).Before(now) {
+		tns.metrics.NonceRejected(NonceRejectedExpired)
+		return false
+	}
+
+	// The MAC is uniformly distributed and cannot be chosen by a client,
+	// so it doubles as the hash of the nonce for the filter.
+	if tns.filter != nil && !tns.filter.testAndAdd(now, mac) {
+		tns.replayed.Add(1)
+		tns.metrics.NonceRejected(NonceRejectedReplayed)
+		return false
+	}
+
+	tns.redeemed.Add(1)
+	tns.metrics.NonceRedeemed()
+	return true
+}
+
+func (tns *temporalNonceService) Tidy() *NonceStatus {
+	start := time.Now()
+	defer func() { tns.metrics.NonceTidied(time.Since(start)) }()
+
+	// Nothing is stored per nonce, so none are tracked as outstanding.
+	status := &NonceStatus{
+		Issued: tns.issued.Load(),
+	}
+
+	status.Message += fmt.Sprintf("redeemed: %v\n", tns.redeemed.Load())
+	if tns.filter != nil {
+		tns.filter.rotate(time.Now())
+		status.Message += fmt.Sprintf("rejected as replayed: %v\n", tns.replayed.Load())
+		status.Message += tns.filter.String()
+	}
+	return status
+}
@@ -0,0 +1,122 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package nonceutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemporalNonceService(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	a := NewTemporalNonceService(time.Minute, &TemporalNonceConfig{Key: key})
+	b := NewTemporalNonceService(time.Minute, &TemporalNonceConfig{Key: key})
+	require.NoError(t, a.Initialize())
+	require.NoError(t, b.Initialize())
+	require.False(t, a.IsStrict())
+	require.True(t, a.IsCrossNode())
+
+	// Nonces are accepted repeatedly, on any node sharing the key.
+	nonce, _, err := a.Get()
+	require.NoError(t, err)
+	require.True(t, a.Redeem(nonce))
+	require.True(t, a.Redeem(nonce))
+	require.True(t, b.Redeem(nonce))
+
+	// But not on a node with another key.
+	other := NewTemporalNonceService(time.Minute, nil)
+	require.NoError(t, other.Initialize())
+	require.False(t, other.IsCrossNode())
+	require.False(t, other.Redeem(nonce))
+
+	// Nor once tampered with.
+	require.False(t, a.Redeem(nonce[:len(nonce)-2]+"AA"))
+	require.False(t, a.Redeem("not a nonce"))
+
+	status := a.Tidy()
+	require.Equal(t, uint64(1), status.Issued)
+	require.Equal(t, uint64(0), status.Outstanding)
+
+	require.Error(t, NewTemporalNonceService(time.Minute, &TemporalNonceConfig{Key: []byte("short")}).Initialize())
+}
+
+func TestTemporalNonceExpiry(t *testing.T) {
+	t.Parallel()
+
+	s := NewTemporalNonceService(time.Second, nil)
+	require.NoError(t, s.Initialize())
+
+	nonce, _, err := s.Get()
+	require.NoError(t, err)
+	require.True(t, s.Redeem(nonce))
+	time.Sleep(2 * time.Second)
+	require.False(t, s.Redeem(nonce))
+}
+
+func TestTemporalNonceReplayFilter(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	config := &TemporalNonceConfig{Key: key, ReplayFilter: true}
+	a := NewTemporalNonceService(time.Minute, config)
+	b := NewTemporalNonceService(time.Minute, config)
+	require.NoError(t, a.Initialize())
+	require.NoError(t, b.Initialize())
+	require.False(t, a.IsStrict())
+
+	// Replays to the same node are rejected; the filter is per node.
+	nonces := getNonces(t, a, 100)
+	for _, nonce := range nonces {
+		require.True(t, a.Redeem(nonce))
+	}
+	for _, nonce := range nonces {
+		require.False(t, a.Redeem(nonce))
+		require.True(t, b.Redeem(nonce))
+	}
+
+	status := a.Tidy()
+	require.Contains(t, status.Message, "rejected as replayed: 100")
+}
+
+func TestRotatingBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	hash := func(i uint64) []byte {
+		var data [8]byte
+		binary.BigEndian.PutUint64(data[:], i)
+		sum := sha256.Sum256(data[:])
+		return sum[:]
+	}
+
+	now := time.Now()
+	f := newRotatingBloomFilter(time.Minute, 1000, 0.01)
+
+	// Entries are remembered across one rotation but not two.
+	require.True(t, f.testAndAdd(now, hash(0)))
+	require.False(t, f.testAndAdd(now, hash(0)))
+	now = now.Add(time.Minute)
+	require.False(t, f.testAndAdd(now, hash(0)))
+	now = now.Add(2 * time.Minute)
+	require.True(t, f.testAndAdd(now, hash(0)))
+
+	// At the expected load, the false positive rate is about as
+	// configured, and there are never false negatives.
+	var falsePositives int
+	for i := uint64(1); i <= 1000; i++ {
+		if !f.testAndAdd(now, hash(i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 20)
+	for i := uint64(1); i <= 1000; i++ {
+		require.False(t, f.testAndAdd(now, hash(i)))
+	}
+}
@@ -21,6 +21,12 @@ direct Go interface. The calling code can do a type switch to figure out which
 it is, dispense the plugin if needed, and return the interface back to the
 caller.
 
+Plugins from files and filesystems can also be verified against trusted
+publisher keys rather than pinned checksums, by passing a SignatureVerifier
+(see NewSignatureVerifier) to BuildPluginMap via WithSignatureVerifier. The
+signature is checked in CreatePlugin before the plugin is written out or
+executed.
+
 For an example of usage, see the kms.go file in the configutil
 package in this repository.
 */
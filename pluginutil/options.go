@@ -45,6 +45,7 @@ type options struct {
 	withPluginSources            []pluginSourceInfo
 	withPluginExecutionDirectory string
 	withPluginClientCreationFunc PluginClientCreationFunc
+	withSignatureVerifier        SignatureVerifier
 	WithSecureConfig             *gp.SecureConfig
 }
 
@@ -61,8 +62,10 @@ func getDefaultOptions() options {
 // entry when determining the plugin type.
 //
 // This doesn't currently support any kind of secure config and is meant for
-// cases where you can build up this FS securely. See WithPluginFile for adding
-// individual files with checksumming.
+// cases where you can build up this FS securely, unless WithSignatureVerifier
+// is also given, in which case each plugin must be accompanied in the FS by a
+// detached signature. See WithPluginFile for adding individual files with
+// checksumming.
 func WithPluginsFilesystem(withPrefix string, withPlugins fs.FS) Option {
 	return func(o *options) error {
 		if withPlugins == nil {
@@ -99,7 +102,8 @@ func WithPluginsMap(with map[string]InmemCreationFunc) Option {
 }
 
 // WithPluginFile provides source information for a file on disk (rather than an
-// fs.FS abstraction or an in-memory function). Secure hash info _must_ be
+// fs.FS abstraction or an in-memory function). Secure hash info or a signature
+// (verified against the keys given by WithSignatureVerifier) _must_ be
 // provided in this case. If there are conflicts with the name, the last one
 // wins, a property shared with WithPluginsFilesystem and WithPluginsMap).
 func WithPluginFile(with PluginFileInfo) Option {
@@ -110,8 +114,8 @@ func WithPluginFile(with PluginFileInfo) Option {
 			return errors.New("plugin file name is empty")
 		case with.Path == "":
 			return errors.New("plugin file path is empty")
-		case len(with.Checksum) == 0:
-			return errors.New("plugin file checksum is empty")
+		case len(with.Checksum) == 0 && len(with.Signature) == 0:
+			return errors.New("plugin file checksum and signature are both empty")
 		}
 
 		switch with.HashMethod {
@@ -163,6 +167,20 @@ func WithPluginClientCreationFunc(with PluginClientCreationFunc) Option {
 	}
 }
 
+// WithSignatureVerifier allows verifying detached signatures of plugins from
+// files and filesystems against trusted publisher keys, prior to execution.
+// When given, every such plugin must be signed: file plugins via
+// PluginFileInfo.Signature, and filesystem plugins by a signature file next to
+// the plugin, named as the plugin with a ".sig" suffix (".minisig" for
+// minisign). Signatures are over the plugin as stored, i.e. over the
+// compressed bytes of a ".gz" plugin.
+func WithSignatureVerifier(with SignatureVerifier) Option {
+	return func(o *options) error {
+		o.withSignatureVerifier = with
+		return nil
+	}
+}
+
 // WithSecureConfig allows passing in the go-plugin secure config struct for
 // validating a plugin prior to execution. Generally not needed if the plugin is
 // being spun out of the binary at runtime.
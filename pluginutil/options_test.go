@@ -102,6 +102,17 @@ func Test_GetOpts(t *testing.T) {
 		require.NoError(err)
 		require.NotNil(opts.WithSecureConfig)
 	})
+	t.Run("with-signature-verifier", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		opts, err := GetOpts()
+		require.NoError(err)
+		assert.Nil(opts.withSignatureVerifier)
+		verifier, err := NewSignatureVerifier(SignatureFormatSSH, []byte(testSSHPublisherKey))
+		require.NoError(err)
+		opts, err = GetOpts(WithSignatureVerifier(verifier))
+		require.NoError(err)
+		assert.Equal(verifier, opts.withSignatureVerifier)
+	})
 	t.Run("with-plugin-file", func(t *testing.T) {
 		file, err := os.CreateTemp("", "")
 		require.NoError(t, err)
@@ -134,7 +145,7 @@ func Test_GetOpts(t *testing.T) {
 					Name: "testing",
 					Path: file.Name(),
 				},
-				wantErrContains: "checksum is empty",
+				wantErrContains: "checksum and signature are both empty",
 			},
 			{
 				name: "bad hash type",
@@ -186,6 +197,15 @@ func Test_GetOpts(t *testing.T) {
 				},
 				wantHashMethod: HashMethodSha3384,
 			},
+			{
+				name: "signature only",
+				plugin: PluginFileInfo{
+					Name:      "testing",
+					Path:      file.Name(),
+					Signature: []byte("foobar"),
+				},
+				wantHashMethod: HashMethodSha2256,
+			},
 		}
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
@@ -8,6 +8,7 @@ import (
 	"compress/gzip"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"fmt"
 	"hash"
 	"io/fs"
@@ -39,11 +40,15 @@ const (
 // testing for how this works in go-plugin, e.g. passing it into SecureConfig,
 // is in configutil to avoid pulling in go-kms-wrapping as a dep of this
 // package.
+//
+// Signature, if set, is a detached signature of the file, verified against the
+// keys given by WithSignatureVerifier prior to execution.
 type PluginFileInfo struct {
 	Name       string
 	Path       string
 	Checksum   []byte
 	HashMethod HashMethod
+	Signature  []byte
 }
 
 type (
@@ -62,11 +67,14 @@ type (
 
 // PluginInfo contains plugin instantiation information for a single plugin,
 // parsed from the various maps and FSes that can be input to the BuildPluginMap
-// function.
+// function. If SignatureVerifier is set, Signature must verify against the
+// plugin's bytes before it is executed.
 type PluginInfo struct {
 	ContainerFs              fs.FS
 	Path                     string
 	SecureConfig             *gp.SecureConfig
+	Signature                []byte
+	SignatureVerifier        SignatureVerifier
 	InmemCreationFunc        InmemCreationFunc
 	PluginClientCreationFunc PluginClientCreationFunc
 }
@@ -76,6 +84,10 @@ type PluginInfo struct {
 // information. The desired plugin can then be sent to CreatePlugin to actually
 // instantiate it. If a plugin is specified by name multiple times in option,
 // the last one wins.
+//
+// If the WithSignatureVerifier option is passed, every plugin from a file or
+// filesystem must have a signature; signature files in filesystems are not
+// themselves treated as plugins.
 func BuildPluginMap(opt ...Option) (map[string]*PluginInfo, error) {
 	opts, err := GetOpts(opt...)
 	if err != nil {
@@ -97,17 +109,36 @@ func BuildPluginMap(opt ...Option) (map[string]*PluginInfo, error) {
 			if err != nil {
 				return nil, fmt.Errorf("error scanning plugins: %w", err)
 			}
+			var sigSuffix string
+			if opts.withSignatureVerifier != nil {
+				sigSuffix = signatureSuffix(opts.withSignatureVerifier)
+			}
 			// Store a match between the config type string and the expected plugin name
 			for _, entry := range dirs {
+				if sigSuffix != "" && strings.HasSuffix(entry.Name(), sigSuffix) {
+					continue
+				}
 				pluginType := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), sourceInfo.pluginFsPrefix), ".gz")
 				if runtime.GOOS == "windows" {
 					pluginType = strings.TrimSuffix(pluginType, ".exe")
 				}
-				pluginMap[pluginType] = &PluginInfo{
+				info := &PluginInfo{
 					ContainerFs:              sourceInfo.pluginFs,
 					Path:                     entry.Name(),
 					PluginClientCreationFunc: opts.withPluginClientCreationFunc,
 				}
+				if sigSuffix != "" {
+					sig, err := fs.ReadFile(sourceInfo.pluginFs, entry.Name()+sigSuffix)
+					switch {
+					case errors.Is(err, fs.ErrNotExist):
+						return nil, fmt.Errorf("plugin %q: %w: expected signature file %q", entry.Name(), ErrSignatureMissing, entry.Name()+sigSuffix)
+					case err != nil:
+						return nil, fmt.Errorf("plugin %q: error reading signature file: %w", entry.Name(), err)
+					}
+					info.Signature = sig
+					info.SignatureVerifier = opts.withSignatureVerifier
+				}
+				pluginMap[pluginType] = info
 			}
 		case sourceInfo.pluginMap != nil:
 			for k, creationFunc := range sourceInfo.pluginMap {
@@ -116,6 +147,23 @@ func BuildPluginMap(opt ...Option) (map[string]*PluginInfo, error) {
 
 		case sourceInfo.pluginFileInfo != nil:
 			fileInfo := sourceInfo.pluginFileInfo
+			info := &PluginInfo{
+				Path:                     fileInfo.Path,
+				PluginClientCreationFunc: opts.withPluginClientCreationFunc,
+			}
+			switch {
+			case opts.withSignatureVerifier != nil && len(fileInfo.Signature) == 0:
+				return nil, fmt.Errorf("plugin %q: %w", fileInfo.Name, ErrSignatureMissing)
+			case opts.withSignatureVerifier == nil && len(fileInfo.Signature) > 0:
+				return nil, fmt.Errorf("plugin %q has a signature but no signature verifier provided", fileInfo.Name)
+			case opts.withSignatureVerifier != nil:
+				info.Signature = fileInfo.Signature
+				info.SignatureVerifier = opts.withSignatureVerifier
+			}
+			if len(fileInfo.Checksum) == 0 {
+				pluginMap[fileInfo.Name] = info
+				continue
+			}
 			var h hash.Hash
 			switch fileInfo.HashMethod {
 			case HashMethodSha2256:
@@ -131,14 +179,11 @@ func BuildPluginMap(opt ...Option) (map[string]*PluginInfo, error) {
 			case HashMethodSha3512:
 				h = sha3.New512()
 			}
-			pluginMap[fileInfo.Name] = &PluginInfo{
-				Path:                     fileInfo.Path,
-				PluginClientCreationFunc: opts.withPluginClientCreationFunc,
-				SecureConfig: &gp.SecureConfig{
-					Checksum: fileInfo.Checksum,
-					Hash:     h,
-				},
+			info.SecureConfig = &gp.SecureConfig{
+				Checksum: fileInfo.Checksum,
+				Hash:     h,
 			}
+			pluginMap[fileInfo.Name] = info
 		}
 	}
 
@@ -156,6 +201,9 @@ func BuildPluginMap(opt ...Option) (map[string]*PluginInfo, error) {
 // PluginClientCreationFunction from the given *PluginInfo, where it can be sent
 // into the go-plugin client configuration.
 //
+// If the *PluginInfo has a SignatureVerifier, the plugin's signature is
+// verified before the plugin is written out or executed.
+//
 // The caller should ensure that cleanup() is executed when they are done using
 // the plugin. In the case of an in-memory plugin it will be nil, however, if
 // the plugin is via RPC it will ensure that it is torn down properly.
@@ -189,22 +237,20 @@ func CreatePlugin(plugin *PluginInfo, opt ...Option) (interface{}, func() error,
 	case plugin.PluginClientCreationFunc == nil:
 		return nil, nil, fmt.Errorf("plugin creation func not provided")
 
-	// Either we need to have a validated FS to read from or a secure config
-	case plugin.ContainerFs == nil && plugin.SecureConfig == nil:
-		return nil, nil, fmt.Errorf("plugin container filesystem and secure config are both nil")
+	// Either we need to have a validated FS to read from, a secure config, or
+	// a signature to verify
+	case plugin.ContainerFs == nil && plugin.SecureConfig == nil && plugin.SignatureVerifier == nil:
+		return nil, nil, fmt.Errorf("plugin container filesystem, secure config, and signature verifier are all nil")
 
 	// If we have a constructed filesystem, read from there
 	case plugin.ContainerFs != nil:
 		file, err = plugin.ContainerFs.Open(plugin.Path)
 		name = plugin.Path
 
-	// If we have secure config, read from disk
-	case plugin.SecureConfig != nil:
+	// If we have secure config or a signature verifier, read from disk
+	default:
 		file, err = os.Open(plugin.Path)
 		name = filepath.Base(plugin.Path)
-
-	default:
-		return nil, nil, fmt.Errorf("unhandled path in create plugin switch")
 	}
 
 	// This is the error from opening the file
@@ -231,6 +277,17 @@ func CreatePlugin(plugin *PluginInfo, opt ...Option) (interface{}, func() error,
 		return nil, nil, fmt.Errorf("reading plugin, expected %d bytes, read %d", expLen, readLen)
 	}
 
+	// Verify the signature over the bytes as stored, before anything else
+	// is done with them
+	if plugin.SignatureVerifier != nil {
+		if len(plugin.Signature) == 0 {
+			return nil, nil, fmt.Errorf("plugin %q: %w", plugin.Path, ErrSignatureMissing)
+		}
+		if err := plugin.SignatureVerifier.Verify(buf, plugin.Signature); err != nil {
+			return nil, nil, fmt.Errorf("plugin %q: %w", plugin.Path, err)
+		}
+	}
+
 	// If it's compressed, uncompress it
 	if strings.HasSuffix(name, ".gz") {
 		gzipReader, err := gzip.NewReader(bytes.NewReader(buf))
@@ -0,0 +1,352 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package pluginutil
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureFormat is a string representation of a detached signature format
+type SignatureFormat string
+
+const (
+	SignatureFormatUnspecified SignatureFormat = ""
+	SignatureFormatEd25519     SignatureFormat = "ed25519"
+	SignatureFormatMinisign    SignatureFormat = "minisign"
+	SignatureFormatSSH         SignatureFormat = "ssh"
+)
+
+// DefaultSSHSignatureNamespace is the namespace SSH signatures are expected to
+// be made in unless otherwise specified, matching "ssh-keygen -Y sign -n
+// file".
+const DefaultSSHSignatureNamespace = "file"
+
+var (
+	// ErrSignatureMissing is returned when signature verification is
+	// configured but a plugin has no signature.
+	ErrSignatureMissing = errors.New("plugin signature missing")
+
+	// ErrSignatureInvalid is returned when a plugin's signature cannot be
+	// parsed or does not verify against any of the trusted public keys.
+	ErrSignatureInvalid = errors.New("plugin signature invalid")
+)
+
+// SignatureVerifier verifies a detached signature over the bytes of a plugin,
+// as stored (i.e. before any decompression), against a set of trusted public
+// keys.
+type SignatureVerifier interface {
+	Verify(message, signature []byte) error
+}
+
+// NewSignatureVerifier returns a SignatureVerifier trusting the given public
+// keys, which must all be in the given format:
+//
+//   - ed25519: a raw 32 byte key, its base64 encoding, or a PEM-encoded PKIX
+//     public key; signatures are raw 64 byte signatures or their base64
+//     encoding.
+//   - minisign: the contents of a minisign public key file, or just its
+//     base64 line; signatures are the contents of a .minisig file.
+//   - ssh: a public key in authorized_keys format; signatures are armored
+//     SSH signatures made in the DefaultSSHSignatureNamespace, as produced by
+//     "ssh-keygen -Y sign". See NewSSHSignatureVerifier for other namespaces.
+func NewSignatureVerifier(format SignatureFormat, publicKeys ...[]byte) (SignatureVerifier, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no public keys provided for signature verification")
+	}
+
+	switch format {
+	case SignatureFormatEd25519:
+		return newEd25519Verifier(publicKeys)
+	case SignatureFormatMinisign:
+		return newMinisignVerifier(publicKeys)
+	case SignatureFormatSSH:
+		return NewSSHSignatureVerifier(DefaultSSHSignatureNamespace, publicKeys...)
+	default:
+		return nil, fmt.Errorf("unsupported signature format %q", string(format))
+	}
+}
+
+// signatureSuffix returns the suffix of the signature file accompanying a
+// plugin in a filesystem, for the given verifier.
+func signatureSuffix(v SignatureVerifier) string {
+	if s, ok := v.(interface{ signatureSuffix() string }); ok {
+		return s.signatureSuffix()
+	}
+	return ".sig"
+}
+
+type ed25519Verifier struct {
+	keys []ed25519.PublicKey
+}
+
+func newEd25519Verifier(publicKeys [][]byte) (*ed25519Verifier, error) {
+	v := &ed25519Verifier{}
+	for i, raw := range publicKeys {
+		key, err := parseEd25519PublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ed25519 public key %d: %w", i, err)
+		}
+		v.keys = append(v.keys, key)
+	}
+	return v, nil
+}
+
+func parseEd25519PublicKey(raw []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(raw); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is a %T, not ed25519", key)
+		}
+		return edKey, nil
+	}
+
+	if len(raw) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(raw), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected %d byte key, raw or base64 encoded", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(decoded), nil
+}
+
+func (v *ed25519Verifier) Verify(message, signature []byte) error {
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			return fmt.Errorf("%w: expected %d byte ed25519 signature, raw or base64 encoded", ErrSignatureInvalid, ed25519.SignatureSize)
+		}
+		signature = decoded
+	}
+	for _, key := range v.keys {
+		if ed25519.Verify(key, message, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature does not match any trusted ed25519 key", ErrSignatureInvalid)
+}
+
+// Minisign keys and signatures start with a two byte algorithm identifier and
+// an eight byte key ID. "Ed" signatures are over the message itself, "ED"
+// signatures over its BLAKE2b-512 hash.
+const (
+	minisignKeyIdLength = 8
+	minisignKeyLength   = 2 + minisignKeyIdLength + ed25519.PublicKeySize
+	minisignSigLength   = 2 + minisignKeyIdLength + ed25519.SignatureSize
+	minisignTrustedTag  = "trusted comment: "
+)
+
+type minisignVerifier struct {
+	keys map[[minisignKeyIdLength]byte]ed25519.PublicKey
+}
+
+func newMinisignVerifier(publicKeys [][]byte) (*minisignVerifier, error) {
+	v := &minisignVerifier{keys: make(map[[minisignKeyIdLength]byte]ed25519.PublicKey)}
+	for i, raw := range publicKeys {
+		decoded, err := minisignDecodeLine(raw, minisignKeyLength)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing minisign public key %d: %w", i, err)
+		}
+		if string(decoded[:2]) != "Ed" {
+			return nil, fmt.Errorf("error parsing minisign public key %d: unsupported algorithm %q", i, decoded[:2])
+		}
+		var keyId [minisignKeyIdLength]byte
+		copy(keyId[:], decoded[2:2+minisignKeyIdLength])
+		v.keys[keyId] = ed25519.PublicKey(decoded[2+minisignKeyIdLength:])
+	}
+	return v, nil
+}
+
+// minisignDecodeLine decodes the first line of raw that is neither empty nor
+// a comment, which must be base64 encoding exactly length bytes.
+func minisignDecodeLine(raw []byte, length int) ([]byte, error) {
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding base64: %w", err)
+		}
+		if len(decoded) != length {
+			return nil, fmt.Errorf("expected %d bytes, got %d", length, len(decoded))
+		}
+		return decoded, nil
+	}
+	return nil, errors.New("no key or signature found")
+}
+
+func (v *minisignVerifier) signatureSuffix() string { return ".minisig" }
+
+func (v *minisignVerifier) Verify(message, signature []byte) error {
+	// A signature file has an untrusted comment, the signature, a trusted
+	// comment and a global signature over the signature and trusted comment.
+	var lines []string
+	for _, line := range strings.Split(string(signature), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], minisignTrustedTag) {
+		return fmt.Errorf("%w: malformed minisign signature file", ErrSignatureInvalid)
+	}
+
+	sig, err := minisignDecodeLine([]byte(lines[1]), minisignSigLength)
+	if err != nil {
+		return fmt.Errorf("%w: error parsing minisign signature: %v", ErrSignatureInvalid, err)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: error parsing minisign global signature", ErrSignatureInvalid)
+	}
+
+	var keyId [minisignKeyIdLength]byte
+	copy(keyId[:], sig[2:2+minisignKeyIdLength])
+	key, ok := v.keys[keyId]
+	if !ok {
+		return fmt.Errorf("%w: signed by untrusted minisign key %X", ErrSignatureInvalid, keyId)
+	}
+
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+	default:
+		return fmt.Errorf("%w: unsupported minisign algorithm %q", ErrSignatureInvalid, sig[:2])
+	}
+
+	sigBytes := sig[2+minisignKeyIdLength:]
+	if !ed25519.Verify(key, message, sigBytes) {
+		return fmt.Errorf("%w: minisign signature does not match", ErrSignatureInvalid)
+	}
+	trusted := append(append([]byte{}, sigBytes...), strings.TrimPrefix(lines[2], minisignTrustedTag)...)
+	if !ed25519.Verify(key, trusted, globalSig) {
+		return fmt.Errorf("%w: minisign trusted comment does not match", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+// The SSH signature format is described in the OpenSSH source, in
+// PROTOCOL.sshsig.
+const (
+	sshSignatureMagic   = "SSHSIG"
+	sshSignatureVersion = 1
+	sshSignaturePEMType = "SSH SIGNATURE"
+)
+
+type sshVerifier struct {
+	namespace string
+	keys      [][]byte
+}
+
+// NewSSHSignatureVerifier returns a SignatureVerifier for SSH signatures made
+// in the given namespace (see "ssh-keygen -Y sign -n") by any of the given
+// public keys, in authorized_keys format.
+func NewSSHSignatureVerifier(namespace string, publicKeys ...[]byte) (SignatureVerifier, error) {
+	if namespace == "" {
+		return nil, errors.New("ssh signature namespace is empty")
+	}
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no public keys provided for signature verification")
+	}
+
+	v := &sshVerifier{namespace: namespace}
+	for i, raw := range publicKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ssh public key %d: %w", i, err)
+		}
+		v.keys = append(v.keys, key.Marshal())
+	}
+	return v, nil
+}
+
+func (v *sshVerifier) Verify(message, signature []byte) error {
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != sshSignaturePEMType {
+		return fmt.Errorf("%w: not an armored ssh signature", ErrSignatureInvalid)
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshSignatureMagic)) {
+		return fmt.Errorf("%w: missing ssh signature magic", ErrSignatureInvalid)
+	}
+
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(sshSignatureMagic):], &sig); err != nil {
+		return fmt.Errorf("%w: error parsing ssh signature: %v", ErrSignatureInvalid, err)
+	}
+	if sig.Version != sshSignatureVersion {
+		return fmt.Errorf("%w: unsupported ssh signature version %d", ErrSignatureInvalid, sig.Version)
+	}
+	if sig.Namespace != v.namespace {
+		return fmt.Errorf("%w: ssh signature namespace is %q, expected %q", ErrSignatureInvalid, sig.Namespace, v.namespace)
+	}
+
+	var trusted bool
+	for _, key := range v.keys {
+		if bytes.Equal(key, sig.PublicKey) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("%w: signed by untrusted ssh key", ErrSignatureInvalid)
+	}
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: error parsing ssh signature public key: %v", ErrSignatureInvalid, err)
+	}
+
+	var hash []byte
+	switch sig.HashAlgorithm {
+	case "sha256":
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported ssh signature hash algorithm %q", ErrSignatureInvalid, sig.HashAlgorithm)
+	}
+
+	sshSig := new(ssh.Signature)
+	if err := ssh.Unmarshal(sig.Signature, sshSig); err != nil {
+		return fmt.Errorf("%w: error parsing ssh signature blob: %v", ErrSignatureInvalid, err)
+	}
+
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{v.namespace, sig.Reserved, sig.HashAlgorithm, hash})...)
+	if err := key.Verify(signed, sshSig); err != nil {
+		return fmt.Errorf("%w: ssh signature does not match: %v", ErrSignatureInvalid, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright IBM Corp. 2020, 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package pluginutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	gp "github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// The SSH fixtures were generated with "ssh-keygen -Y sign -n file" over
+// testSignedMessage.
+const (
+	testSignedMessage   = "not really a plugin\n"
+	testSSHPublisherKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEWq01PDhIBuNYBy5zwWQ/p5hWEsWRwezUPc6po8juPO publisher"
+	testSSHOtherKey     = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJn2sQ4Op1OFSFp02Zay2DAaNmgHIaPnG+aKH2MdT/GE other"
+	testSSHSignature    = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgRarTU8OEgG41gHLnPBZD+nmFYS
+xZHB7NQ9zqmjyO484AAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEC8tJrv219ikelavtMjlwHzob/blCjq3Vuez6FQMAXWOxPwi5LQyq0VcSJmJVI5ct
+Fx1roqMXzMvoCN7JfaTicN
+-----END SSH SIGNATURE-----
+`
+)
+
+// testMinisign returns a minisign public key file for the given key and a
+// signature file over message, prehashed if requested.
+func testMinisign(t *testing.T, pub ed25519.PublicKey, priv ed25519.PrivateKey, keyId []byte, message []byte, prehashed bool) ([]byte, []byte) {
+	t.Helper()
+	pubKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyId...), pub...))
+	pubFile := fmt.Sprintf("untrusted comment: minisign public key\n%s\n", pubKey)
+
+	alg := "Ed"
+	if prehashed {
+		alg = "ED"
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+	}
+	sig := ed25519.Sign(priv, message)
+	trustedComment := "timestamp:1700000000\tfile:plugin"
+	globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))
+	sigFile := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(alg), keyId...), sig...)),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig),
+	)
+	return []byte(pubFile), []byte(sigFile)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	message := []byte(testSignedMessage)
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := NewSignatureVerifier(SignatureFormatEd25519)
+		assert.ErrorContains(err, "no public keys")
+		_, err = NewSignatureVerifier("foobar", []byte("foobar"))
+		assert.ErrorContains(err, "unsupported signature format")
+		_, err = NewSignatureVerifier(SignatureFormatEd25519, []byte("foobar"))
+		assert.ErrorContains(err, "error parsing ed25519 public key 0")
+		_, err = NewSignatureVerifier(SignatureFormatMinisign, []byte("foobar"))
+		assert.ErrorContains(err, "error parsing minisign public key 0")
+		_, err = NewSignatureVerifier(SignatureFormatSSH, []byte("foobar"))
+		assert.ErrorContains(err, "error parsing ssh public key 0")
+		_, err = NewSSHSignatureVerifier("", []byte(testSSHPublisherKey))
+		assert.ErrorContains(err, "namespace is empty")
+	})
+
+	t.Run("ed25519", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(err)
+		otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(err)
+		sig := ed25519.Sign(priv, message)
+
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(err)
+		for name, key := range map[string][]byte{
+			"raw":    pub,
+			"base64": []byte(base64.StdEncoding.EncodeToString(pub) + "\n"),
+			"pem":    pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		} {
+			v, err := NewSignatureVerifier(SignatureFormatEd25519, otherPub, key)
+			require.NoError(err, name)
+			assert.NoError(v.Verify(message, sig), name)
+			assert.NoError(v.Verify(message, []byte(base64.StdEncoding.EncodeToString(sig))), name)
+		}
+
+		v, err := NewSignatureVerifier(SignatureFormatEd25519, pub)
+		require.NoError(err)
+		assert.ErrorIs(v.Verify([]byte("tampered"), sig), ErrSignatureInvalid)
+		assert.ErrorIs(v.Verify(message, ed25519.Sign(otherPriv, message)), ErrSignatureInvalid)
+		assert.ErrorIs(v.Verify(message, []byte("foobar")), ErrSignatureInvalid)
+	})
+
+	t.Run("minisign", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(err)
+		keyId := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+		for _, prehashed := range []bool{false, true} {
+			pubFile, sigFile := testMinisign(t, pub, priv, keyId, message, prehashed)
+			v, err := NewSignatureVerifier(SignatureFormatMinisign, pubFile)
+			require.NoError(err)
+			assert.NoError(v.Verify(message, sigFile))
+			assert.ErrorIs(v.Verify([]byte("tampered"), sigFile), ErrSignatureInvalid)
+		}
+
+		// A signature by a key with an unknown key ID is rejected
+		otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(err)
+		pubFile, _ := testMinisign(t, pub, priv, keyId, message, true)
+		_, otherSigFile := testMinisign(t, otherPub, otherPriv, []byte{8, 7, 6, 5, 4, 3, 2, 1}, message, true)
+		v, err := NewSignatureVerifier(SignatureFormatMinisign, pubFile)
+		require.NoError(err)
+		err = v.Verify(message, otherSigFile)
+		assert.ErrorIs(err, ErrSignatureInvalid)
+		assert.ErrorContains(err, "untrusted minisign key")
+
+		// A tampered trusted comment is rejected
+		_, sigFile := testMinisign(t, pub, priv, keyId, message, true)
+		lines := strings.Split(string(sigFile), "\n")
+		lines[2] = "trusted comment: timestamp:0"
+		err = v.Verify(message, []byte(strings.Join(lines, "\n")))
+		assert.ErrorContains(err, "trusted comment does not match")
+		assert.ErrorIs(v.Verify(message, []byte("foobar")), ErrSignatureInvalid)
+		assert.Equal(".minisig", signatureSuffix(v))
+	})
+
+	t.Run("ssh", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		v, err := NewSignatureVerifier(SignatureFormatSSH, []byte(testSSHOtherKey), []byte(testSSHPublisherKey))
+		require.NoError(err)
+		assert.NoError(v.Verify(message, []byte(testSSHSignature)))
+		assert.ErrorIs(v.Verify([]byte("tampered"), []byte(testSSHSignature)), ErrSignatureInvalid)
+		assert.ErrorIs(v.Verify(message, []byte("foobar")), ErrSignatureInvalid)
+		assert.Equal(".sig", signatureSuffix(v))
+
+		v, err = NewSignatureVerifier(SignatureFormatSSH, []byte(testSSHOtherKey))
+		require.NoError(err)
+		assert.ErrorContains(v.Verify(message, []byte(testSSHSignature)), "untrusted ssh key")
+
+		v, err = NewSSHSignatureVerifier("plugin", []byte(testSSHPublisherKey))
+		require.NoError(err)
+		assert.ErrorContains(v.Verify(message, []byte(testSSHSignature)), "namespace")
+	})
+}
+
+func TestPluginSignatures(t *testing.T) {
+	message := []byte(testSignedMessage)
+	verifier, err := NewSignatureVerifier(SignatureFormatSSH, []byte(testSSHPublisherKey))
+	require.NoError(t, err)
+
+	errCreated := errors.New("creation func called")
+	creationFunc := func(string, ...Option) (*gp.Client, error) {
+		return nil, errCreated
+	}
+
+	t.Run("filesystem", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		pluginFs := fstest.MapFS{
+			"signed":       {Data: message},
+			"signed.sig":   {Data: []byte(testSSHSignature)},
+			"tampered":     {Data: []byte("tampered")},
+			"tampered.sig": {Data: []byte(testSSHSignature)},
+		}
+
+		plugins, err := BuildPluginMap(
+			WithPluginsFilesystem("", pluginFs),
+			WithPluginClientCreationFunc(creationFunc),
+			WithSignatureVerifier(verifier),
+		)
+		require.NoError(err)
+		require.Len(plugins, 2)
+		assert.Equal([]byte(testSSHSignature), plugins["signed"].Signature)
+
+		_, _, err = CreatePlugin(plugins["signed"], WithPluginExecutionDirectory(t.TempDir()))
+		assert.ErrorIs(err, errCreated)
+		_, _, err = CreatePlugin(plugins["tampered"])
+		assert.ErrorIs(err, ErrSignatureInvalid)
+		assert.NotErrorIs(err, errCreated)
+
+		pluginFs["unsigned"] = &fstest.MapFile{Data: message}
+		_, err = BuildPluginMap(
+			WithPluginsFilesystem("", pluginFs),
+			WithPluginClientCreationFunc(creationFunc),
+			WithSignatureVerifier(verifier),
+		)
+		assert.ErrorIs(err, ErrSignatureMissing)
+		assert.ErrorContains(err, `"unsigned.sig"`)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		path := filepath.Join(t.TempDir(), "plugin")
+		require.NoError(os.WriteFile(path, message, 0o600))
+
+		_, err := BuildPluginMap(
+			WithPluginFile(PluginFileInfo{Name: "plugin", Path: path, Signature: []byte(testSSHSignature)}),
+			WithPluginClientCreationFunc(creationFunc),
+		)
+		assert.ErrorContains(err, "no signature verifier provided")
+
+		_, err = BuildPluginMap(
+			WithPluginFile(PluginFileInfo{Name: "plugin", Path: path, Checksum: []byte("foobar")}),
+			WithPluginClientCreationFunc(creationFunc),
+			WithSignatureVerifier(verifier),
+		)
+		assert.ErrorIs(err, ErrSignatureMissing)
+
+		plugins, err := BuildPluginMap(
+			WithPluginFile(PluginFileInfo{Name: "plugin", Path: path, Signature: []byte(testSSHSignature)}),
+			WithPluginClientCreationFunc(creationFunc),
+			WithSignatureVerifier(verifier),
+		)
+		require.NoError(err)
+		require.Contains(plugins, "plugin")
+		assert.Nil(plugins["plugin"].SecureConfig)
+		_, _, err = CreatePlugin(plugins["plugin"], WithPluginExecutionDirectory(t.TempDir()))
+		assert.ErrorIs(err, errCreated)
+
+		require.NoError(os.WriteFile(path, []byte("tampered"), 0o600))
+		_, _, err = CreatePlugin(plugins["plugin"], WithPluginExecutionDirectory(t.TempDir()))
+		assert.ErrorIs(err, ErrSignatureInvalid)
+		assert.NotErrorIs(err, errCreated)
+	})
+}